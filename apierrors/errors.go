@@ -1,6 +1,10 @@
 package apierrors
 
-import "fmt"
+import (
+	"fmt"
+	"goserver/utils/gsvalidation"
+	"net/http"
+)
 
 // error codes
 const (
@@ -12,92 +16,234 @@ const (
 	// client errors
 	OPERATION_NOT_DEFINED    ErrorCode = 2001
 	INVALID_ARGUMENT 	     ErrorCode = 2002
+	NOT_ACCEPTABLE           ErrorCode = 2003
+	UNSUPPORTED_MEDIA_TYPE   ErrorCode = 2004
+	REQUEST_TOO_LARGE        ErrorCode = 2005
+	REQUEST_CANCELED         ErrorCode = 2006
 	// server errors
 	INTERNAL_SERVER_ERROR    ErrorCode = 5001
 	IO_FILE_ERROR 		     ErrorCode = 5002
 	JSON_PARSING_ERROR 	     ErrorCode = 5003
 	READER_ERROR             ErrorCode = 5004
 	CLIENT_NOT_DEFINED       ErrorCode = 5005
+	REQUEST_TIMEOUT          ErrorCode = 5006
 	DTO_MAPPING_ERROR        ErrorCode = 5010
 	// HTTP errors
 	HTTP_CONNECTION_ERROR    ErrorCode = 6001
 	RESPONSE_UNMARSHAL_ERROR ErrorCode = 6002
+	DEPENDENCY_UNAVAILABLE   ErrorCode = 6003
 )
 
+// STATUS_CLIENT_CLOSED_REQUEST is the (non standard) http status of the
+// requests canceled by the client before being answered.
+const STATUS_CLIENT_CLOSED_REQUEST = 499
+
 var errors = map[ErrorCode]ErrorMessage {
 	// default
 	ERR_NOT_DEFINED: {
-		Label: "ERR_NOT_DEFINED", 
-		Message: "Unrecognized error encountered. Contact support team"},
+		Label: "ERR_NOT_DEFINED",
+		Message: "Unrecognized error encountered. Contact support team",
+		Status: http.StatusInternalServerError,
+		Title: "Unrecognized error",
+		Type: "urn:goserver:problem:err-not-defined",
+	},
 	// business errors
 	USER_NOT_FOUND: {
-		Label: "USER_NOT_FOUND", 
-		Message: "User could not be found"},
+		Label: "USER_NOT_FOUND",
+		Message: "User could not be found",
+		Status: http.StatusNotFound,
+		Title: "User not found",
+		Type: "urn:goserver:problem:user-not-found",
+	},
 	EXTERNAL_API_ERROR: {
 		Label: "EXTERNAL_API_ERROR",
 		Message: "External API returned an error",
+		Status: http.StatusBadGateway,
+		Title: "External API error",
+		Type: "urn:goserver:problem:external-api-error",
 	},
 	// client errors
 	OPERATION_NOT_DEFINED: {
 		Label: "OPERATION_NOT_DEFINED",
 		Message: "Invoked path/operation is not defined",
+		Status: http.StatusNotFound,
+		Title: "Operation not defined",
+		Type: "urn:goserver:problem:operation-not-defined",
 	},
 	INVALID_ARGUMENT: {
 		Label: "INVALID_ARGUMENT",
 		Message: "Client specified invalid request parameter",
+		Status: http.StatusBadRequest,
+		Title: "Invalid argument",
+		Type: "urn:goserver:problem:invalid-argument",
+	},
+	NOT_ACCEPTABLE: {
+		Label: "NOT_ACCEPTABLE",
+		Message: "None of the media types accepted by the client can be produced",
+		Status: http.StatusNotAcceptable,
+		Title: "Not acceptable",
+		Type: "urn:goserver:problem:not-acceptable",
+	},
+	UNSUPPORTED_MEDIA_TYPE: {
+		Label: "UNSUPPORTED_MEDIA_TYPE",
+		Message: "Content-Type of the request body is not supported",
+		Status: http.StatusUnsupportedMediaType,
+		Title: "Unsupported media type",
+		Type: "urn:goserver:problem:unsupported-media-type",
+	},
+	REQUEST_TOO_LARGE: {
+		Label: "REQUEST_TOO_LARGE",
+		Message: "Request body is too large",
+		Status: http.StatusRequestEntityTooLarge,
+		Title: "Request too large",
+		Type: "urn:goserver:problem:request-too-large",
+	},
+	REQUEST_CANCELED: {
+		Label: "REQUEST_CANCELED",
+		Message: "Request was canceled by the client",
+		Status: STATUS_CLIENT_CLOSED_REQUEST,
+		Title: "Request canceled",
+		Type: "urn:goserver:problem:request-canceled",
 	},
 	// server errors
 	INTERNAL_SERVER_ERROR: {
 		Label: "INTERNAL_SERVER_ERROR",
 		Message: "Internal error found. Please contact support team",
+		Status: http.StatusInternalServerError,
+		Title: "Internal server error",
+		Type: "urn:goserver:problem:internal-server-error",
 	},
 	IO_FILE_ERROR: {
 		Label: "IO_FILE_ERROR",
 		Message: "Input/Output error while reading a file",
+		Status: http.StatusInternalServerError,
+		Title: "File error",
+		Type: "urn:goserver:problem:io-file-error",
 	},
 	JSON_PARSING_ERROR: {
 		Label: "JSON_PARSING_ERROR",
 		Message: "Error while parsing a JSON content",
+		Status: http.StatusInternalServerError,
+		Title: "JSON parsing error",
+		Type: "urn:goserver:problem:json-parsing-error",
 	},
 	READER_ERROR: {
 		Label: "READER_ERROR",
 		Message: "Error while reading Body from Request",
+		Status: http.StatusInternalServerError,
+		Title: "Reader error",
+		Type: "urn:goserver:problem:reader-error",
 	},
 	CLIENT_NOT_DEFINED: {
 		Label: "CLIENT_NOT_DEFINED",
 		Message: "External API client not defined",
+		Status: http.StatusInternalServerError,
+		Title: "Client not defined",
+		Type: "urn:goserver:problem:client-not-defined",
+	},
+	REQUEST_TIMEOUT: {
+		Label: "REQUEST_TIMEOUT",
+		Message: "Request could not be completed in time",
+		Status: http.StatusGatewayTimeout,
+		Title: "Request timeout",
+		Type: "urn:goserver:problem:request-timeout",
 	},
 	DTO_MAPPING_ERROR: {
 		Label: "DTO_MAPPING_ERROR",
 		Message: "Failed mapping model to DTO",
+		Status: http.StatusInternalServerError,
+		Title: "DTO mapping error",
+		Type: "urn:goserver:problem:dto-mapping-error",
 	},
 	// HTTP errors
 	HTTP_CONNECTION_ERROR: {
 		Label: "HTTP_CONNECTION_ERROR",
 		Message: "Connection error while attempting http connection",
+		Status: http.StatusBadGateway,
+		Title: "HTTP connection error",
+		Type: "urn:goserver:problem:http-connection-error",
 	},
 	RESPONSE_UNMARSHAL_ERROR: {
 		Label: "RESPONSE_UNMARSHAL_ERROR",
 		Message: "Could not unmarshal response body received from external api",
+		Status: http.StatusBadGateway,
+		Title: "Response unmarshal error",
+		Type: "urn:goserver:problem:response-unmarshal-error",
+	},
+	DEPENDENCY_UNAVAILABLE: {
+		Label: "DEPENDENCY_UNAVAILABLE",
+		Message: "External API is temporarily unavailable. Please try again later",
+		Status: http.StatusServiceUnavailable,
+		Title: "Dependency unavailable",
+		Type: "urn:goserver:problem:dependency-unavailable",
 	},
 }
 
 type ErrorCode int
 
+// ErrorMessage describes an error code: its label and default message, and
+// how it's answered to the client (see Problem).
 type ErrorMessage struct {
 	Label 	string
 	Message string
+	// Status is the http status of the responses with the error.
+	Status  int
+	// Title is a short summary of the error, the same for every occurrence.
+	Title   string
+	// Type is the URI identifying the error.
+	Type    string
 }
 
 // the serializable error structure
 type Error struct {
-	Code 	ErrorCode `json:"code"`
-	Label 	string 	  `json:"label"`
-	Message string    `json:"message"`
+	Code 	ErrorCode    `json:"code"`
+	Label 	string 	     `json:"label"`
+	Message string       `json:"message"`
+	// Status, Title and Type are the ones of the error code.
+	Status  int          `json:"-" xml:"-"`
+	Title   string       `json:"-" xml:"-"`
+	Type    string       `json:"-" xml:"-"`
+	// Errors has one entry per field of the request failing validation.
+	Errors  []FieldError `json:"errors,omitempty"`
+	// Internal describes what failed for the ones reading the logs. Unlike
+	// Message, it's never written to the client.
+	Internal string                `json:"-" xml:"-"`
+	// Details are key/value pairs logged with the error, never written to
+	// the client either.
+	Details map[string]interface{} `json:"-" xml:"-"`
+	// Params are the parameters of the localized message (see Catalog).
+	Params  map[string]interface{} `json:"-" xml:"-"`
+	// customMessage reports whether Message is not the one of the code, so
+	// it's not localized.
+	customMessage bool
+	// cause is the error wrapped, if any (see Wrap).
+	cause   error
+	// stack is the call stack where the error was created, if captured (see
+	// WithStack).
+	stack   []uintptr
 }
 
+// FieldError describes a field of a request failing validation.
+type FieldError struct {
+	Field   string `json:"field" xml:"field"`
+	Message string `json:"message" xml:"message"`
+	// Rule and Param are the ones of the validation failed, used to localize
+	// the message.
+	Rule    string `json:"-" xml:"-"`
+	Param   string `json:"-" xml:"-"`
+}
+
+// Error returns the error as logged: its code, label and message, followed by
+// the internal message and the cause, if any.
 func (e *Error) Error() string {
-	return e.ToString()
+	s := e.ToString()
+	if e.Internal != "" {
+		s = fmt.Sprintf("%s (%s)", s, e.Internal)
+	}
+	if e.cause != nil {
+		s = fmt.Sprintf("%s: %s", s, e.cause.Error())
+	}
+	return s
 }
 
 func (e *Error) ToString() string {
@@ -113,17 +259,56 @@ func New(ec ErrorCode) *Error {
 		Code: ec,
 		Label: errMsg.Label,
 		Message: errMsg.Message,
+		Status: errMsg.Status,
+		Title: errMsg.Title,
+		Type: errMsg.Type,
 	}
 }
 
 func NewWithMsg(ec ErrorCode, m string) *Error {
-	errMsg := errors[ERR_NOT_DEFINED]
-	if em, ok := errors[ec]; ok {
-		errMsg = em
+	e := New(ec)
+	e.Message = m
+	e.customMessage = true
+	return e
+}
+
+// WithParam adds a parameter of the localized message (see Catalog). Returns
+// the same error, so calls can be chained.
+func (e *Error) WithParam(key string, value interface{}) *Error {
+	if e.Params == nil {
+		e.Params = make(map[string]interface{})
 	}
-	return &Error{
-		Code: ec,
-		Label: errMsg.Label,
-		Message: m,
+	e.Params[key] = value
+	return e
+}
+
+// FromValidation builds an Error from the error returned when decoding and
+// validating a request body with gsvalidation, choosing the code from the
+// status suggested and keeping its field errors. If there are field errors,
+// the message is the one of the code, as they describe the problem.
+func FromValidation(s *gsvalidation.HttpSuggestionError) *Error {
+	code := INVALID_ARGUMENT
+	switch s.Status {
+	case http.StatusUnsupportedMediaType:
+		code = UNSUPPORTED_MEDIA_TYPE
+	case http.StatusRequestEntityTooLarge:
+		code = REQUEST_TOO_LARGE
+	case http.StatusInternalServerError:
+		code = INTERNAL_SERVER_ERROR
+	}
+	if len(s.Errors) == 0 {
+		return NewWithMsg(code, s.Message)
 	}
+	e := New(code)
+	for _, fe := range s.Errors {
+		e.Errors = append(e.Errors, FieldError{Field: fe.Field, Message: fe.Message, Rule: fe.Rule, Param: fe.Param})
+	}
+	return e
+}
+
+// FromHttpError builds an HTTP_CONNECTION_ERROR wrapping the error returned
+// by an http call (see Wrap). Calls rejected because the external API is
+// unavailable are mapped by the client to DEPENDENCY_UNAVAILABLE instead.
+func FromHttpError(err error) *Error {
+	return Wrap(HTTP_CONNECTION_ERROR, err, "executing http call")
 }
\ No newline at end of file
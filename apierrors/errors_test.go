@@ -0,0 +1,69 @@
+package apierrors
+
+import (
+	stderrors "errors"
+	"goserver/utils/gsvalidation"
+	"net/http"
+	"testing"
+)
+
+func TestFromValidation(t *testing.T) {
+	tests := []struct {
+		status  uint
+		code    ErrorCode
+		message string
+	}{
+		{http.StatusBadRequest, INVALID_ARGUMENT, "invalid JSON"},
+		{http.StatusRequestEntityTooLarge, REQUEST_TOO_LARGE, "body too large"},
+		{http.StatusUnsupportedMediaType, UNSUPPORTED_MEDIA_TYPE, "unsupported content type"},
+		{http.StatusInternalServerError, INTERNAL_SERVER_ERROR, "couldn't read body"},
+	}
+	for _, tt := range tests {
+		e := FromValidation(&gsvalidation.HttpSuggestionError{Status: tt.status, Message: tt.message})
+		if e.Code != tt.code || e.Status != int(tt.status) || e.Message != tt.message || len(e.Errors) != 0 {
+			t.Errorf("FromValidation(%d) = %+v, want %s with message %q", tt.status, e, New(tt.code).Label, tt.message)
+		}
+	}
+}
+
+func TestFromValidationKeepsFieldErrors(t *testing.T) {
+	e := FromValidation(&gsvalidation.HttpSuggestionError{
+		Status:  http.StatusBadRequest,
+		Message: "validation failed",
+		Errors: []gsvalidation.FieldError{
+			{Field: "name", Message: "name is required", Rule: "required"},
+			{Field: "age", Message: "age must be 130 or less", Rule: "lte", Param: "130"},
+		},
+	})
+	if e.Code != INVALID_ARGUMENT || e.Message != New(INVALID_ARGUMENT).Message {
+		t.Errorf("error = %+v, want INVALID_ARGUMENT with the message of the code", e)
+	}
+	want := []FieldError{
+		{Field: "name", Message: "name is required", Rule: "required"},
+		{Field: "age", Message: "age must be 130 or less", Rule: "lte", Param: "130"},
+	}
+	if len(e.Errors) != len(want) || e.Errors[0] != want[0] || e.Errors[1] != want[1] {
+		t.Errorf("Errors = %+v, want %+v", e.Errors, want)
+	}
+}
+
+func TestFromHttpError(t *testing.T) {
+	cause := stderrors.New("connection refused")
+	e := FromHttpError(cause)
+	if e.Code != HTTP_CONNECTION_ERROR || e.Status != http.StatusBadGateway || !stderrors.Is(e, cause) {
+		t.Errorf("FromHttpError = %+v, want HTTP_CONNECTION_ERROR wrapping the cause", e)
+	}
+}
+
+func TestNew(t *testing.T) {
+	e := New(USER_NOT_FOUND)
+	if e.Label != "USER_NOT_FOUND" || e.Status != http.StatusNotFound || e.Title != "User not found" || e.Type != "urn:goserver:problem:user-not-found" {
+		t.Errorf("New = %+v, want the description of USER_NOT_FOUND", e)
+	}
+	if e := New(ErrorCode(42)); e.Code != 42 || e.Label != "ERR_NOT_DEFINED" || e.Status != http.StatusInternalServerError {
+		t.Errorf("New(42) = %+v, want the description of ERR_NOT_DEFINED", e)
+	}
+	if e := NewWithMsg(INVALID_ARGUMENT, "bad id"); e.Message != "bad id" || !e.customMessage {
+		t.Errorf("NewWithMsg = %+v, want the custom message", e)
+	}
+}
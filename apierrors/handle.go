@@ -0,0 +1,60 @@
+package apierrors
+
+import (
+	"context"
+	stderrors "errors"
+	"goserver/utils/gslog"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gsvalidation"
+	"net/http"
+)
+
+// From maps any error into an Error:
+//   - an Error (or one wrapped by err) is returned as is.
+//   - a gsvalidation.HttpSuggestionError is mapped with FromValidation.
+//   - context cancellation is a REQUEST_CANCELED, as the client is gone, and
+//     an exceeded deadline, a REQUEST_TIMEOUT.
+//   - any other error is wrapped as an INTERNAL_SERVER_ERROR.
+func From(err error) *Error {
+	var e *Error
+	if stderrors.As(err, &e) {
+		return e
+	}
+	var s *gsvalidation.HttpSuggestionError
+	if stderrors.As(err, &s) {
+		return FromValidation(s)
+	}
+	switch {
+	case stderrors.Is(err, context.Canceled):
+		return Wrap(REQUEST_CANCELED, err, "request canceled")
+	case stderrors.Is(err, context.DeadlineExceeded):
+		return Wrap(REQUEST_TIMEOUT, err, "deadline exceeded")
+	}
+	return Wrap(INTERNAL_SERVER_ERROR, err, "unexpected error")
+}
+
+// Handle is the central error handler, set as the one of every gshandler.Func
+// (see gshandler.SetErrorHandler): maps the error returned by a handler (see
+// From), logs it once with the trace ID of the request and writes it to the
+// client (see Write). Server errors (5xx) are logged with level ERROR; the
+// rest, with level WARN.
+//
+// If the request was canceled by the client (whatever error it caused), only
+// the status is written, as nobody will read the response.
+func Handle(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+	if stderrors.Is(r.Context().Err(), context.Canceled) && e.Code != REQUEST_CANCELED {
+		e = Wrap(REQUEST_CANCELED, e, "request canceled")
+	}
+	traceID := gsmiddleware.GetTraceID(r.Context())
+	if e.Status >= 500 || e.Status == 0 {
+		gslog.ErrorFrom(e, traceID)
+	} else {
+		gslog.WarnFrom(e, traceID)
+	}
+	if e.Code == REQUEST_CANCELED {
+		w.WriteHeader(e.Status)
+		return
+	}
+	Write(w, r, e)
+}
@@ -0,0 +1,121 @@
+package apierrors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"goserver/utils/gslog"
+	"goserver/utils/gsrender"
+	"goserver/utils/gsvalidation"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// logLines redirects the log lines written during the test to the returned
+// buffer.
+func logLines(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	gslog.SetOutput(&buf)
+	t.Cleanup(func() { gslog.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// levels returns the level of every line written to buf.
+func levels(t *testing.T, buf *bytes.Buffer) []string {
+	t.Helper()
+	var levels []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		_, js, _ := strings.Cut(line, "] ")
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(js), &m); err != nil {
+			t.Fatalf("invalid line %s: %v", line, err)
+		}
+		levels = append(levels, m["level"].(string))
+	}
+	return levels
+}
+
+func TestFrom(t *testing.T) {
+	notFound := New(USER_NOT_FOUND)
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCode
+	}{
+		{"error", notFound, USER_NOT_FOUND},
+		{"wrapped error", fmt.Errorf("finding user: %w", notFound), USER_NOT_FOUND},
+		{"validation", &gsvalidation.HttpSuggestionError{Status: http.StatusRequestEntityTooLarge}, REQUEST_TOO_LARGE},
+		{"canceled", fmt.Errorf("reading: %w", context.Canceled), REQUEST_CANCELED},
+		{"deadline", context.DeadlineExceeded, REQUEST_TIMEOUT},
+		{"other", stderrors.New("boom"), INTERNAL_SERVER_ERROR},
+	}
+	for _, tt := range tests {
+		got := From(tt.err)
+		if got.Code != tt.want {
+			t.Errorf("%s: From = %s, want %s", tt.name, got.Label, New(tt.want).Label)
+		}
+		if tt.want == INTERNAL_SERVER_ERROR && !stderrors.Is(got, tt.err) {
+			t.Errorf("%s: From doesn't wrap the error", tt.name)
+		}
+	}
+	if From(notFound) != notFound {
+		t.Error("From doesn't return an Error as is")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	gsrender.Register(ProblemJSONEncoder)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		level  string
+	}{
+		{"client error", New(USER_NOT_FOUND), http.StatusNotFound, "WARN"},
+		{"validation", &gsvalidation.HttpSuggestionError{Status: http.StatusBadRequest, Message: "bad JSON"}, http.StatusBadRequest, "WARN"},
+		{"server error", stderrors.New("boom"), http.StatusInternalServerError, "ERROR"},
+		{"bad gateway", New(EXTERNAL_API_ERROR), http.StatusBadGateway, "ERROR"},
+		{"unknown status", &Error{Code: 42}, http.StatusInternalServerError, "ERROR"},
+		{"deadline", fmt.Errorf("calling API: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, "ERROR"},
+	}
+	for _, tt := range tests {
+		buf := logLines(t)
+		w := httptest.NewRecorder()
+		Handle(w, httptest.NewRequest(http.MethodGet, "/users/7", nil), tt.err)
+
+		if w.Code != tt.status || w.Header().Get("Content-Type") != PROBLEM_JSON {
+			t.Errorf("%s: response = %d %s, want %d %s", tt.name, w.Code, w.Header().Get("Content-Type"), tt.status, PROBLEM_JSON)
+		}
+		var p Problem
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Status != tt.status {
+			t.Errorf("%s: body = %s, want a problem with status %d", tt.name, w.Body.String(), tt.status)
+		}
+		if got := levels(t, buf); len(got) != 1 || got[0] != tt.level {
+			t.Errorf("%s: logged with levels %v, want one %s line", tt.name, got, tt.level)
+		}
+	}
+}
+
+func TestHandleCanceledRequest(t *testing.T) {
+	for _, err := range []error{context.Canceled, New(EXTERNAL_API_ERROR), stderrors.New("broken pipe")} {
+		buf := logLines(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		r := httptest.NewRequest(http.MethodGet, "/users", nil).WithContext(ctx)
+		w := httptest.NewRecorder()
+		Handle(w, r, err)
+
+		if w.Code != STATUS_CLIENT_CLOSED_REQUEST || w.Body.Len() != 0 {
+			t.Errorf("%v: response = %d %q, want only 499", err, w.Code, w.Body.String())
+		}
+		if got := levels(t, buf); len(got) != 1 || got[0] != "WARN" {
+			t.Errorf("%v: logged with levels %v, want one WARN line", err, got)
+		}
+	}
+}
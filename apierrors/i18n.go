@@ -0,0 +1,300 @@
+package apierrors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"golang.org/x/text/language"
+)
+
+// defaultCatalogPath is the directory the catalogs are read from if none is
+// configured.
+const defaultCatalogPath = "./resources/i18n"
+
+// I18nConfig contains the configuration properties of the localization of
+// the errors written to the client. If no language is configured, errors are
+// written with the messages of apierrors.errors, in English.
+type I18nConfig struct {
+
+	// Path is the directory with the catalogs, one file per language named
+	// <language>.json (for example, es.json). If not set,
+	// defaultCatalogPath is used.
+	Path            *string  `json:"path"`
+
+	// Languages are the languages errors can be written in, as BCP 47 tags
+	// (for example, es or en-US). Each must have a catalog with a message for
+	// every error code.
+	Languages       []string `json:"languages"`
+
+	// DefaultLanguage is the language used when the request has no
+	// Accept-Language header or accepts none of the configured languages. If
+	// not set, the first language is used.
+	DefaultLanguage *string  `json:"default_language"`
+}
+
+// Catalog contains the messages of a language.
+//
+// Messages are templates (see text/template) executed with the parameters of
+// the error (see Error.WithParam) or, for validations, with the field and the
+// parameter of the rule failed, for example:
+//
+//	{
+//	  "errors": {
+//	    "USER_NOT_FOUND": {"title": "Usuario no encontrado", "message": "No existe el usuario {{.user_id}}"}
+//	  },
+//	  "validations": {
+//	    "required": "El campo {{.field}} es obligatorio",
+//	    "lte": "El campo {{.field}} debe ser menor o igual a {{.param}}"
+//	  }
+//	}
+type Catalog struct {
+
+	// Errors has the title and message of each error code, by label.
+	Errors      map[string]CatalogMessage `json:"errors"`
+
+	// Validations has the message of each field validation failed, by rule
+	// (see gsvalidation.FieldError). Rules without a message are written in
+	// English.
+	Validations map[string]string         `json:"validations"`
+
+	// templates are the parsed messages, by label or "validation:" + rule.
+	templates   map[string]*template.Template
+}
+
+// CatalogMessage contains the title and message of an error code.
+type CatalogMessage struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// I18n contains the catalogs of the configured languages, read by NewI18n. A
+// nil *I18n disables the localization.
+type I18n struct {
+
+	// matcher picks the configured language for a request. The default
+	// language is the first one.
+	matcher  language.Matcher
+
+	// tags are the configured languages, the default first.
+	tags     []language.Tag
+
+	// catalogs are the catalogs of the configured languages, in the order of
+	// tags.
+	catalogs []*Catalog
+}
+
+// i18n contains the current *I18n, or nil if localization is disabled.
+var i18n atomic.Value
+
+// CatalogPath returns the directory the catalogs are read from.
+func (c I18nConfig) CatalogPath() string {
+	if c.Path != nil {
+		return *c.Path
+	}
+	return defaultCatalogPath
+}
+
+// ReadCatalog reads and parses the catalog of the given language from the
+// directory.
+func ReadCatalog(dir string, lang string) (*Catalog, error) {
+	file := filepath.Join(dir, lang+".json")
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading catalog: %s", err.Error())
+	}
+	var c Catalog
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("error parsing catalog %s: %s", file, err.Error())
+	}
+	c.templates = make(map[string]*template.Template)
+	for label, m := range c.Errors {
+		if t, err := newTemplate(label, m.Message); err == nil {
+			c.templates[label] = t
+		}
+	}
+	for rule, m := range c.Validations {
+		if t, err := newTemplate(rule, m); err == nil {
+			c.templates["validation:"+rule] = t
+		}
+	}
+	return &c, nil
+}
+
+// Check returns the problems of the catalog: error codes without a title or
+// a message and messages which are not valid templates.
+func (c *Catalog) Check() []string {
+	var problems []string
+	for _, em := range errors {
+		m, ok := c.Errors[em.Label]
+		switch {
+		case !ok || m.Message == "":
+			problems = append(problems, fmt.Sprintf("no message for %s", em.Label))
+		case c.templates[em.Label] == nil:
+			_, err := newTemplate(em.Label, m.Message)
+			problems = append(problems, fmt.Sprintf("invalid message for %s: %s", em.Label, err.Error()))
+		}
+		if ok && m.Title == "" {
+			problems = append(problems, fmt.Sprintf("no title for %s", em.Label))
+		}
+	}
+	for rule, m := range c.Validations {
+		if _, err := newTemplate(rule, m); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid message for validation %s: %s", rule, err.Error()))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// ConfigureI18n reads the catalogs of the configured languages and makes them
+// current (see NewI18n and SetI18n). If any can't be read or is incomplete,
+// an error is returned and the current ones are kept.
+func ConfigureI18n(c I18nConfig) error {
+	s, err := NewI18n(c)
+	if err != nil {
+		return err
+	}
+	SetI18n(s)
+	return nil
+}
+
+// NewI18n reads the catalogs of the configured languages, without making them
+// current, so that they can be prepared along with the rest of the
+// configuration and only applied if all of it is valid. Returns an error if
+// any can't be read or is incomplete (see Catalog.Check), and nil if no
+// language is configured.
+func NewI18n(c I18nConfig) (*I18n, error) {
+	if len(c.Languages) == 0 {
+		return nil, nil
+	}
+
+	langs := append([]string(nil), c.Languages...)
+	if c.DefaultLanguage != nil {
+		for i, l := range langs {
+			if l == *c.DefaultLanguage {
+				langs[0], langs[i] = langs[i], langs[0]
+				break
+			}
+		}
+	}
+
+	s := &I18n{}
+	for _, l := range langs {
+		tag, err := language.Parse(l)
+		if err != nil {
+			return nil, fmt.Errorf("invalid language %s: %s", l, err.Error())
+		}
+		catalog, err := ReadCatalog(c.CatalogPath(), l)
+		if err != nil {
+			return nil, err
+		}
+		if problems := catalog.Check(); len(problems) > 0 {
+			return nil, fmt.Errorf("incomplete catalog for %s: %s", l, strings.Join(problems, "; "))
+		}
+		s.tags = append(s.tags, tag)
+		s.catalogs = append(s.catalogs, catalog)
+	}
+	s.matcher = language.NewMatcher(s.tags)
+	return s, nil
+}
+
+// SetI18n makes the given catalogs current. If s is nil, the localization is
+// disabled.
+func SetI18n(s *I18n) {
+	i18n.Store(s)
+}
+
+// currentI18n returns the current settings, or nil if localization is
+// disabled.
+func currentI18n() *I18n {
+	s, _ := i18n.Load().(*I18n)
+	return s
+}
+
+// localizer writes the messages of a request in its language.
+type localizer struct {
+
+	// tag is the language.
+	tag     language.Tag
+
+	// catalog has the messages of the language, or is nil if localization is
+	// disabled.
+	catalog *Catalog
+}
+
+// localizerFor returns the localizer of the language that best matches the
+// Accept-Language header of the request.
+func localizerFor(r *http.Request) localizer {
+	s := currentI18n()
+	if s == nil {
+		return localizer{tag: language.English}
+	}
+	tags, _, _ := language.ParseAcceptLanguage(r.Header.Get("Accept-Language"))
+	_, i, _ := s.matcher.Match(tags...)
+	return localizer{tag: s.tags[i], catalog: s.catalogs[i]}
+}
+
+// errorMessage returns the title and message of the error in the language.
+// Errors created with a specific message (see NewWithMsg) keep it, as it's not
+// in the catalog. If the message can't be executed (for example, because of a
+// missing parameter), the English one is returned.
+func (l localizer) errorMessage(e *Error) (string, string) {
+	if l.catalog == nil {
+		return e.Title, e.Message
+	}
+	m, ok := l.catalog.Errors[e.Label]
+	if !ok {
+		return e.Title, e.Message
+	}
+	if e.customMessage {
+		return m.Title, e.Message
+	}
+	message, err := execute(l.catalog.templates[e.Label], e.Params)
+	if err != nil {
+		return m.Title, e.Message
+	}
+	return m.Title, message
+}
+
+// fieldMessage returns the message of the field error in the language, or its
+// English one if the catalog has none for the rule.
+func (l localizer) fieldMessage(fe FieldError) string {
+	if l.catalog == nil {
+		return fe.Message
+	}
+	t := l.catalog.templates["validation:"+fe.Rule]
+	if t == nil {
+		return fe.Message
+	}
+	message, err := execute(t, map[string]interface{}{"field": fe.Field, "param": fe.Param})
+	if err != nil {
+		return fe.Message
+	}
+	return message
+}
+
+// newTemplate parses a message. Executing it fails if a parameter referenced
+// is missing.
+func newTemplate(name string, message string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(message)
+}
+
+// execute executes the template with the given parameters.
+func execute(t *template.Template, params map[string]interface{}) (string, error) {
+	if t == nil {
+		return "", fmt.Errorf("no template")
+	}
+	var sb strings.Builder
+	err := t.Execute(&sb, params)
+	return sb.String(), err
+}
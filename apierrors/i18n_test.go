@@ -0,0 +1,209 @@
+package apierrors
+
+import (
+	"encoding/json"
+	"goserver/utils/gsvalidation"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeCatalog writes the catalog of the given language in dir, with a title
+// and a message for every error code prefixed with the language, replaced by
+// the given ones.
+func writeCatalog(t *testing.T, dir string, lang string, messages map[string]CatalogMessage, validations map[string]string) {
+	t.Helper()
+	c := Catalog{Errors: map[string]CatalogMessage{}, Validations: validations}
+	for _, em := range errors {
+		c.Errors[em.Label] = CatalogMessage{Title: lang + " " + em.Title, Message: lang + " " + em.Message}
+	}
+	for label, m := range messages {
+		c.Errors[label] = m
+	}
+	b, _ := json.Marshal(c)
+	if err := os.WriteFile(filepath.Join(dir, lang+".json"), b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// configureI18n configures the localization with Spanish catalogs, the
+// default, and French ones.
+func configureI18n(t *testing.T) {
+	dir := t.TempDir()
+	writeCatalog(t, dir, "es", map[string]CatalogMessage{
+		"USER_NOT_FOUND": {Title: "Usuario no encontrado", Message: "No existe el usuario {{.user_id}}"},
+	}, map[string]string{"lte": "El campo {{.field}} debe ser menor o igual a {{.param}}"})
+	writeCatalog(t, dir, "fr", nil, nil)
+
+	def := "es"
+	if err := ConfigureI18n(I18nConfig{Path: &dir, Languages: []string{"fr", "es"}, DefaultLanguage: &def}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { SetI18n(nil) })
+}
+
+// problemFor returns the problem of the error written to a request with the
+// given Accept-Language header, and the Content-Language of the response.
+func problemFor(t *testing.T, e *Error, acceptLanguage string) (Problem, string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/users/7", nil)
+	if acceptLanguage != "" {
+		r.Header.Set("Accept-Language", acceptLanguage)
+	}
+	w := httptest.NewRecorder()
+	Write(w, r, e)
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid body %s: %v", w.Body.String(), err)
+	}
+	return p, w.Header().Get("Content-Language")
+}
+
+func TestLocalizationMatchesAcceptLanguage(t *testing.T) {
+	configureI18n(t)
+
+	tests := []struct {
+		acceptLanguage string
+		language       string
+	}{
+		{"", "es"},
+		{"fr", "fr"},
+		{"fr-CA, en;q=0.5", "fr"},
+		{"de, fr;q=0.8, es;q=0.9", "es"},
+		{"en-US, en;q=0.9", "es"},
+		{"es-AR", "es"},
+		{"not a language", "es"},
+	}
+	for _, tt := range tests {
+		p, contentLanguage := problemFor(t, New(INVALID_ARGUMENT), tt.acceptLanguage)
+		want := tt.language + " " + New(INVALID_ARGUMENT).Message
+		if p.Detail != want || p.Title != tt.language+" Invalid argument" {
+			t.Errorf("Accept-Language %q: problem = %q / %q, want it in %s", tt.acceptLanguage, p.Title, p.Detail, tt.language)
+		}
+		if len(contentLanguage) < 2 || contentLanguage[:2] != tt.language {
+			t.Errorf("Accept-Language %q: Content-Language = %q, want %s", tt.acceptLanguage, contentLanguage, tt.language)
+		}
+	}
+}
+
+func TestLocalizationExecutesParams(t *testing.T) {
+	configureI18n(t)
+
+	p, _ := problemFor(t, New(USER_NOT_FOUND).WithParam("user_id", 7), "es")
+	if p.Title != "Usuario no encontrado" || p.Detail != "No existe el usuario 7" {
+		t.Errorf("problem = %q / %q, want the message with the user ID", p.Title, p.Detail)
+	}
+}
+
+func TestLocalizationFallsBackToEnglish(t *testing.T) {
+	configureI18n(t)
+
+	// The parameter of the message is missing.
+	p, _ := problemFor(t, New(USER_NOT_FOUND), "es")
+	if p.Title != "Usuario no encontrado" || p.Detail != "User could not be found" {
+		t.Errorf("problem = %q / %q, want the English message", p.Title, p.Detail)
+	}
+
+	// Custom messages are not in the catalog.
+	p, _ = problemFor(t, NewWithMsg(INVALID_ARGUMENT, "id must be a number"), "es")
+	if p.Title != "es Invalid argument" || p.Detail != "id must be a number" {
+		t.Errorf("problem = %q / %q, want the custom message", p.Title, p.Detail)
+	}
+}
+
+func TestLocalizationOfFieldErrors(t *testing.T) {
+	configureI18n(t)
+
+	e := FromValidation(&gsvalidation.HttpSuggestionError{
+		Status: http.StatusBadRequest,
+		Errors: []gsvalidation.FieldError{
+			{Field: "age", Message: "age must be 130 or less", Rule: "lte", Param: "130"},
+			{Field: "name", Message: "name is required", Rule: "required"},
+		},
+	})
+	p, _ := problemFor(t, e, "es")
+	want := []FieldError{
+		{Field: "age", Message: "El campo age debe ser menor o igual a 130"},
+		{Field: "name", Message: "name is required"},
+	}
+	if !reflect.DeepEqual(p.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", p.Errors, want)
+	}
+}
+
+func TestLocalizationDisabled(t *testing.T) {
+	SetI18n(nil)
+	p, contentLanguage := problemFor(t, New(USER_NOT_FOUND).WithParam("user_id", 7), "es")
+	if p.Title != "User not found" || p.Detail != "User could not be found" || contentLanguage != "" {
+		t.Errorf("problem = %q / %q (%q), want the English one", p.Title, p.Detail, contentLanguage)
+	}
+}
+
+func TestCatalogCheck(t *testing.T) {
+	dir := t.TempDir()
+	writeCatalog(t, dir, "es", map[string]CatalogMessage{
+		"USER_NOT_FOUND":     {Title: "", Message: "No existe el usuario {{.user_id}}"},
+		"EXTERNAL_API_ERROR": {Title: "Error externo", Message: ""},
+		"INVALID_ARGUMENT":   {Title: "Argumento inválido", Message: "Argumento {{.name"},
+	}, map[string]string{"lte": "{{if}}", "required": "El campo {{.field}} es obligatorio"})
+	c, err := ReadCatalog(dir, "es")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	delete(c.Errors, "REQUEST_TIMEOUT")
+
+	got := c.Check()
+	want := []string{
+		"invalid message for INVALID_ARGUMENT: ",
+		"invalid message for validation lte: ",
+		"no message for EXTERNAL_API_ERROR",
+		"no message for REQUEST_TIMEOUT",
+		"no title for USER_NOT_FOUND",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("problems = %q, want %q", got, want)
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("problem %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestConfigureI18nKeepsCurrentOnError(t *testing.T) {
+	configureI18n(t)
+
+	dir := t.TempDir()
+	writeCatalog(t, dir, "es", map[string]CatalogMessage{"USER_NOT_FOUND": {Message: "Sin título"}}, nil)
+	err := ConfigureI18n(I18nConfig{Path: &dir, Languages: []string{"es"}})
+	if err == nil || !strings.Contains(err.Error(), "incomplete catalog for es: no title for USER_NOT_FOUND") {
+		t.Fatalf("err = %v, want the catalog reported as incomplete", err)
+	}
+	if _, err := NewI18n(I18nConfig{Path: &dir, Languages: []string{"de"}}); err == nil {
+		t.Error("expected an error for a missing catalog")
+	}
+	if _, err := NewI18n(I18nConfig{Path: &dir, Languages: []string{"!!"}}); err == nil {
+		t.Error("expected an error for an invalid language")
+	}
+
+	p, _ := problemFor(t, New(USER_NOT_FOUND).WithParam("user_id", 7), "es")
+	if p.Detail != "No existe el usuario 7" {
+		t.Errorf("detail = %q, want the one of the catalogs configured before", p.Detail)
+	}
+}
+
+func TestShippedCatalogsAreComplete(t *testing.T) {
+	for _, lang := range []string{"en", "es"} {
+		c, err := ReadCatalog("../resources/i18n", lang)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if problems := c.Check(); len(problems) > 0 {
+			t.Errorf("catalog %s: %q", lang, problems)
+		}
+	}
+}
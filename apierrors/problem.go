@@ -0,0 +1,110 @@
+package apierrors
+
+import (
+	"encoding/xml"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gsrender"
+	"goserver/utils/gstrace"
+	"net/http"
+)
+
+// PROBLEM_JSON is the media type of the errors written by Write, as defined
+// by RFC 7807.
+const PROBLEM_JSON = "application/problem+json"
+
+// Problem is the representation of an Error answered to the client, following
+// RFC 7807 (Problem Details for HTTP APIs). Besides the standard members, it
+// has the code and label of the error, the trace ID of the request and the
+// fields failing validation, if any.
+type Problem struct {
+	XMLName  xml.Name     `json:"-" xml:"urn:ietf:rfc:7807 problem"`
+
+	// Type is the URI identifying the error code.
+	Type     string       `json:"type" xml:"type"`
+
+	// Title is the summary of the error code.
+	Title    string       `json:"title" xml:"title"`
+
+	// Status is the http status of the response.
+	Status   int          `json:"status" xml:"status"`
+
+	// Detail is the message of this occurrence of the error.
+	Detail   string       `json:"detail,omitempty" xml:"detail,omitempty"`
+
+	// Instance is the path of the request.
+	Instance string       `json:"instance,omitempty" xml:"instance,omitempty"`
+
+	// Code is the error code (see ErrorCode).
+	Code     ErrorCode    `json:"code" xml:"code"`
+
+	// Label is the label of the error code.
+	Label    string       `json:"label" xml:"label"`
+
+	// TraceID is the trace ID of the request.
+	TraceID  string       `json:"trace_id,omitempty" xml:"trace_id,omitempty"`
+
+	// Errors has one entry per field of the request failing validation.
+	Errors   []FieldError `json:"errors,omitempty" xml:"error,omitempty"`
+}
+
+// ProblemJSONEncoder writes values as application/problem+json, with the JSON
+// encoder. Once registered (see gsrender.Register), Write prefers it.
+var ProblemJSONEncoder = &gsrender.Encoder{
+	MediaTypes:  []string{PROBLEM_JSON},
+	ContentType: PROBLEM_JSON,
+	Marshal:     gsrender.JSONEncoder.Marshal,
+}
+
+// Problem returns the representation of the error answered to the given
+// request, with its title and messages in the language accepted by the client
+// (see I18nConfig).
+func (e *Error) Problem(r *http.Request) *Problem {
+	return e.problem(r, localizerFor(r))
+}
+
+// problem returns the representation of the error answered to the request,
+// in the language of the localizer.
+func (e *Error) problem(r *http.Request, l localizer) *Problem {
+	status := e.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	title, detail := l.errorMessage(e)
+	var fieldErrors []FieldError
+	for _, fe := range e.Errors {
+		fe.Message = l.fieldMessage(fe)
+		fieldErrors = append(fieldErrors, fe)
+	}
+	return &Problem{
+		Type:     e.Type,
+		Title:    title,
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Code:     e.Code,
+		Label:    e.Label,
+		TraceID:  gsmiddleware.GetTraceID(r.Context()),
+		Errors:   fieldErrors,
+	}
+}
+
+// NotAcceptable returns the problem written when the client doesn't accept any
+// format the response can be written in (see gsrender.SetNotAcceptable).
+func NotAcceptable(r *http.Request) interface{} {
+	return New(NOT_ACCEPTABLE).Problem(r)
+}
+
+// Write answers the request with the error, with the status of its code and
+// in the language accepted by the client (see I18nConfig). It's written as
+// application/problem+json, unless the client accepts other formats only (see
+// gsrender.Negotiate). The error code is recorded in the span of the request.
+func Write(w http.ResponseWriter, r *http.Request, e *Error) {
+	gstrace.RecordErrorCode(r.Context(), int(e.Code), e.Label, e.Message)
+	l := localizerFor(r)
+	if l.catalog != nil {
+		w.Header().Set("Content-Language", l.tag.String())
+		gsrender.AddVary(w.Header(), "Accept-Language")
+	}
+	p := e.problem(r, l)
+	gsrender.Negotiate(w, r, uint(p.Status), p, PROBLEM_JSON)
+}
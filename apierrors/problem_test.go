@@ -0,0 +1,114 @@
+package apierrors
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gsrender"
+	"goserver/utils/gsvalidation"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// tracedRequest returns a request to the given path with the trace ID
+// trace-1 in its context.
+func tracedRequest(method string, path string) *http.Request {
+	r := httptest.NewRequest(method, path, nil)
+	return r.WithContext(context.WithValue(r.Context(), gsmiddleware.TraceIDKey, "trace-1"))
+}
+
+func TestProblem(t *testing.T) {
+	e := FromValidation(&gsvalidation.HttpSuggestionError{
+		Status: http.StatusBadRequest,
+		Errors: []gsvalidation.FieldError{{Field: "age", Message: "age must be 130 or less", Rule: "lte", Param: "130"}},
+	})
+	e.Internal = "never written"
+	e.WithDetail("secret", "never written either")
+
+	got := e.Problem(tracedRequest(http.MethodPost, "/go-server/v1/users?dry=true"))
+	want := &Problem{
+		Type:     "urn:goserver:problem:invalid-argument",
+		Title:    "Invalid argument",
+		Status:   http.StatusBadRequest,
+		Detail:   "Client specified invalid request parameter",
+		Instance: "/go-server/v1/users",
+		Code:     INVALID_ARGUMENT,
+		Label:    "INVALID_ARGUMENT",
+		TraceID:  "trace-1",
+		Errors:   []FieldError{{Field: "age", Message: "age must be 130 or less", Rule: "lte", Param: "130"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Problem =\n%+v\nwant\n%+v", got, want)
+	}
+
+	b, _ := json.Marshal(got)
+	wantJSON := `{"type":"urn:goserver:problem:invalid-argument","title":"Invalid argument","status":400,` +
+		`"detail":"Client specified invalid request parameter","instance":"/go-server/v1/users","code":2002,` +
+		`"label":"INVALID_ARGUMENT","trace_id":"trace-1","errors":[{"field":"age","message":"age must be 130 or less"}]}`
+	if string(b) != wantJSON {
+		t.Errorf("JSON =\n%s\nwant\n%s", b, wantJSON)
+	}
+}
+
+func TestProblemOmitsEmptyMembers(t *testing.T) {
+	b, _ := json.Marshal(NewWithMsg(ERR_NOT_DEFINED, "").Problem(httptest.NewRequest(http.MethodGet, "/", nil)))
+	want := `{"type":"urn:goserver:problem:err-not-defined","title":"Unrecognized error","status":500,"instance":"/","code":-1,"label":"ERR_NOT_DEFINED"}`
+	if string(b) != want {
+		t.Errorf("JSON =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestProblemOfUnknownCode(t *testing.T) {
+	p := (&Error{Code: 42}).Problem(httptest.NewRequest(http.MethodGet, "/", nil))
+	if p.Status != http.StatusInternalServerError || p.Code != 42 {
+		t.Errorf("Problem = %+v, want a 500 with the code", p)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	gsrender.Register(ProblemJSONEncoder)
+
+	w := httptest.NewRecorder()
+	Write(w, tracedRequest(http.MethodGet, "/users/7"), New(USER_NOT_FOUND).WithParam("user_id", 7))
+
+	if w.Code != http.StatusNotFound || w.Header().Get("Content-Type") != PROBLEM_JSON {
+		t.Fatalf("response = %d %s, want 404 %s", w.Code, w.Header().Get("Content-Type"), PROBLEM_JSON)
+	}
+	if w.Header().Get("Content-Language") != "" {
+		t.Errorf("Content-Language = %s without localization", w.Header().Get("Content-Language"))
+	}
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid body %s: %v", w.Body.String(), err)
+	}
+	if p.Status != http.StatusNotFound || p.Label != "USER_NOT_FOUND" || p.Instance != "/users/7" || p.TraceID != "trace-1" {
+		t.Errorf("body = %+v, want the USER_NOT_FOUND problem", p)
+	}
+}
+
+func TestWriteNegotiatesFormat(t *testing.T) {
+	gsrender.Register(ProblemJSONEncoder)
+
+	r := tracedRequest(http.MethodGet, "/users")
+	r.Header.Set("Accept", "application/xml")
+	w := httptest.NewRecorder()
+	Write(w, r, New(DEPENDENCY_UNAVAILABLE))
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Content-Type") != gsrender.XMLEncoder.ContentType {
+		t.Fatalf("response = %d %s, want 503 %s", w.Code, w.Header().Get("Content-Type"), gsrender.XMLEncoder.ContentType)
+	}
+	var p Problem
+	if err := xml.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Code != DEPENDENCY_UNAVAILABLE {
+		t.Errorf("body = %s (%v), want the XML problem", w.Body.String(), err)
+	}
+}
+
+func TestNotAcceptable(t *testing.T) {
+	p, ok := NotAcceptable(httptest.NewRequest(http.MethodGet, "/users", nil)).(*Problem)
+	if !ok || p.Status != http.StatusNotAcceptable || p.Code != NOT_ACCEPTABLE {
+		t.Errorf("NotAcceptable = %+v, want the NOT_ACCEPTABLE problem", p)
+	}
+}
@@ -0,0 +1,111 @@
+package apierrors
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// maxStackDepth is the maximum number of frames captured by WithStack.
+const maxStackDepth = 32
+
+// Wrap returns an Error with the given code wrapping cause, so that the
+// origin of the error is kept (and logged) while the client only gets the
+// public message of the code. msg is the internal message (see
+// Error.Internal), describing what was being done when cause happened.
+//
+// The returned Error unwraps to cause, so errors.Is and errors.As reach it.
+func Wrap(ec ErrorCode, cause error, msg string) *Error {
+	e := New(ec)
+	e.Internal = msg
+	e.cause = cause
+	return e
+}
+
+// Unwrap returns the error wrapped, if any.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports whether target is an Error with the same code, so that
+// errors.Is(err, apierrors.New(apierrors.USER_NOT_FOUND)) holds for any
+// USER_NOT_FOUND in the chain of err.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetail adds a key/value pair to the details of the error, logged with
+// it. Returns the same error, so calls can be chained.
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// WithStack captures the call stack of its caller, logged with the error.
+// Returns the same error, so calls can be chained.
+func (e *Error) WithStack() *Error {
+	pcs := make([]uintptr, maxStackDepth)
+	n := runtime.Callers(2, pcs)
+	e.stack = pcs[:n]
+	return e
+}
+
+// StackTrace returns the call stack captured by WithStack, one function per
+// line followed by its file and line, or an empty string if none was.
+func (e *Error) StackTrace() string {
+	if len(e.stack) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&sb, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// LogFields returns the fields logged with the error (see gslog.ErrorFrom):
+// its code and label, its details and its stack, if captured. Details of the
+// errors wrapped are included as well, the outermost ones taking precedence,
+// while the stack is the innermost one captured, the closest to the origin.
+func (e *Error) LogFields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"error_code":  e.Code,
+		"error_label": e.Label,
+	}
+	details := map[string]interface{}{}
+	stack := ""
+	var err error = e
+	for err != nil {
+		if ae, ok := err.(*Error); ok {
+			for k, v := range ae.Details {
+				if _, ok := details[k]; !ok {
+					details[k] = v
+				}
+			}
+			if s := ae.StackTrace(); s != "" {
+				stack = s
+			}
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			break
+		}
+		err = u.Unwrap()
+	}
+	if len(details) > 0 {
+		fields["details"] = details
+	}
+	if stack != "" {
+		fields["stack"] = stack
+	}
+	return fields
+}
@@ -0,0 +1,118 @@
+package apierrors
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	stderrors "errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWrapUnwrapsToCause(t *testing.T) {
+	cause := &fs.PathError{Op: "open", Path: "config.json", Err: fs.ErrNotExist}
+	inner := Wrap(IO_FILE_ERROR, cause, "reading configuration")
+	outer := Wrap(INTERNAL_SERVER_ERROR, inner, "starting")
+
+	if !stderrors.Is(outer, fs.ErrNotExist) {
+		t.Error("errors.Is doesn't reach the cause")
+	}
+	var pathErr *fs.PathError
+	if !stderrors.As(outer, &pathErr) || pathErr.Path != "config.json" {
+		t.Errorf("errors.As = %v, want the *fs.PathError", pathErr)
+	}
+	var apiErr *Error
+	if !stderrors.As(outer, &apiErr) || apiErr != outer {
+		t.Errorf("errors.As = %v, want the outermost Error", apiErr)
+	}
+	if outer.Unwrap() != inner || New(INVALID_ARGUMENT).Unwrap() != nil {
+		t.Error("Unwrap doesn't return the error wrapped")
+	}
+	want := "[5001] INTERNAL_SERVER_ERROR: Internal error found. Please contact support team (starting): " +
+		"[5002] IO_FILE_ERROR: Input/Output error while reading a file (reading configuration): open config.json: file does not exist"
+	if outer.Error() != want {
+		t.Errorf("Error() =\n%s\nwant\n%s", outer.Error(), want)
+	}
+}
+
+func TestIsMatchesCode(t *testing.T) {
+	err := Wrap(EXTERNAL_API_ERROR, NewWithMsg(USER_NOT_FOUND, "custom message").WithParam("user_id", 7), "finding user")
+
+	if !stderrors.Is(err, New(USER_NOT_FOUND)) {
+		t.Error("errors.Is doesn't match the code wrapped")
+	}
+	if !stderrors.Is(err, New(EXTERNAL_API_ERROR)) {
+		t.Error("errors.Is doesn't match the outermost code")
+	}
+	if stderrors.Is(err, New(INVALID_ARGUMENT)) {
+		t.Error("errors.Is matches a code not in the chain")
+	}
+	if New(USER_NOT_FOUND).Is(stderrors.New("USER_NOT_FOUND")) {
+		t.Error("Is matches an error which is not an Error")
+	}
+}
+
+func TestInternalAndDetailsAreNotWritten(t *testing.T) {
+	e := Wrap(INTERNAL_SERVER_ERROR, stderrors.New("db password rejected"), "connecting to db secret-host").
+		WithDetail("host", "secret-host").
+		WithStack()
+	p := e.Problem(httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	encoded := map[string]func(interface{}) ([]byte, error){
+		"problem JSON": json.Marshal,
+		"problem XML":  xml.Marshal,
+		"error JSON":   func(interface{}) ([]byte, error) { return json.Marshal(e) },
+		"error XML":    func(interface{}) ([]byte, error) { return xml.Marshal(e) },
+	}
+	for name, marshal := range encoded {
+		b, err := marshal(p)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		for _, secret := range []string{"secret-host", "password", "stack", "wrap_test.go"} {
+			if strings.Contains(string(b), secret) {
+				t.Errorf("%s %s contains %q", name, b, secret)
+			}
+		}
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	origin := New(IO_FILE_ERROR).WithDetail("file", "users.json").WithDetail("attempt", 1).WithStack()
+	middle := Wrap(INTERNAL_SERVER_ERROR, origin, "loading users").WithDetail("attempt", 2).WithStack()
+	outer := Wrap(EXTERNAL_API_ERROR, middle, "finding users").WithDetail("user_id", 7)
+
+	fields := outer.LogFields()
+	if fields["error_code"] != EXTERNAL_API_ERROR || fields["error_label"] != "EXTERNAL_API_ERROR" {
+		t.Errorf("code = %v %v, want the outermost one", fields["error_code"], fields["error_label"])
+	}
+	details, _ := fields["details"].(map[string]interface{})
+	if len(details) != 3 || details["file"] != "users.json" || details["attempt"] != 2 || details["user_id"] != 7 {
+		t.Errorf("details = %v, want every one, the outermost taking precedence", details)
+	}
+	if fields["stack"] != origin.StackTrace() || middle.StackTrace() == origin.StackTrace() {
+		t.Errorf("stack =\n%v\nwant the innermost one", fields["stack"])
+	}
+}
+
+func TestLogFieldsWithoutDetailsNorStack(t *testing.T) {
+	fields := Wrap(INTERNAL_SERVER_ERROR, stderrors.New("boom"), "doing something").LogFields()
+	if _, ok := fields["details"]; ok {
+		t.Errorf("fields = %v, want no details", fields)
+	}
+	if _, ok := fields["stack"]; ok {
+		t.Errorf("fields = %v, want no stack", fields)
+	}
+}
+
+func TestStackTrace(t *testing.T) {
+	if s := New(INTERNAL_SERVER_ERROR).StackTrace(); s != "" {
+		t.Errorf("StackTrace = %q without WithStack", s)
+	}
+	s := New(INTERNAL_SERVER_ERROR).WithStack().StackTrace()
+	if !strings.HasPrefix(s, "goserver/apierrors.TestStackTrace\n\t") || !strings.Contains(s, "wrap_test.go:") {
+		t.Errorf("StackTrace =\n%s\nwant it to start at its caller", s)
+	}
+}
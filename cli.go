@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"goserver/config"
+	"goserver/utils/gslog"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Build information, set at build time with:
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+// usage is printed when the command line can't be understood.
+const usage = `Usage: goserver <command> [flags]
+
+Commands:
+  serve            start the server
+                     --config <path>     configuration file (default ` + defaultConfigFile + `)
+                     --addr <host:port>  address to listen on
+                     --log-level <level> DEBUG, INFO, WARN or ERROR
+  config validate  validate the configuration file and exit
+                     --config <path>
+  config print     print the effective configuration, with secrets redacted
+                     --config <path>
+  routes           list every route of the server
+  version          print the build information
+`
+
+// runCommand runs the command given in the arguments and returns the exit
+// code of the program.
+func runCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "serve":
+		return serve(args[1:])
+	case "config":
+		if len(args) > 1 {
+			switch args[1] {
+			case "validate":
+				return validateConfig(args[2:])
+			case "print":
+				return printConfig(args[2:])
+			}
+		}
+	case "routes":
+		return printRoutes(os.Stdout)
+	case "version":
+		printVersion(os.Stdout)
+		return 0
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+// parseConfigFlag parses the flags of the config subcommands, which only take
+// the path of the configuration file.
+func parseConfigFlag(name string, args []string) (string, bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFile := fs.String("config", defaultConfigFile, "path of the configuration file (.json, .yaml, .yml or .toml)")
+	if err := fs.Parse(args); err != nil {
+		return "", false
+	}
+	return *configFile, true
+}
+
+// validateConfig runs the whole validation of the configuration file, printing
+// every problem found.
+func validateConfig(args []string) int {
+	configFile, ok := parseConfigFlag("config validate", args)
+	if !ok {
+		return 2
+	}
+	_, err := config.ValidateConfiguration(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	fmt.Printf("Configuration file %s is valid\n", configFile)
+	return 0
+}
+
+// printConfig prints the effective configuration (every layer merged), with
+// secrets redacted.
+func printConfig(args []string) int {
+	configFile, ok := parseConfigFlag("config print", args)
+	if !ok {
+		return 2
+	}
+	conf, err := config.ReadConfiguration(configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	dump, err := conf.DumpRedacted()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+	fmt.Println(string(dump))
+	return 0
+}
+
+// printRoutes writes the method and pattern of every route of the server.
+func printRoutes(w io.Writer) int {
+
+	// Building the router logs its progress, which is not wanted here.
+	gslog.SetOutput(io.Discard)
+	r := newRouter()
+	gslog.SetOutput(os.Stderr)
+
+	// Collect the methods of every route, keeping the routes in order.
+	var routes []string
+	methods := make(map[string][]string)
+	err := chi.Walk(r, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if _, ok := methods[route]; !ok {
+			routes = append(routes, route)
+		}
+		methods[route] = append(methods[route], method)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, route := range routes {
+		ms := methods[route]
+		sort.Strings(ms)
+		// Routes registered with Handle accept every method.
+		if len(ms) >= len(allMethods) {
+			ms = []string{"*"}
+		}
+		for _, m := range ms {
+			fmt.Fprintf(tw, "%s\t%s\n", m, route)
+		}
+	}
+	tw.Flush()
+	return 0
+}
+
+// allMethods are the http methods routed by chi.
+var allMethods = []string{
+	http.MethodConnect, http.MethodDelete, http.MethodGet, http.MethodHead, http.MethodOptions,
+	http.MethodPatch, http.MethodPost, http.MethodPut, http.MethodTrace,
+}
+
+// printVersion writes the build information of the binary.
+func printVersion(w io.Writer) {
+	rev := commit
+	if rev == "unknown" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" {
+					rev = s.Value
+				}
+			}
+		}
+	}
+	fmt.Fprintf(w, "goserver %s\n  commit:     %s\n  built:      %s\n  go version: %s\n", version, rev, buildDate, runtime.Version())
+}
@@ -2,13 +2,10 @@ package mockclient
 
 import (
 	"context"
-	"fmt"
 	"goserver/apierrors"
 	"goserver/config"
 	"goserver/utils/gsclient"
-	"goserver/utils/gsvalidation"
 	"net/http"
-	"strconv"
 )
 
 // errorCDO is the error type returned by this client.
@@ -27,87 +24,65 @@ func GetUsers(ctx context.Context) ([]UserCDO, *apierrors.Error) {
 		return nil, apierrors.New(apierrors.CLIENT_NOT_DEFINED)
 	}
 
-	url := client.Basepath + "/users"
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, client.Basepath + "/users", nil)
-	if err != nil {
-		return nil, apierrors.NewWithMsg(apierrors.INTERNAL_SERVER_ERROR, fmt.Sprintf("Error creating request to call %s: %s", url, err.Error()))
-	}
-	
-	response, err := client.HttpClient.Do(req)
-	if err != nil {
-		return nil, apierrors.NewWithMsg(apierrors.INTERNAL_SERVER_ERROR, fmt.Sprintf("Error found while executing http call: %s", err.Error()))
-	}
-
-	var users []UserCDO
-	var clientErr errorCDO
-
-	respType, err := gsvalidation.DecodeJSONResponseBody(response, &users, &clientErr)
-	switch respType {
-	case gsvalidation.OK_RESPONSE:
-		return users, nil
-	case gsvalidation.ERR_RESPONSE:
-		return nil, apierrors.NewWithMsg(
-			apierrors.EXTERNAL_API_ERROR,
-			fmt.Sprintf("Error received by mock client: code: %s, message: %s", clientErr.Code, clientErr.Message),
-		)
-	default:
-		return nil, apierrors.NewWithMsg(apierrors.RESPONSE_UNMARSHAL_ERROR, fmt.Sprintf("Error unmarshaling response body: %s", err.Error()))
+	users, rerr := gsclient.Get[[]UserCDO, errorCDO](ctx, client, "/users")
+	if rerr != nil {
+		return nil, toAPIError(rerr)
 	}
+	return *users, nil
 }
 
 func PostUser(ctx context.Context, u CreateUserCDO) *apierrors.Error {
-	
-	client, ok := gsclient.GetClient("MockClient")
+
+	client, ok := gsclient.GetClient(string(config.MOCK_CLIENT))
 	if !ok {
 		return apierrors.New(apierrors.CLIENT_NOT_DEFINED)
 	}
 
-	path := "/users"
-	req, err := client.NewJSONRequest(ctx, "POST", path, u)
-	//req, err := http.NewRequestWithContext(ctx, "POST", url, reader)
-	if err != nil {
-		return apierrors.NewWithMsg(apierrors.INTERNAL_SERVER_ERROR, fmt.Sprintf("Error creating request to call %s: %s", path, err.Error()))
+	_, rerr := gsclient.Post[struct{}, errorCDO](ctx, client, "/users", gsclient.WithBody(u))
+	if rerr != nil {
+		return toAPIError(rerr)
 	}
-
-	_, err = client.HttpClient.Do(req)
-	if err != nil {
-		return apierrors.NewWithMsg(apierrors.INTERNAL_SERVER_ERROR, fmt.Sprintf("Error found while executing http call: %s", err.Error()))
-	}
-
 	return nil
 }
 
 func GetUserById(ctx context.Context, id int) (*UserCDO, *apierrors.Error) {
 
-	client, ok := gsclient.GetClient("MockClient")
+	client, ok := gsclient.GetClient(string(config.MOCK_CLIENT))
 	if !ok {
 		return nil, apierrors.New(apierrors.CLIENT_NOT_DEFINED)
 	}
 
-	url := client.Basepath + "/users/" + strconv.Itoa(id)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, apierrors.NewWithMsg(apierrors.INTERNAL_SERVER_ERROR, fmt.Sprintf("Error creating request to call %s: %s", url, err.Error()))
+	user, rerr := gsclient.Get[UserCDO, errorCDO](ctx, client, "/users/{id}", gsclient.WithPathParam("id", id))
+	if rerr != nil && rerr.IsErrorResponse() && rerr.Status == http.StatusNotFound {
+		return nil, apierrors.Wrap(apierrors.USER_NOT_FOUND, rerr, "user not found by mock client").
+			WithParam("user_id", id)
 	}
-
-	response, err := client.HttpClient.Do(req)
-	if err != nil {
-		return nil, apierrors.NewWithMsg(apierrors.INTERNAL_SERVER_ERROR, fmt.Sprintf("Error found while executing http call: %s", err.Error()))
+	if rerr != nil {
+		return nil, toAPIError(rerr)
 	}
+	return user, nil
+}
 
-	var user UserCDO
-	var clientErr errorCDO
-
-	respType, err := gsvalidation.DecodeJSONResponseBody(response, &user, &clientErr)
-	switch respType {
-	case gsvalidation.OK_RESPONSE:
-		return &user, nil
-	case gsvalidation.ERR_RESPONSE:
-		return nil, apierrors.NewWithMsg(
-			apierrors.EXTERNAL_API_ERROR,
-			fmt.Sprintf("Error received by mock client: code: %s, message: %s", clientErr.Code, clientErr.Message),
-		)
+// toAPIError maps an error returned by the mock client's API into an
+// apierrors.Error wrapping it.
+func toAPIError(rerr *gsclient.ResponseError[errorCDO]) *apierrors.Error {
+	switch {
+	case rerr.IsRequestError():
+		return apierrors.Wrap(apierrors.INTERNAL_SERVER_ERROR, rerr.Err, "building request to mock client")
+	case rerr.IsCircuitOpen():
+		return apierrors.Wrap(apierrors.DEPENDENCY_UNAVAILABLE, rerr.Err, "circuit breaker open")
+	case rerr.IsTransportError():
+		return apierrors.FromHttpError(rerr.Err)
+	case rerr.IsErrorResponse() && rerr.Body != nil:
+		return apierrors.Wrap(apierrors.EXTERNAL_API_ERROR, rerr, "error received by mock client").
+			WithDetail("status", rerr.Status).
+			WithDetail("code", rerr.Body.Code).
+			WithDetail("message", rerr.Body.Message)
+	case rerr.IsErrorResponse():
+		return apierrors.Wrap(apierrors.EXTERNAL_API_ERROR, rerr, "error received by mock client").
+			WithDetail("status", rerr.Status)
 	default:
-		return nil, apierrors.NewWithMsg(apierrors.RESPONSE_UNMARSHAL_ERROR, fmt.Sprintf("Error unmarshaling response body: %s", err.Error()))
+		return apierrors.Wrap(apierrors.RESPONSE_UNMARSHAL_ERROR, rerr, "unmarshaling response body").
+			WithDetail("status", rerr.Status)
 	}
-}
\ No newline at end of file
+}
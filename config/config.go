@@ -1,14 +1,29 @@
 package config
 
 import (
-	"encoding/json"
-	"fmt"
+	"goserver/apierrors"
 	"goserver/utils/gsclient"
+	"goserver/utils/gshealth"
 	"goserver/utils/gslog"
-	"os"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gsserver"
+	"goserver/utils/gstrace"
+	"reflect"
+	"sync"
 )
 
-var Conf Config
+// conf is the configuration currently applied. See Current.
+var conf Config
+
+// confMu synchronizes the access to conf, which is replaced on every reload.
+var confMu sync.RWMutex
+
+// applyMu serializes the application of configurations.
+var applyMu sync.Mutex
+
+// healthChecks contains the names of the readiness checks registered by the
+// current configuration.
+var healthChecks []string
 
 type ClientKey string
 
@@ -23,6 +38,11 @@ var clientKeys = []ClientKey{
 type Config struct {
 	Port         int 	                      `json:"port"`
 	Basepath     string                       `json:"basepath"`
+	Server       gsserver.ServerConfig        `json:"server"`
+	Health       gshealth.HealthConfig        `json:"health"`
+	Trace        gsmiddleware.TraceConfig     `json:"trace"`
+	Tracing      gstrace.TracingConfig        `json:"tracing"`
+	I18n         apierrors.I18nConfig         `json:"i18n"`
 	Logger       *gslog.LoggerConfig          `json:"logger"`
 	LogFile      gslog.LogFileConfig          `json:"log_file"`
 	TokenClients []gsclient.ClientConfig      `json:"token_clients"`
@@ -30,58 +50,172 @@ type Config struct {
 	Clients      []gsclient.ClientConfig      `json:"clients"`
 }
 
-func (c *Config) validateClients() error {
-	for _, requiredKey := range clientKeys {
-		found := false
-		for _, client := range c.Clients {
-			if client.Key == string(requiredKey) {
-				found = true
-			}
-		}
-		if !found {
-			return fmt.Errorf("couldn't find required client with key %s in configuration file", string(requiredKey))
-		}
+// ReadConfiguration reads the configuration file, layering on it the overlay
+// file and the environment variable overrides and resolving placeholders (see
+// sources.go), and validates it, without applying it.
+//
+// If the configuration is not valid, the error is a ValidationErrors with
+// every problem found.
+func ReadConfiguration(f string) (*Config, error) {
+
+	// merge every configuration source
+	tree, err := readLayers(f)
+	if err != nil {
+		return nil, err
 	}
-	return nil
-}
 
-func LoadConfiguration(f string) error {
+	return decodeConfiguration(tree)
+}
 
-	// initialize default values
-	var config Config
+// ValidateConfiguration reads the configuration file and checks it can be
+// applied, including the construction of every client and token source, but
+// doesn't apply it.
+func ValidateConfiguration(f string) (*Config, error) {
+	config, err := ReadConfiguration(f)
+	if err != nil {
+		return nil, err
+	}
+	_, err = config.newRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
 
-	// open given file
-	file, err := os.Open(f)
+// LoadConfiguration reads the configuration file and applies it. Meant to be
+// called once, at startup. See ReloadConfiguration to apply later changes.
+func LoadConfiguration(f string) error {
+	config, err := ReadConfiguration(f)
 	if err != nil {
 		return err
 	}
+	return config.apply(true)
+}
 
-	// parse file content as JSON
-	jsonParser := json.NewDecoder(file)
-	err = jsonParser.Decode(&config)
+// ReloadConfiguration reads the configuration file again and applies it. If
+// the new configuration is not valid, an error is returned and the current
+// one is kept as is.
+//
+// The log file, server and port properties are not reloaded: changing them
+// requires a restart.
+func ReloadConfiguration(f string) error {
+	config, err := ReadConfiguration(f)
 	if err != nil {
 		return err
 	}
-
-	if config.Logger != nil {
-		gslog.ConfigureLog(*config.Logger)
+	prev := Current()
+	if config.Port != prev.Port || !reflect.DeepEqual(config.Server, prev.Server) ||
+		!reflect.DeepEqual(config.LogFile, prev.LogFile) {
+		gslog.Warn("Changes in port, server or log_file configuration require a restart to be applied", "")
 	}
-	gslog.ConfigureLogFile(config.LogFile)
-	
-	err = gsclient.ConfigureClients(config.TokenClients)
+	return config.apply(false)
+}
+
+// Current returns the configuration currently applied.
+func Current() Config {
+	confMu.RLock()
+	defer confMu.RUnlock()
+	return conf
+}
+
+// apply configures every package with the given configuration. Everything
+// that can fail is prepared first without being applied (the catalogs, the
+// clients and token sources in a new registry, and the tracer provider), so
+// nothing is changed on error.
+func (c *Config) apply(initial bool) error {
+
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	catalogs, err := apierrors.NewI18n(c.I18n)
 	if err != nil {
 		return err
 	}
 
-	err = gsclient.ConfigureTokenSources(config.TokenSources)
+	reg, err := c.newRegistry()
 	if err != nil {
 		return err
 	}
 
-	err = gsclient.ConfigureClients(config.Clients)
+	// Built last, as it's the only one that must be shut down if unused.
+	tp, err := gstrace.NewProvider(c.Tracing)
 	if err != nil {
 		return err
 	}
 
-	return config.validateClients()
-}
\ No newline at end of file
+	// From here on, nothing can fail.
+	gstrace.SetProvider(tp)
+	apierrors.SetI18n(catalogs)
+
+	logger := gslog.LoggerConfig{}
+	if c.Logger != nil {
+		logger = *c.Logger
+	}
+	gslog.ConfigureLog(logger)
+	if initial {
+		gslog.ConfigureLogFile(c.LogFile)
+	}
+
+	gsmiddleware.ConfigureTrace(c.Trace)
+
+	gsclient.SetRegistry(reg)
+
+	gshealth.Configure(c.Health)
+	c.registerHealthChecks()
+
+	confMu.Lock()
+	conf = *c
+	confMu.Unlock()
+	return nil
+}
+
+// newRegistry builds a new registry with every configured client and token
+// source, without making it current.
+func (c *Config) newRegistry() (*gsclient.Registry, error) {
+
+	reg := gsclient.NewRegistry()
+
+	err := reg.ConfigureClients(c.TokenClients)
+	if err != nil {
+		return nil, err
+	}
+
+	err = reg.ConfigureTokenSources(c.TokenSources)
+	if err != nil {
+		return nil, err
+	}
+
+	err = reg.ConfigureClients(c.Clients)
+	if err != nil {
+		return nil, err
+	}
+
+	return reg, nil
+}
+
+// registerHealthChecks adds to the readiness report every configured client
+// with a health path and every token source, replacing the ones registered by
+// a previous configuration.
+func (c *Config) registerHealthChecks() {
+	for _, name := range healthChecks {
+		gshealth.Unregister(name)
+	}
+	healthChecks = nil
+
+	register := func(name string, check gshealth.CheckerFunc) {
+		gshealth.Register(name, check)
+		healthChecks = append(healthChecks, name)
+	}
+	for _, ccs := range [][]gsclient.ClientConfig{c.TokenClients, c.Clients} {
+		for _, cc := range ccs {
+			if client, ok := gsclient.GetClient(cc.Key); ok && client.HealthPath != "" {
+				register("client:"+cc.Key, client.CheckHealth)
+			}
+		}
+	}
+	for _, tc := range c.TokenSources {
+		if ts, ok := gsclient.GetTokenSource(tc.Key); ok {
+			register("token_source:"+tc.Key, ts.CheckHealth)
+		}
+	}
+}
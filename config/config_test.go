@@ -0,0 +1,60 @@
+package config
+
+import (
+	"context"
+	"goserver/apierrors"
+	"goserver/utils/gstrace"
+	"testing"
+)
+
+func TestApplyChangesNothingOnError(t *testing.T) {
+	memory := gstrace.MEMORY_EXPORTER
+	applied := &Config{Port: 8080, Tracing: gstrace.TracingConfig{Exporter: &memory}}
+	if err := applied.apply(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		(&Config{}).apply(false)
+		gstrace.Shutdown(context.Background())
+	})
+	exporter := gstrace.MemoryExporter()
+
+	// The tracing changes, but the catalog of the language doesn't exist.
+	none := gstrace.NONE_EXPORTER
+	dir := t.TempDir()
+	failing := &Config{
+		Port:    9090,
+		Tracing: gstrace.TracingConfig{Exporter: &none},
+		I18n:    apierrors.I18nConfig{Path: &dir, Languages: []string{"es"}},
+	}
+	if err := failing.apply(false); err == nil {
+		t.Fatal("expected an error for the missing catalog")
+	}
+
+	if gstrace.MemoryExporter() != exporter || exporter == nil {
+		t.Error("the tracer provider was replaced")
+	}
+	if Current().Port != 8080 {
+		t.Errorf("current port = %d, want the one applied before", Current().Port)
+	}
+}
+
+func TestApplyKeepsUnchangedTracerProvider(t *testing.T) {
+	memory := gstrace.MEMORY_EXPORTER
+	c := &Config{Tracing: gstrace.TracingConfig{Exporter: &memory}}
+	if err := c.apply(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		(&Config{}).apply(false)
+		gstrace.Shutdown(context.Background())
+	})
+	exporter := gstrace.MemoryExporter()
+
+	if err := c.apply(false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gstrace.MemoryExporter() != exporter {
+		t.Error("the tracer provider was replaced although its configuration didn't change")
+	}
+}
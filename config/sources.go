@@ -0,0 +1,536 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goserver/utils/gslog"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// The configuration is built by layering the following sources, each one
+// overriding the previous:
+//
+//  1. The base file given to LoadConfiguration (for example, config.json). It
+//     may be written in JSON, YAML (.yaml or .yml) or TOML (.toml).
+//  2. The environment overlay file, if GOSERVER_ENV is set and the file
+//     exists. Its name is the base one with the environment before the
+//     extension (for example, config.prod.json for GOSERVER_ENV=prod), so
+//     it's written in the same format.
+//  3. Environment variables named GOSERVER_ followed by the path of the
+//     property, with its segments in upper case and separated by a double
+//     underscore. Entries of the client and token source lists are addressed
+//     by their key (or by their index). For example:
+//
+//     GOSERVER_PORT=9090
+//     GOSERVER_LOGGER__MAX_BODY_LENGTH=500
+//     GOSERVER_CLIENTS__MOCKCLIENT__BASEPATH=http://mock:8081/go-mock/v1
+//     GOSERVER_TOKEN_SOURCES__APIGWTOKENSOURCE__SCOPES=["scope1","scope2"]
+//
+//     Values of string properties are taken as they are, even if they look
+//     like a number (for example, a numeric client_secret). Any other value
+//     is parsed as JSON when possible (numbers, booleans, lists) and taken as
+//     a plain string otherwise.
+//
+// Objects are merged property by property. Lists of objects with a "key"
+// property (clients and token sources) are merged entry by entry, matching
+// them by key; any other list is replaced as a whole.
+//
+// Finally, every string value may contain placeholders, resolved after all
+// layers are merged:
+//
+//	${ENV:NAME}   replaced by the value of the environment variable NAME.
+//	${FILE:/path} replaced by the content of the file, without trailing
+//	              newlines. Meant for secrets mounted as files.
+//
+// An unset environment variable or an unreadable file is an error.
+//
+// Values set with Override (for example, from command line flags) are applied
+// over every layer, and are kept when the configuration is reloaded.
+
+// EnvironmentVariable is the name of the environment variable holding the
+// environment name, used to select the overlay file.
+const EnvironmentVariable = "GOSERVER_ENV"
+
+// envPrefix is the prefix of the environment variables overriding properties.
+const envPrefix = "GOSERVER_"
+
+// envSeparator separates the segments of a property path in an environment
+// variable name.
+const envSeparator = "__"
+
+// redactedValue replaces the value of secret properties in DumpRedacted.
+const redactedValue = "******"
+
+// secretProperties are the names (in lower case) of the properties whose value
+// is redacted by DumpRedacted.
+var secretProperties = map[string]struct{}{
+	"client_secret": {},
+	"password":      {},
+	"authorization": {},
+	"api_key":       {},
+	"token":         {},
+}
+
+// overrides contains the values set with Override, in order.
+var overrides []override
+
+// overridesMu synchronizes the access to overrides.
+var overridesMu sync.Mutex
+
+// override is a value set with Override.
+type override struct {
+	path  []string
+	value interface{}
+}
+
+// placeholder matches the ${ENV:NAME} and ${FILE:/path} placeholders.
+var placeholder = regexp.MustCompile(`\$\{(ENV|FILE):([^}]+)\}`)
+
+// readLayers reads the base file and its overlay, applies the environment
+// variable overrides and resolves placeholders, returning the resulting tree.
+func readLayers(f string) (map[string]interface{}, error) {
+
+	tree, err := readTree(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if env := os.Getenv(EnvironmentVariable); env != "" {
+		overlay := overlayFile(f, env)
+		if _, err := os.Stat(overlay); err == nil {
+			overlayTree, err := readTree(overlay)
+			if err != nil {
+				return nil, err
+			}
+			tree = merge(tree, overlayTree).(map[string]interface{})
+		}
+	}
+
+	err = applyEnvOverrides(tree, os.Environ())
+	if err != nil {
+		return nil, err
+	}
+
+	overridesMu.Lock()
+	for _, o := range overrides {
+		if err := setPath(tree, o.path, o.value); err != nil {
+			overridesMu.Unlock()
+			return nil, fmt.Errorf("invalid override of %s: %s", strings.Join(o.path, "."), err.Error())
+		}
+	}
+	overridesMu.Unlock()
+
+	_, err = resolvePlaceholders(tree, "$")
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// readTree reads a configuration file into a generic tree of maps and lists.
+// The format is chosen by the file extension: .json, .yaml, .yml or .toml.
+// Numbers are kept as json.Number, whatever the format.
+func readTree(f string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw interface{}
+	switch ext := strings.ToLower(filepath.Ext(f)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		var m map[string]interface{}
+		err = toml.Unmarshal(data, &m)
+		raw = m
+	default:
+		return nil, fmt.Errorf("unsupported configuration format %s in %s, expected .json, .yaml, .yml or .toml", ext, f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", f, err.Error())
+	}
+
+	normalized, err := normalize(raw)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %s", f, err.Error())
+	}
+	tree, ok := normalized.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("error parsing %s: the configuration must be an object", f)
+	}
+	return tree, nil
+}
+
+// normalize converts the values decoded from YAML or TOML into the ones the
+// JSON decoder would have produced, so that every layer can be merged and
+// decoded the same way.
+func normalize(node interface{}) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			normalized, err := normalize(v)
+			if err != nil {
+				return nil, err
+			}
+			n[k] = normalized
+		}
+		return n, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			normalized, err := normalize(v)
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprint(k)] = normalized
+		}
+		return m, nil
+	case []interface{}:
+		for i, v := range n {
+			normalized, err := normalize(v)
+			if err != nil {
+				return nil, err
+			}
+			n[i] = normalized
+		}
+		return n, nil
+	case []map[string]interface{}:
+		l := make([]interface{}, len(n))
+		for i, v := range n {
+			normalized, err := normalize(v)
+			if err != nil {
+				return nil, err
+			}
+			l[i] = normalized
+		}
+		return l, nil
+	case json.Number:
+		return n, nil
+	case int:
+		return json.Number(strconv.Itoa(n)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(n, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case float64:
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, fmt.Errorf("invalid number %v", n)
+		}
+		return json.Number(strconv.FormatFloat(n, 'f', -1, 64)), nil
+	case time.Time:
+		return n.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return n.String(), nil
+	}
+	return node, nil
+}
+
+// overlayFile returns the name of the overlay file of the given environment.
+func overlayFile(f string, env string) string {
+	ext := filepath.Ext(f)
+	return strings.TrimSuffix(f, ext) + "." + env + ext
+}
+
+// merge returns the result of overriding base with overlay.
+func merge(base interface{}, overlay interface{}) interface{} {
+	switch o := overlay.(type) {
+	case map[string]interface{}:
+		b, ok := base.(map[string]interface{})
+		if !ok {
+			return o
+		}
+		for k, v := range o {
+			b[k] = merge(b[k], v)
+		}
+		return b
+	case []interface{}:
+		b, ok := base.([]interface{})
+		if !ok || !keyedList(b) || !keyedList(o) {
+			return o
+		}
+		for _, item := range o {
+			key := item.(map[string]interface{})["key"]
+			if i := indexByKey(b, fmt.Sprint(key)); i >= 0 {
+				b[i] = merge(b[i], item)
+			} else {
+				b = append(b, item)
+			}
+		}
+		return b
+	}
+	return overlay
+}
+
+// keyedList reports whether every item of the list is an object with a key.
+func keyedList(l []interface{}) bool {
+	for _, item := range l {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if _, ok := m["key"]; !ok {
+			return false
+		}
+	}
+	return len(l) > 0
+}
+
+// indexByKey returns the index of the object with the given key (compared
+// case insensitively) in the list, or -1 if there's none.
+func indexByKey(l []interface{}, key string) int {
+	for i, item := range l {
+		if m, ok := item.(map[string]interface{}); ok {
+			if strings.EqualFold(fmt.Sprint(m["key"]), key) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// applyEnvOverrides sets in the tree the value of every GOSERVER_ environment
+// variable (except GOSERVER_ENV). Variables are applied in name order, so that
+// the result doesn't depend on the environment order. Variables which don't
+// match any property (like a GOSERVER_VERSION set by the deployment) are
+// ignored with a warning, instead of failing as unknown properties.
+func applyEnvOverrides(tree map[string]interface{}, environ []string) error {
+	sort.Strings(environ)
+	for _, kv := range environ {
+		name, value, found := strings.Cut(kv, "=")
+		if !found || !strings.HasPrefix(name, envPrefix) || name == EnvironmentVariable {
+			continue
+		}
+		path := strings.Split(strings.TrimPrefix(name, envPrefix), envSeparator)
+		t := propertyType(reflect.TypeOf(Config{}), path)
+		if t == nil {
+			gslog.Warn(fmt.Sprintf("Ignoring environment variable %s, which doesn't match any configuration property", name), "")
+			continue
+		}
+		if err := setPath(tree, path, envValue(t, value)); err != nil {
+			return fmt.Errorf("invalid environment variable %s: %s", name, err.Error())
+		}
+	}
+	return nil
+}
+
+// Override sets the property in the given path (its segments separated by
+// dots, like "logger.level" or "clients.MockClient.timeout") to the given
+// value, over every other configuration source. It takes effect the next time
+// the configuration is read, and every time after that.
+func Override(path string, value interface{}) {
+	// Go through JSON, so the value is the same the decoder would produce.
+	data, err := json.Marshal(value)
+	if err != nil {
+		data = []byte(fmt.Sprintf("%q", fmt.Sprint(value)))
+	}
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	overrides = append(overrides, override{
+		path:  strings.Split(path, "."),
+		value: parseEnvValue(string(data)),
+	})
+}
+
+// envValue returns the value of the environment variable overriding a
+// property of the given type: as is if the property is a string, or parsed
+// with parseEnvValue otherwise.
+func envValue(t reflect.Type, value string) interface{} {
+	if t.Kind() == reflect.String {
+		return value
+	}
+	return parseEnvValue(value)
+}
+
+// propertyType returns the type of the property in the given path of t, or
+// nil if there's none. Path segments are matched with fieldByProperty, and
+// address any entry of lists and maps.
+func propertyType(t reflect.Type, path []string) reflect.Type {
+	for _, segment := range path {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			f, ok := fieldByProperty(t, segment)
+			if !ok {
+				return nil
+			}
+			t = f.Type
+		case reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return nil
+		}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// parseEnvValue returns the value of an environment variable as JSON, if it's
+// valid JSON, or as a string otherwise.
+func parseEnvValue(value string) interface{} {
+	dec := json.NewDecoder(strings.NewReader(value))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return value
+	}
+	return v
+}
+
+// setPath sets the value in the given path of the tree, creating the objects
+// missing along the way. Path segments are matched case insensitively.
+func setPath(node interface{}, path []string, value interface{}) error {
+	segment := path[0]
+	last := len(path) == 1
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		key := strings.ToLower(segment)
+		for k := range n {
+			if strings.EqualFold(k, segment) {
+				key = k
+			}
+		}
+		if last {
+			n[key] = value
+			return nil
+		}
+		child, ok := n[key]
+		if !ok || child == nil {
+			child = make(map[string]interface{})
+			n[key] = child
+		}
+		return setPath(child, path[1:], value)
+	case []interface{}:
+		i := indexByKey(n, segment)
+		if i < 0 {
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(n) {
+				return fmt.Errorf("no list entry with key or index %s", segment)
+			}
+			i = index
+		}
+		if last {
+			n[i] = value
+			return nil
+		}
+		return setPath(n[i], path[1:], value)
+	}
+	return fmt.Errorf("property %s is not an object nor a list", segment)
+}
+
+// resolvePlaceholders returns a copy of the tree with every placeholder in its
+// string values replaced. The path is used to report errors.
+func resolvePlaceholders(node interface{}, path string) (interface{}, error) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			resolved, err := resolvePlaceholders(v, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			n[k] = resolved
+		}
+	case []interface{}:
+		for i, v := range n {
+			resolved, err := resolvePlaceholders(v, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			n[i] = resolved
+		}
+	case string:
+		var errs []error
+		resolved := placeholder.ReplaceAllStringFunc(n, func(match string) string {
+			groups := placeholder.FindStringSubmatch(match)
+			value, err := resolvePlaceholder(groups[1], groups[2])
+			if err != nil {
+				errs = append(errs, err)
+			}
+			return value
+		})
+		if len(errs) > 0 {
+			return nil, fmt.Errorf("%s: %s", path, errs[0].Error())
+		}
+		return resolved, nil
+	}
+	return node, nil
+}
+
+// resolvePlaceholder returns the value of a single placeholder.
+func resolvePlaceholder(source string, ref string) (string, error) {
+	switch source {
+	case "ENV":
+		value, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", ref)
+		}
+		return value, nil
+	case "FILE":
+		data, err := os.ReadFile(ref)
+		if err != nil {
+			return "", fmt.Errorf("couldn't read file %s: %s", ref, err.Error())
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return "", errors.New("unknown placeholder source " + source)
+}
+
+// DumpRedacted returns the configuration as indented JSON, with the value of
+// every secret property (client secrets, passwords, authorization headers,
+// etc.) redacted. Meant to inspect the effective configuration.
+func (c Config) DumpRedacted() ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	redact(tree)
+	return json.MarshalIndent(tree, "", "  ")
+}
+
+// redact replaces in place the value of every secret property of the tree.
+func redact(node interface{}) {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if _, ok := secretProperties[strings.ToLower(k)]; ok && v != nil {
+				n[k] = redactedValue
+				continue
+			}
+			redact(v)
+		}
+	case []interface{}:
+		for _, v := range n {
+			redact(v)
+		}
+	}
+}
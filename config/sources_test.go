@@ -0,0 +1,330 @@
+package config
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// baseConfig is a minimal valid configuration with a token source and a
+// client using it.
+const baseConfig = `{
+  "port": 8080,
+  "basepath": "/go-server/v1",
+  "token_clients": [
+    {"key": "TokenClient", "basepath": "http://localhost:8082/token"}
+  ],
+  "token_sources": [
+    {"key": "TokenSource", "client_id": "id", "client_secret": "secret", "client_key": "TokenClient"}
+  ],
+  "clients": [
+    {"key": "MockClient", "basepath": "http://localhost:8081/go-mock/v1", "token_source_key": "TokenSource"}
+  ]
+}`
+
+// writeFile writes a file with the given name and content in dir.
+func writeFile(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	f := filepath.Join(dir, name)
+	if err := os.WriteFile(f, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestReadConfigurationLayersOverlay(t *testing.T) {
+	dir := t.TempDir()
+	f := writeFile(t, dir, "config.json", baseConfig)
+	writeFile(t, dir, "config.prod.json", `{
+	  "port": 9090,
+	  "clients": [{"key": "MockClient", "basepath": "http://mock/v1"}]
+	}`)
+	t.Setenv(EnvironmentVariable, "prod")
+
+	c, err := ReadConfiguration(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Port != 9090 {
+		t.Errorf("port = %d, want 9090", c.Port)
+	}
+	if len(c.Clients) != 1 || c.Clients[0].Basepath != "http://mock/v1" || c.Clients[0].TokenSourceKey == nil {
+		t.Errorf("clients = %+v, want MockClient merged with its overlay", c.Clients)
+	}
+}
+
+func TestReadConfigurationEnvOverrides(t *testing.T) {
+	dir := t.TempDir()
+	f := writeFile(t, dir, "config.json", baseConfig)
+	t.Setenv("GOSERVER_PORT", "9191")
+	t.Setenv("GOSERVER_CLIENTS__MOCKCLIENT__BASEPATH", "http://env/v1")
+	t.Setenv("GOSERVER_TOKEN_SOURCES__TOKENSOURCE__SCOPES", `["a","b"]`)
+	t.Setenv("GOSERVER_TOKEN_SOURCES__0__CLIENT_SECRET", "123456")
+	t.Setenv("GOSERVER_TOKEN_SOURCES__0__CLIENT_ID", "true")
+
+	c, err := ReadConfiguration(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Port != 9191 {
+		t.Errorf("port = %d, want 9191", c.Port)
+	}
+	if c.Clients[0].Basepath != "http://env/v1" {
+		t.Errorf("basepath = %s, want http://env/v1", c.Clients[0].Basepath)
+	}
+	ts := c.TokenSources[0]
+	if strings.Join(ts.Scopes, ",") != "a,b" {
+		t.Errorf("scopes = %v, want [a b]", ts.Scopes)
+	}
+	if ts.ClientSecret != "123456" || ts.ClientID != "true" {
+		t.Errorf("client_id, client_secret = %q, %q, want them as strings", ts.ClientID, ts.ClientSecret)
+	}
+}
+
+func TestReadConfigurationIgnoresUnknownEnvVariables(t *testing.T) {
+	dir := t.TempDir()
+	f := writeFile(t, dir, "config.json", baseConfig)
+	t.Setenv("GOSERVER_VERSION", "1.2.3")
+	t.Setenv("GOSERVER_CLIENTS__MOCKCLIENT__COLOR", "red")
+	t.Setenv("GOSERVER_PORT", "9191")
+
+	c, err := ReadConfiguration(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Port != 9191 {
+		t.Errorf("port = %d, want the known variables applied", c.Port)
+	}
+}
+
+func TestReadConfigurationResolvesPlaceholders(t *testing.T) {
+	dir := t.TempDir()
+	secret := writeFile(t, dir, "secret", "from-file\n")
+	f := writeFile(t, dir, "config.json", strings.Replace(baseConfig, `"client_secret": "secret"`,
+		`"client_secret": "${FILE:`+filepath.ToSlash(secret)+`}", "client_id": "${ENV:TEST_CLIENT_ID}"`, 1))
+	t.Setenv("TEST_CLIENT_ID", "from-env")
+
+	c, err := ReadConfiguration(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ts := c.TokenSources[0]; ts.ClientSecret != "from-file" || ts.ClientID != "from-env" {
+		t.Errorf("client_id, client_secret = %q, %q, want from-env, from-file", ts.ClientID, ts.ClientSecret)
+	}
+
+	os.Unsetenv("TEST_CLIENT_ID")
+	if _, err := ReadConfiguration(f); err == nil || !strings.Contains(err.Error(), "TEST_CLIENT_ID") {
+		t.Errorf("err = %v, want the unset variable reported", err)
+	}
+}
+
+func TestReadConfigurationFormats(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := writeFile(t, dir, "config.yaml", `
+port: 8080
+basepath: /go-server/v1
+server:
+  read_timeout: 1m30s
+clients:
+  - key: MockClient
+    basepath: http://localhost:8081/go-mock/v1
+`)
+	c, err := ReadConfiguration(yamlFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Server.ReadTimeout == nil || c.Server.ReadTimeout.String() != "1m30s" {
+		t.Errorf("read_timeout = %v, want 1m30s", c.Server.ReadTimeout)
+	}
+
+	tomlFile := writeFile(t, dir, "config.toml", `port = 8080
+basepath = "/go-server/v1"
+
+[[clients]]
+key = "MockClient"
+basepath = "http://localhost:8081/go-mock/v1"
+`)
+	if _, err := ReadConfiguration(tomlFile); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReadConfigurationFormatsAreEquivalent(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{
+		  "port": 8080,
+		  "basepath": "/go-server/v1",
+		  "server": {"read_timeout": 30, "write_timeout": "1m30s"},
+		  "logger": {"level": "warn", "exclude_urls": ["/health", "/metrics"]},
+		  "tracing": {"sample_ratio": 0.25},
+		  "clients": [{
+		    "key": "MockClient",
+		    "basepath": "http://localhost:8081/go-mock/v1",
+		    "timeout": 2.5,
+		    "skip_ssl": true,
+		    "default_headers": {"X-Api-Key": ["abc"]},
+		    "retry": {"max_attempts": 3, "retryable_status_codes": [502, 503]}
+		  }]
+		}`,
+		"config.yaml": `
+port: 8080
+basepath: /go-server/v1
+server:
+  read_timeout: 30
+  write_timeout: 1m30s
+logger:
+  level: warn
+  exclude_urls: [/health, /metrics]
+tracing:
+  sample_ratio: 0.25
+clients:
+  - key: MockClient
+    basepath: http://localhost:8081/go-mock/v1
+    timeout: 2.5
+    skip_ssl: true
+    default_headers:
+      X-Api-Key: [abc]
+    retry:
+      max_attempts: 3
+      retryable_status_codes: [502, 503]
+`,
+		"config.toml": `port = 8080
+basepath = "/go-server/v1"
+
+[server]
+read_timeout = 30
+write_timeout = "1m30s"
+
+[logger]
+level = "warn"
+exclude_urls = ["/health", "/metrics"]
+
+[tracing]
+sample_ratio = 0.25
+
+[[clients]]
+key = "MockClient"
+basepath = "http://localhost:8081/go-mock/v1"
+timeout = 2.5
+skip_ssl = true
+
+[clients.default_headers]
+X-Api-Key = ["abc"]
+
+[clients.retry]
+max_attempts = 3
+retryable_status_codes = [502, 503]
+`,
+	}
+
+	configs := map[string]*Config{}
+	for name, content := range files {
+		c, err := ReadConfiguration(writeFile(t, dir, name, content))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		configs[name] = c
+	}
+	want := configs["config.json"]
+	if want.Clients[0].Timeout.String() != "2.5s" || want.Server.WriteTimeout.String() != "1m30s" {
+		t.Fatalf("timeouts = %s, %s, want 2.5s, 1m30s", want.Clients[0].Timeout, want.Server.WriteTimeout)
+	}
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		if !reflect.DeepEqual(configs[name], want) {
+			t.Errorf("%s differs from config.json:\n%+v\n%+v", name, configs[name], want)
+		}
+	}
+}
+
+func TestReadConfigurationRejectsUnknownFormat(t *testing.T) {
+	f := writeFile(t, t.TempDir(), "config.ini", "port=8080")
+	if _, err := ReadConfiguration(f); err == nil || !strings.Contains(err.Error(), "unsupported configuration format .ini") {
+		t.Errorf("err = %v, want the format rejected", err)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		node interface{}
+		want interface{}
+	}{
+		{int64(3), json.Number("3")},
+		{uint64(4), json.Number("4")},
+		{1.5, json.Number("1.5")},
+		{map[interface{}]interface{}{1: "a"}, map[string]interface{}{"1": "a"}},
+		{[]map[string]interface{}{{"a": 2}}, []interface{}{map[string]interface{}{"a": json.Number("2")}}},
+		{time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), "2026-01-02T03:04:05Z"},
+	}
+	for _, tt := range tests {
+		got, err := normalize(tt.node)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("normalize(%#v) = %#v, %v, want %#v", tt.node, got, err, tt.want)
+		}
+	}
+	if _, err := normalize(math.Inf(1)); err == nil {
+		t.Error("expected an error for an infinite number")
+	}
+}
+
+func TestReadConfigurationReportsEveryProblem(t *testing.T) {
+	dir := t.TempDir()
+	f := writeFile(t, dir, "config.json", `{"port": 0, "basepath": "x", "clients": []}`)
+
+	_, err := ReadConfiguration(f)
+	errs, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("err = %T, want ValidationErrors", err)
+	}
+	paths := map[string]bool{}
+	for _, e := range errs {
+		paths[e.Path] = true
+	}
+	for _, p := range []string{"$.port", "$.basepath", "$.clients"} {
+		if !paths[p] {
+			t.Errorf("no error for %s in %v", p, err)
+		}
+	}
+}
+
+func TestPropertyType(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"PORT", "int"},
+		{"TOKEN_SOURCES__APIGWTOKENSOURCE__CLIENT_SECRET", "string"},
+		{"CLIENTS__MOCKCLIENT__RETRY__MAX_ATTEMPTS", "int"},
+		{"LOGGER__EXCLUDE_URLS", "[]string"},
+		{"NOT__A__PROPERTY", "<nil>"},
+	}
+	for _, tt := range tests {
+		got := "<nil>"
+		if pt := propertyType(reflect.TypeOf(Config{}), strings.Split(tt.path, envSeparator)); pt != nil {
+			got = pt.String()
+		}
+		if got != tt.want {
+			t.Errorf("propertyType(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestDumpRedacted(t *testing.T) {
+	dir := t.TempDir()
+	c, err := ReadConfiguration(writeFile(t, dir, "config.json", baseConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := c.DumpRedacted()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), `"secret"`) || !strings.Contains(string(data), redactedValue) {
+		t.Errorf("client_secret not redacted:\n%s", data)
+	}
+}
@@ -0,0 +1,537 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goserver/apierrors"
+	"goserver/utils/gsclient"
+	"goserver/utils/gslog"
+	"goserver/utils/gstrace"
+	"net/url"
+	pathpkg "path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// ValidationError describes a single problem found in the configuration.
+type ValidationError struct {
+
+	// Path is the JSON path of the offending property, for example
+	// $.clients[0].basepath.
+	Path    string
+
+	// Message describes the problem.
+	Message string
+}
+
+// Implements interface error.
+func (e ValidationError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors contains every problem found in the configuration, so that
+// all of them can be fixed at once.
+type ValidationErrors []ValidationError
+
+// Implements interface error. Lists every problem, one per line.
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, ve := range e {
+		lines = append(lines, "  - "+ve.Error())
+	}
+	return fmt.Sprintf("invalid configuration (%d problems):\n%s", len(e), strings.Join(lines, "\n"))
+}
+
+// add appends a new problem to the list.
+func (e *ValidationErrors) add(path string, format string, args ...interface{}) {
+	*e = append(*e, ValidationError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// decodeConfiguration decodes the tree into a Config, reporting every unknown
+// property and the type mismatches, and validates the result.
+func decodeConfiguration(tree map[string]interface{}) (*Config, error) {
+
+	var errs ValidationErrors
+	checkProperties(tree, reflect.TypeOf(Config{}), "$", &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return nil, err
+		}
+		// checkProperties should have found it. As encoding/json only returns
+		// the first type error, every property is decoded on its own to
+		// report the rest.
+		decodeProperties(tree, &errs)
+		return nil, errs
+	}
+
+	config.validate(&errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &config, nil
+}
+
+// decodeProperties decodes every property of the tree into its field of a
+// Config on its own, reporting the type errors found.
+func decodeProperties(tree map[string]interface{}, errs *ValidationErrors) {
+	keys := make([]string, 0, len(tree))
+	for k := range tree {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	t := reflect.TypeOf(Config{})
+	for _, k := range keys {
+		field, ok := fieldByProperty(t, k)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(tree[k])
+		if err != nil {
+			continue
+		}
+		err = json.Unmarshal(data, reflect.New(field.Type).Interface())
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			path := "$." + k
+			if typeErr.Field != "" {
+				// Fields are named like "clients.0.key".
+				for _, segment := range strings.Split(typeErr.Field, ".") {
+					if _, err := strconv.Atoi(segment); err == nil {
+						path += "[" + segment + "]"
+					} else {
+						path += "." + segment
+					}
+				}
+			}
+			errs.add(path, "expected %s, got %s", typeErr.Type.Kind(), typeErr.Value)
+		}
+	}
+}
+
+// checkProperties reports every property of the tree that doesn't match a
+// field of the given type, or whose value can't be decoded into it. Property
+// names are matched case insensitively, the same way encoding/json does.
+func checkProperties(node interface{}, t reflect.Type, path string, errs *ValidationErrors) {
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node == nil {
+		return
+	}
+
+	// Types decoding themselves (like gstime.Duration) are checked by trying
+	// to decode the value.
+	if u, ok := reflect.New(t).Interface().(json.Unmarshaler); ok {
+		data, err := json.Marshal(node)
+		if err == nil {
+			err = u.UnmarshalJSON(data)
+		}
+		if err != nil {
+			errs.add(path, "%s", err.Error())
+		}
+		return
+	}
+
+	mismatch := func(expected string) {
+		errs.add(path, "expected %s, got %s", expected, jsonKind(node))
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			mismatch("object")
+			return
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			field, ok := fieldByProperty(t, k)
+			if !ok {
+				errs.add(path+"."+k, "unknown property")
+				continue
+			}
+			checkProperties(m[k], field.Type, path+"."+k, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		l, ok := node.([]interface{})
+		if !ok {
+			mismatch("list")
+			return
+		}
+		for i, v := range l {
+			checkProperties(v, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			mismatch("object")
+			return
+		}
+		for k, v := range m {
+			checkProperties(v, t.Elem(), path+"."+k, errs)
+		}
+	case reflect.String:
+		if _, ok := node.(string); !ok {
+			mismatch("string")
+		}
+	case reflect.Bool:
+		if _, ok := node.(bool); !ok {
+			mismatch("boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := node.(json.Number)
+		if !ok {
+			mismatch("integer")
+		} else if i, err := n.Int64(); err != nil || reflect.New(t).Elem().OverflowInt(i) {
+			errs.add(path, "expected integer, got %s", n.String())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := node.(json.Number)
+		if !ok {
+			mismatch("non-negative integer")
+		} else if u, err := strconv.ParseUint(n.String(), 10, 64); err != nil || reflect.New(t).Elem().OverflowUint(u) {
+			errs.add(path, "expected non-negative integer, got %s", n.String())
+		}
+	case reflect.Float32, reflect.Float64:
+		n, ok := node.(json.Number)
+		if !ok {
+			mismatch("number")
+		} else if f, err := n.Float64(); err != nil || reflect.New(t).Elem().OverflowFloat(f) {
+			errs.add(path, "expected number, got %s", n.String())
+		}
+	}
+}
+
+// jsonKind returns the JSON type of a value of the tree.
+func jsonKind(node interface{}) string {
+	switch node.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "list"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	}
+	return "null"
+}
+
+// fieldByProperty returns the field of the struct type decoded from the given
+// JSON property.
+func fieldByProperty(t reflect.Type, property string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName, _, _ := strings.Cut(tag, ",")
+			if tagName == "-" {
+				continue
+			}
+			if tagName != "" {
+				name = tagName
+			}
+		}
+		if strings.EqualFold(name, property) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// validate checks the values of the configuration and the references between
+// its clients and token sources, adding every problem found to errs.
+//
+// Token clients are configured first, then token sources and finally clients.
+// So a token source may only use a token client, and only clients may use a
+// token source.
+func (c *Config) validate(errs *ValidationErrors) {
+
+	if c.Port <= 0 || c.Port > 65535 {
+		errs.add("$.port", "must be between 1 and 65535")
+	}
+	if !strings.HasPrefix(c.Basepath, "/") {
+		errs.add("$.basepath", "must start with /")
+	}
+
+	s := c.Server
+	positive(errs, "$.server.read_header_timeout", s.ReadHeaderTimeout)
+	positive(errs, "$.server.read_timeout", s.ReadTimeout)
+	positive(errs, "$.server.write_timeout", s.WriteTimeout)
+	positive(errs, "$.server.idle_timeout", s.IdleTimeout)
+	positive(errs, "$.server.shutdown_timeout", s.ShutdownTimeout)
+	notNegative(errs, "$.server.drain_delay", s.DrainDelay)
+
+	positive(errs, "$.health.cache_interval", c.Health.CacheInterval)
+	positive(errs, "$.health.timeout", c.Health.Timeout)
+
+	if c.Logger != nil {
+		notNegative(errs, "$.logger.max_body_length", c.Logger.MaxBodyLength)
+		if ac := c.Logger.Access; ac != nil {
+			if ac.Format != nil {
+				switch gslog.AccessLogFormat(strings.ToLower(string(*ac.Format))) {
+				case gslog.JSON_FORMAT, gslog.COMBINED_FORMAT, gslog.LOGFMT_FORMAT:
+				default:
+					errs.add("$.logger.access.format", "unknown format %s, expected one of %s, %s or %s", *ac.Format,
+						gslog.JSON_FORMAT, gslog.COMBINED_FORMAT, gslog.LOGFMT_FORMAT)
+				}
+			}
+			if r := ac.SampleRatio; r != nil && (*r < 0 || *r > 1) {
+				errs.add("$.logger.access.sample_ratio", "must be between 0 and 1")
+			}
+			if ac.Filename != nil && strings.TrimSpace(*ac.Filename) == "" {
+				errs.add("$.logger.access.filename", "must not be empty")
+			}
+			positive(errs, "$.logger.access.file.max_size", ac.File.MaxSize)
+			notNegative(errs, "$.logger.access.file.max_backups", ac.File.MaxBackups)
+			notNegative(errs, "$.logger.access.file.max_age", ac.File.MaxAge)
+		}
+		if rc := c.Logger.Redact; rc != nil {
+			validatePatterns(errs, "$.logger.redact.patterns", rc.Patterns)
+			for i, route := range rc.Routes {
+				path := fmt.Sprintf("$.logger.redact.routes[%d]", i)
+				if _, err := pathpkg.Match(route.Path, ""); err != nil || !strings.HasPrefix(route.Path, "/") {
+					errs.add(path+".path", "must be a path pattern starting with /")
+				}
+				validatePatterns(errs, path+".patterns", route.Patterns)
+			}
+		}
+	}
+
+	for i, h := range c.Trace.Headers {
+		if strings.TrimSpace(h) == "" {
+			errs.add(fmt.Sprintf("$.trace.headers[%d]", i), "must not be empty")
+		}
+	}
+	positive(errs, "$.trace.max_length", c.Trace.MaxLength)
+	if c.Trace.Pattern != nil {
+		if _, err := regexp.Compile(*c.Trace.Pattern); err != nil {
+			errs.add("$.trace.pattern", "invalid regular expression: %s", err.Error())
+		}
+	}
+
+	if e := c.Tracing.Exporter; e != nil {
+		switch gstrace.Exporter(strings.ToLower(string(*e))) {
+		case gstrace.NONE_EXPORTER, gstrace.OTLP_EXPORTER, gstrace.STDOUT_EXPORTER, gstrace.MEMORY_EXPORTER:
+		default:
+			errs.add("$.tracing.exporter", "unknown exporter %s, expected one of %s, %s, %s or %s", *e,
+				gstrace.NONE_EXPORTER, gstrace.OTLP_EXPORTER, gstrace.STDOUT_EXPORTER, gstrace.MEMORY_EXPORTER)
+		}
+	}
+	positive(errs, "$.tracing.timeout", c.Tracing.Timeout)
+	if r := c.Tracing.SampleRatio; r != nil && (*r < 0 || *r > 1) {
+		errs.add("$.tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	validateI18n(errs, c.I18n)
+
+	positive(errs, "$.log_file.max_size", c.LogFile.MaxSize)
+	notNegative(errs, "$.log_file.max_backups", c.LogFile.MaxBackups)
+	notNegative(errs, "$.log_file.max_age", c.LogFile.MaxAge)
+
+	// Clients and token clients share the registry, so their keys must be
+	// unique across both lists.
+	clientPaths := make(map[string]string)
+	tokenClients := make(map[string]struct{})
+	for i, cc := range c.TokenClients {
+		path := fmt.Sprintf("$.token_clients[%d]", i)
+		validateClient(errs, path, cc, clientPaths)
+		tokenClients[cc.Key] = struct{}{}
+		if cc.TokenSourceKey != nil {
+			errs.add(path+".token_source_key", "token clients can't use a token source")
+		}
+	}
+
+	sourcePaths := make(map[string]string)
+	for i, tc := range c.TokenSources {
+		path := fmt.Sprintf("$.token_sources[%d]", i)
+		if tc.Key == "" {
+			errs.add(path+".key", "is required")
+		} else if prev, ok := sourcePaths[tc.Key]; ok {
+			errs.add(path+".key", "duplicated key %s, already used in %s", tc.Key, prev)
+		} else {
+			sourcePaths[tc.Key] = path
+		}
+		if tc.ClientID == "" {
+			errs.add(path+".client_id", "is required")
+		}
+		if tc.ClientSecret == "" {
+			errs.add(path+".client_secret", "is required")
+		}
+		if tc.ExpiryDelta != nil && *tc.ExpiryDelta < 0 {
+			errs.add(path+".expiry_delta", "must not be negative")
+		}
+		if _, ok := tokenClients[tc.ClientKey]; !ok {
+			if _, isClient := clientKeyIn(c.Clients, tc.ClientKey); isClient {
+				errs.add(path+".client_key", "client %s must be declared in token_clients, clients are configured after token sources", tc.ClientKey)
+			} else {
+				errs.add(path+".client_key", "unknown token client %s", tc.ClientKey)
+			}
+		}
+	}
+
+	for i, cc := range c.Clients {
+		path := fmt.Sprintf("$.clients[%d]", i)
+		validateClient(errs, path, cc, clientPaths)
+		if cc.TokenSourceKey != nil {
+			if _, ok := sourcePaths[*cc.TokenSourceKey]; !ok {
+				errs.add(path+".token_source_key", "unknown token source %s", *cc.TokenSourceKey)
+			}
+		}
+	}
+
+	for _, requiredKey := range clientKeys {
+		if _, ok := clientKeyIn(c.Clients, string(requiredKey)); !ok {
+			errs.add("$.clients", "required client %s is missing", string(requiredKey))
+		}
+	}
+}
+
+// validateClient checks the properties of a client or token client. Keys
+// already used are taken from paths, where the key of the client is added.
+func validateClient(errs *ValidationErrors, path string, cc gsclient.ClientConfig, paths map[string]string) {
+
+	if cc.Key == "" {
+		errs.add(path+".key", "is required")
+	} else if prev, ok := paths[cc.Key]; ok {
+		errs.add(path+".key", "duplicated key %s, already used in %s", cc.Key, prev)
+	} else {
+		paths[cc.Key] = path
+	}
+
+	u, err := url.Parse(cc.Basepath)
+	if err != nil {
+		errs.add(path+".basepath", "invalid URL: %s", err.Error())
+	} else if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs.add(path+".basepath", "must be an absolute http or https URL")
+	}
+
+	if cc.Timeout != nil && *cc.Timeout <= 0 {
+		errs.add(path+".timeout", "must be positive")
+	}
+	if cc.HealthPath != nil && !strings.HasPrefix(*cc.HealthPath, "/") {
+		errs.add(path+".health_path", "must start with /")
+	}
+
+	if rc := cc.Retry; rc != nil {
+		if rc.MaxAttempts != nil && *rc.MaxAttempts < 1 {
+			errs.add(path+".retry.max_attempts", "must be at least 1")
+		}
+		positive(errs, path+".retry.base_backoff", rc.BaseBackoff)
+		positive(errs, path+".retry.max_backoff", rc.MaxBackoff)
+		if rc.BaseBackoff != nil && rc.MaxBackoff != nil && *rc.MaxBackoff < *rc.BaseBackoff {
+			errs.add(path+".retry.max_backoff", "must not be less than base_backoff")
+		}
+		if rc.Jitter != nil && (*rc.Jitter < 0 || *rc.Jitter > 1) {
+			errs.add(path+".retry.jitter", "must be between 0 and 1")
+		}
+		for j, sc := range rc.RetryableStatusCodes {
+			if sc < 100 || sc > 599 {
+				errs.add(fmt.Sprintf("%s.retry.retryable_status_codes[%d]", path, j), "invalid status code %d", sc)
+			}
+		}
+	}
+
+	if bc := cc.CircuitBreaker; bc != nil {
+		if bc.FailureRateThreshold != nil && (*bc.FailureRateThreshold <= 0 || *bc.FailureRateThreshold > 1) {
+			errs.add(path+".circuit_breaker.failure_rate_threshold", "must be greater than 0 and at most 1")
+		}
+		positive(errs, path+".circuit_breaker.window_size", bc.WindowSize)
+		positive(errs, path+".circuit_breaker.min_requests", bc.MinRequests)
+		notNegative(errs, path+".circuit_breaker.consecutive_failures", bc.ConsecutiveFailures)
+		positive(errs, path+".circuit_breaker.cool_down", bc.CoolDown)
+		positive(errs, path+".circuit_breaker.half_open_probes", bc.HalfOpenProbes)
+	}
+}
+
+// validatePatterns reports the redaction patterns that are neither predefined
+// nor valid regular expressions.
+func validatePatterns(errs *ValidationErrors, path string, patterns []string) {
+	for i, p := range patterns {
+		if err := gslog.ValidatePattern(p); err != nil {
+			errs.add(fmt.Sprintf("%s[%d]", path, i), "unknown pattern or invalid regular expression: %s", err.Error())
+		}
+	}
+}
+
+// clientKeyIn returns the index of the client with the given key.
+func clientKeyIn(ccs []gsclient.ClientConfig, key string) (int, bool) {
+	for i, cc := range ccs {
+		if cc.Key == key {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// positive reports the value, if set, when it's not greater than zero.
+func positive[T ~int | ~int64 | ~float64](errs *ValidationErrors, path string, v *T) {
+	if v != nil && *v <= 0 {
+		errs.add(path, "must be positive")
+	}
+}
+
+// notNegative reports the value, if set, when it's less than zero.
+func notNegative[T ~int | ~int64 | ~float64](errs *ValidationErrors, path string, v *T) {
+	if v != nil && *v < 0 {
+		errs.add(path, "must not be negative")
+	}
+}
+
+// validateI18n checks the configured languages and that each of them has a
+// complete catalog (see apierrors.Catalog), so that a missing message is found
+// at startup instead of when the error happens.
+func validateI18n(errs *ValidationErrors, ic apierrors.I18nConfig) {
+	if ic.DefaultLanguage != nil {
+		found := false
+		for _, l := range ic.Languages {
+			found = found || l == *ic.DefaultLanguage
+		}
+		if !found {
+			errs.add("$.i18n.default_language", "must be one of the languages")
+		}
+	}
+	for i, l := range ic.Languages {
+		path := fmt.Sprintf("$.i18n.languages[%d]", i)
+		if _, err := language.Parse(l); err != nil {
+			errs.add(path, "invalid language %s: %s", l, err.Error())
+			continue
+		}
+		catalog, err := apierrors.ReadCatalog(ic.CatalogPath(), l)
+		if err != nil {
+			errs.add(path, "%s", err.Error())
+			continue
+		}
+		for _, problem := range catalog.Check() {
+			errs.add(path, "catalog %s: %s", l, problem)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestValidationErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{"every type mismatch", `{
+		  "port": "x",
+		  "basepath": 1,
+		  "server": {"read_timeout": "soon"},
+		  "logger": {"level": "TRACE", "max_body_length": 1.5, "exclude_urls": "/health"},
+		  "clients": [{"key": "MockClient", "basepath": "http://a", "timeout": true, "skip_ssl": "yes"}]
+		}`, []string{
+			"$.basepath", "$.clients[0].skip_ssl", "$.clients[0].timeout", "$.logger.exclude_urls",
+			"$.logger.level", "$.logger.max_body_length", "$.port", "$.server.read_timeout",
+		}},
+		{"every unknown property", `{
+		  "port": 8080,
+		  "basepath": "/x",
+		  "colour": "red",
+		  "server": {"tls": {}},
+		  "clients": [{"key": "MockClient", "basepath": "http://a", "retries": 3}]
+		}`, []string{"$.clients[0].retries", "$.colour", "$.server.tls"}},
+		{"every invalid value", `{
+		  "port": 0,
+		  "basepath": "x",
+		  "server": {"drain_delay": -1},
+		  "tracing": {"exporter": "zipkin", "sample_ratio": 2},
+		  "clients": [{
+		    "key": "MockClient",
+		    "basepath": "ftp://a",
+		    "retry": {"max_attempts": 0, "base_backoff": 2, "max_backoff": 1},
+		    "circuit_breaker": {"failure_rate_threshold": 2, "consecutive_failures": -1}
+		  }]
+		}`, []string{
+			"$.basepath", "$.clients[0].basepath", "$.clients[0].circuit_breaker.consecutive_failures",
+			"$.clients[0].circuit_breaker.failure_rate_threshold", "$.clients[0].retry.max_attempts",
+			"$.clients[0].retry.max_backoff", "$.port", "$.server.drain_delay", "$.tracing.exporter",
+			"$.tracing.sample_ratio",
+		}},
+		{"every broken reference", `{
+		  "port": 8080,
+		  "basepath": "/x",
+		  "token_clients": [{"key": "TokenClient", "basepath": "http://t", "token_source_key": "A"}],
+		  "token_sources": [
+		    {"key": "A", "client_id": "id", "client_secret": "s", "client_key": "Other"},
+		    {"key": "A", "client_id": "id", "client_secret": "s", "client_key": "Missing"}
+		  ],
+		  "clients": [
+		    {"key": "Other", "basepath": "http://o", "token_source_key": "B"},
+		    {"key": "TokenClient", "basepath": "http://d"}
+		  ]
+		}`, []string{
+			"$.clients", "$.clients[0].token_source_key", "$.clients[1].key", "$.token_clients[0].token_source_key",
+			"$.token_sources[0].client_key", "$.token_sources[1].client_key", "$.token_sources[1].key",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadConfiguration(writeFile(t, t.TempDir(), "config.json", tt.config))
+			errs, ok := err.(ValidationErrors)
+			if !ok {
+				t.Fatalf("err = %v, want ValidationErrors", err)
+			}
+			var paths []string
+			for _, e := range errs {
+				paths = append(paths, e.Path)
+			}
+			sort.Strings(paths)
+			if !reflect.DeepEqual(paths, tt.want) {
+				t.Errorf("errors in %v, want %v\n%v", paths, tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDecodePropertiesReportsEveryTypeError(t *testing.T) {
+	tree := map[string]interface{}{
+		"port":     "x",
+		"basepath": true,
+		"clients":  []interface{}{map[string]interface{}{"key": 1}},
+	}
+	var errs ValidationErrors
+	decodeProperties(tree, &errs)
+
+	var paths []string
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"$.basepath", "$.clients[0].key", "$.port"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("errors in %v, want %v", paths, want)
+	}
+}
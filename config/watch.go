@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"goserver/utils/gslog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WatchConfiguration reloads the configuration file every time it changes or a
+// SIGHUP is received. The file is checked for changes (modification time and
+// size) every interval.
+//
+// Reload errors are logged and the current configuration is kept. Returns a
+// function that stops watching.
+func WatchConfiguration(f string, interval time.Duration) (stop func()) {
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	last, _ := os.Stat(f)
+
+	reload := func(reason string) {
+		gslog.Info(fmt.Sprintf("Reloading configuration from %s (%s)", f, reason), "")
+		if err := ReloadConfiguration(f); err != nil {
+			gslog.Error(fmt.Sprintf("Configuration not reloaded, keeping the current one: %s", err.Error()), "")
+			return
+		}
+		gslog.Info("Configuration reloaded", "")
+	}
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-hangup:
+				last, _ = os.Stat(f)
+				reload("SIGHUP received")
+			case <-ticker.C:
+				info, err := os.Stat(f)
+				if err != nil || !changed(last, info) {
+					continue
+				}
+				last = info
+				reload("file changed")
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(hangup)
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// changed reports whether the file described by info is different from the one
+// described by last.
+func changed(last os.FileInfo, info os.FileInfo) bool {
+	if last == nil {
+		return true
+	}
+	return !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size()
+}
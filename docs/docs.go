@@ -22,6 +22,14 @@ const docTemplate = `{
         "/users": {
             "get": {
                 "description": "Permite la búsqueda de todos los usuarios (no utiliza paginación)",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "text/csv",
+                    "application/msgpack",
+                    "application/problem+json"
+                ],
                 "tags": [
                     "Users"
                 ],
@@ -37,29 +45,99 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/gserrors.Error"
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
                         }
                     }
                 }
             },
             "post": {
                 "description": "Permite crear un nuevo usuario",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "text/csv",
+                    "application/msgpack",
+                    "application/problem+json"
+                ],
                 "tags": [
                     "Users"
                 ],
                 "summary": "Crea un nuevo usuario",
                 "operationId": "post-user",
+                "parameters": [
+                    {
+                        "description": "The user to create",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/CreateUserRequestDTO"
+                        }
+                    }
+                ],
                 "responses": {
                     "201": {
-                        "description": "Created"
+                        "description": ""
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
                     },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
-                            "$ref": "#/definitions/gserrors.Error"
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
                         }
                     }
                 }
@@ -68,6 +146,14 @@ const docTemplate = `{
         "/users/{id}": {
             "get": {
                 "description": "Permite la búsqueda de un usuario a través de su ID",
+                "produces": [
+                    "application/json",
+                    "text/xml",
+                    "application/yaml",
+                    "text/csv",
+                    "application/msgpack",
+                    "application/problem+json"
+                ],
                 "tags": [
                     "Users"
                 ],
@@ -88,12 +174,80 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/UserDTO"
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "406": {
+                        "description": "Not Acceptable",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "502": {
+                        "description": "Bad Gateway",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "$ref": "#/definitions/apierrors.Problem"
+                        }
                     }
                 }
             }
         }
     },
     "definitions": {
+        "CreateUserRequestDTO": {
+            "type": "object",
+            "required": [
+                "age",
+                "name",
+                "surname"
+            ],
+            "properties": {
+                "age": {
+                    "description": "The age of the user",
+                    "type": "integer",
+                    "maximum": 130,
+                    "minimum": 0,
+                    "example": 27
+                },
+                "email": {
+                    "description": "The email of the user",
+                    "type": "string",
+                    "example": "martinbiagini@gmail.com"
+                },
+                "name": {
+                    "description": "The name of the user",
+                    "type": "string",
+                    "example": "Martín"
+                },
+                "surname": {
+                    "description": "The surname of the user",
+                    "type": "string",
+                    "example": "Biagini"
+                }
+            }
+        },
         "UserDTO": {
             "type": "object",
             "properties": {
@@ -124,16 +278,57 @@ const docTemplate = `{
                 }
             }
         },
-        "gserrors.Error": {
+        "apierrors.FieldError": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "apierrors.Problem": {
             "type": "object",
             "properties": {
                 "code": {
+                    "description": "Code is the error code (see ErrorCode).",
                     "type": "integer"
                 },
+                "detail": {
+                    "description": "Detail is the message of this occurrence of the error.",
+                    "type": "string"
+                },
+                "errors": {
+                    "description": "Errors has one entry per field of the request failing validation.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/apierrors.FieldError"
+                    }
+                },
+                "instance": {
+                    "description": "Instance is the path of the request.",
+                    "type": "string"
+                },
                 "label": {
+                    "description": "Label is the label of the error code.",
                     "type": "string"
                 },
-                "message": {
+                "status": {
+                    "description": "Status is the http status of the response.",
+                    "type": "integer"
+                },
+                "title": {
+                    "description": "Title is the summary of the error code.",
+                    "type": "string"
+                },
+                "trace_id": {
+                    "description": "TraceID is the trace ID of the request.",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type is the URI identifying the error code.",
                     "type": "string"
                 }
             }
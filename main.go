@@ -1,19 +1,35 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"goserver/apierrors"
 	"goserver/config"
+	"goserver/utils/gshandler"
 	"goserver/utils/gslog"
 	"goserver/utils/gsmiddleware"
 	"goserver/utils/gsrender"
+	"goserver/utils/gsserver"
+	"goserver/utils/gstrace"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	_ "github.com/swaggo/http-swagger/example/go-chi/docs"
 )
 
+// defaultConfigFile is the path of the configuration file used if none is
+// given with the --config flag.
+const defaultConfigFile = "./resources/config.json"
+
+// configWatchInterval is how often the configuration file is checked for changes.
+const configWatchInterval = 5 * time.Second
+
 // @title Go Chi Server
 // @version 1.0.0
 // @description Servidor que utiliza el framework chi y expone una API REST.
@@ -21,30 +37,117 @@ import (
 // @contact.name RedFoxSoft
 // @contact.email support@redfoxsoft.com
 func main() {
+	os.Exit(runCommand(os.Args[1:]))
+}
 
-	r := chi.NewRouter()
+// serve starts the server with the configuration given by the flags, and
+// blocks until it's stopped. Returns the exit code of the program.
+func serve(args []string) int {
+
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	configFile := fs.String("config", defaultConfigFile, "path of the configuration file (.json, .yaml, .yml or .toml)")
+	addr := fs.String("addr", "", "address to listen on, as host:port, overriding the configured server.address and port")
+	logLevel := fs.String("log-level", "", "minimum level logged (DEBUG, INFO, WARN or ERROR), overriding the configured logger.level")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	// Flags are applied over the configuration file, also when reloaded.
+	if *addr != "" {
+		host, port, err := net.SplitHostPort(*addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid address %s: %s\n", *addr, err.Error())
+			return 2
+		}
+		p, err := strconv.Atoi(port)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid port in address %s\n", *addr)
+			return 2
+		}
+		if host != "" {
+			config.Override("server.address", host)
+		}
+		config.Override("port", p)
+	}
+	if *logLevel != "" {
+		level, err := gslog.ParseLevel(*logLevel)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return 2
+		}
+		config.Override("logger.level", level)
+	}
 
 	// Load configuration from external file.
-	err := config.LoadConfiguration("./resources/config.json")
+	err := config.LoadConfiguration(*configFile)
 	if err != nil {
 		fmt.Println("Error found in app configuration")
 		fmt.Println(err.Error())
-		os.Exit(1)
+		return 1
+	}
+
+	// Libraries logging through slog or the log package write in the same
+	// format as the rest of the server.
+	slog.SetDefault(slog.New(gslog.NewHandler()))
+
+	// Reload configuration when the file changes or on SIGHUP.
+	stopWatching := config.WatchConfiguration(*configFile, configWatchInterval)
+
+	// Besides JSON and XML, responses can be written in these formats if the
+	// client accepts them, and errors as problem+json.
+	gsrender.Register(gsrender.YAMLEncoder, gsrender.CSVEncoder, gsrender.MsgPackEncoder, apierrors.ProblemJSONEncoder)
+
+	// Errors returned by handlers, and responses in formats the client doesn't
+	// accept, are answered as apierrors.
+	gshandler.SetErrorHandler(apierrors.Handle)
+	gsrender.SetNotAcceptable(apierrors.NotAcceptable)
+
+	// Add middlewares and routes.
+	r := newRouter()
+
+	// Close the log file once everything else is shut down.
+	gsserver.OnShutdown("close log file", func(ctx context.Context) error {
+		return gslog.Close()
+	})
+	gsserver.OnShutdown("flush traces", gstrace.Shutdown)
+	gsserver.OnShutdown("stop configuration watcher", func(ctx context.Context) error {
+		stopWatching()
+		return nil
+	})
+
+	// Start server.
+	gslog.Server("Starting server")
+	conf := config.Current()
+	srv := gsserver.New(conf.Port, conf.Server, r)
+	err = srv.Run()
+	if err != nil {
+		gslog.Server(err.Error())
+		gslog.Close()
+		return 1
 	}
+	gslog.Server("Server stopped")
+	return 0
+}
+
+// newRouter returns the router with every middleware and route of the server.
+func newRouter() *chi.Mux {
+
+	r := chi.NewRouter()
 
 	// Add middlewares.
 	gslog.Server("Setting middlewares")
 	r.Use(gsmiddleware.MetricsHandler)
 	r.Use(gsmiddleware.TraceID)
-	r.Use(gsmiddleware.Recoverer(apierrors.New(apierrors.ERR_NOT_DEFINED), gsrender.JSON))
+	r.Use(gstrace.Handler)
+	r.Use(gsmiddleware.AccessLogHandler)
+	r.Use(gsmiddleware.Recoverer(func(w http.ResponseWriter, r *http.Request) {
+		apierrors.Write(w, r, apierrors.New(apierrors.ERR_NOT_DEFINED))
+	}))
 	r.Use(gsmiddleware.HttpLogHandler)
-	
+
 	// Configure routes.
-	gslog.Server("Setting routes") 
+	gslog.Server("Setting routes")
 	Routes(r)
 
-	// Start server.
-	gslog.Server("Starting server")
-	http.ListenAndServe("127.0.0.1:8080", r)
-
-}
\ No newline at end of file
+	return r
+}
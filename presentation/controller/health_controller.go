@@ -1,10 +1,40 @@
 package controller
 
 import (
+	"goserver/utils/gshealth"
 	"goserver/utils/gsrender"
+	"goserver/utils/gsserver"
 	"net/http"
 )
 
+// CheckHealth answers 200 while the server is up, and 503 once it started
+// shutting down so that no new traffic is sent to it.
 func CheckHealth(w http.ResponseWriter, r *http.Request) {
+	if gsserver.Draining() {
+		gsrender.Status(w, http.StatusServiceUnavailable)
+		return
+	}
 	gsrender.Status(w, http.StatusOK)
+}
+
+// CheckLiveness answers 200 as long as the server is able to handle requests.
+// It doesn't check any dependency: a failing dependency is not solved by
+// restarting this server.
+func CheckLiveness(w http.ResponseWriter, r *http.Request) {
+	gsrender.WriteJSON(w, http.StatusOK, gshealth.Report{Status: gshealth.UP, Checks: []gshealth.CheckResult{}})
+}
+
+// CheckReadiness runs every registered readiness check and answers with the
+// report, with status 200 if every check is UP and 503 otherwise. It also
+// answers 503 once the server started shutting down.
+func CheckReadiness(w http.ResponseWriter, r *http.Request) {
+	report := gshealth.Readiness()
+	if gsserver.Draining() {
+		report.Status = gshealth.DOWN
+	}
+	status := http.StatusOK
+	if report.Status != gshealth.UP {
+		status = http.StatusServiceUnavailable
+	}
+	gsrender.WriteJSON(w, uint(status), report)
 }
\ No newline at end of file
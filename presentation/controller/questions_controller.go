@@ -2,19 +2,19 @@ package controller
 
 import (
 	"encoding/xml"
-	"fmt"
+	"goserver/apierrors"
 	"goserver/utils/gsrender"
 	"net/http"
 )
 
 type AnswerOption struct {
-	XMLName xml.Name `xml:"answerOptions"`
+	XMLName xml.Name `xml:"answerOptions" json:"-"`
 	OptionId string `xml:"optionId"`
 	Text string `xml:"text"`
 }
 
 type Question struct {
-	XMLName xml.Name `xml:"questions"`
+	XMLName xml.Name `xml:"questions" json:"-"`
 	QuestionId string `xml:"questionId"`
 	Order string `xml:"orden"`
 	Text string `xml:"text"`
@@ -22,7 +22,7 @@ type Question struct {
 }
 
 type QuestionsResponse struct {
-	XMLName xml.Name `xml:"ns=http://webservices.idvalidator.veraz.com ns:obtenerPreguntasResponse"`
+	XMLName xml.Name `xml:"ns=http://webservices.idvalidator.veraz.com ns:obtenerPreguntasResponse" json:"-"`
 	Document string `xml:"return>integrantes>documento"`
 	Birthdate string `xml:"return>integrantes>fecha_nac"`
 	Name string `xml:"return>integrantes>nombre"`
@@ -33,7 +33,7 @@ type QuestionsResponse struct {
 }
 
 type GetQuestionsResponse struct {
-	XMLName xml.Name `xml:"soapenv=http://schemas.xmlsoap.org/soap/envelope/ soapenv:Envelope"`
+	XMLName xml.Name `xml:"soapenv=http://schemas.xmlsoap.org/soap/envelope/ soapenv:Envelope" json:"-"`
 	QuestionsResponse *QuestionsResponse `xml:"soapenv:Body>ns:obtenerPreguntasResponse"`
 }
 
@@ -62,14 +62,13 @@ type Plant struct {
     Origin  []string `xml:"origin"`
 }
 
-func GetQuestions(w http.ResponseWriter, r *http.Request) {
+func GetQuestions(w http.ResponseWriter, r *http.Request) error {
 
 	var requestBody GetQuestionsRequest
 
 	err := xml.NewDecoder(r.Body).Decode(&requestBody)
 	if (err != nil) {
-		fmt.Println(err)
-		return
+		return apierrors.Wrap(apierrors.INVALID_ARGUMENT, err, "decoding XML request body")
 	}
 
 	answerOptionA := &AnswerOption{
@@ -101,5 +100,8 @@ func GetQuestions(w http.ResponseWriter, r *http.Request) {
 	response := &GetQuestionsResponse{}
 	response.QuestionsResponse = questionsResponse
 
-	gsrender.WriteXML(w, 200, response)
+	// XML is preferred, as the response mimics the SOAP service, but the
+	// client may ask for any other format.
+	gsrender.Negotiate(w, r, 200, response, "text/xml")
+	return nil
 }
\ No newline at end of file
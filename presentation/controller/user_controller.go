@@ -1,15 +1,12 @@
 package controller
 
 import (
+	"context"
 	"goserver/apierrors"
 	"goserver/model"
 	"goserver/presentation/dto"
 	"goserver/service"
-	"goserver/utils/gslog"
-	"goserver/utils/gsmiddleware"
-	"goserver/utils/gsrender"
-	"goserver/utils/gsvalidation"
-	"net/http"
+	"goserver/utils/gshandler"
 	"strconv"
 
 	dtomapper "github.com/dranikpg/dto-mapper"
@@ -21,23 +18,24 @@ import (
 // @Description Permite la búsqueda de todos los usuarios (no utiliza paginación)
 // @ID 			get-users
 // @Tags 		Users
+// @Produce 	json,xml,application/yaml,text/csv,application/msgpack,application/problem+json
 // @Success 	200 {array}  dto.UserDTO
-// @Failure 	500 {object} gserrors.Error
+// @Failure 	406 {object} apierrors.Problem
+// @Failure 	500 {object} apierrors.Problem
+// @Failure 	502 {object} apierrors.Problem
+// @Failure 	503 {object} apierrors.Problem
 // @Router 		/users [get]
-func GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, gserror := service.FindUsers(r.Context())
+func GetUsers(ctx context.Context, _ gshandler.NoBody) ([]dto.UserDTO, error) {
+	users, gserror := service.FindUsers(ctx)
 	if gserror != nil {
-		gsrender.WriteJSON(w, http.StatusInternalServerError, gserror)
-		return
+		return nil, gserror
 	}
-	var userDTOs []dto.UserDTO
-	err := dtomapper.Map(userDTOs, users)
+	userDTOs := []dto.UserDTO{}
+	err := dtomapper.Map(&userDTOs, users)
 	if err != nil {
-		gslog.ErrorFrom(err, gsmiddleware.GetTraceID(r.Context()))
-		gsrender.WriteJSON(w, http.StatusInternalServerError, apierrors.New(apierrors.INTERNAL_SERVER_ERROR))
-		return
+		return nil, apierrors.Wrap(apierrors.INTERNAL_SERVER_ERROR, err, "mapping users to DTOs")
 	}
-	gsrender.WriteJSON(w, http.StatusOK, users)
+	return userDTOs, nil
 }
 
 // PostUser godoc
@@ -45,34 +43,29 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 // @Description Permite crear un nuevo usuario
 // @ID 			post-user
 // @Tags 		Users
+// @Accept 		json
+// @Produce 	json,xml,application/yaml,text/csv,application/msgpack,application/problem+json
+// @Param 		user body dto.CreateUserRequestDTO true "The user to create"
 // @Success 	201
-// @Failure 	500 {object} gserrors.Error
+// @Failure 	400 {object} apierrors.Problem
+// @Failure 	406 {object} apierrors.Problem
+// @Failure 	415 {object} apierrors.Problem
+// @Failure 	500 {object} apierrors.Problem
+// @Failure 	502 {object} apierrors.Problem
+// @Failure 	503 {object} apierrors.Problem
 // @Router 		/users [post]
-func PostUser(w http.ResponseWriter, r *http.Request) {
-
-	var reqDTO dto.CreateUserRequestDTO
-	if httpSuggestion := gsvalidation.DecodeJSONRequestBody(r, &reqDTO); httpSuggestion != nil {
-		code := apierrors.INTERNAL_SERVER_ERROR
-		if httpSuggestion.Status != 500 {
-			code = apierrors.INVALID_ARGUMENT
-		}
-		gsrender.WriteJSON(w, httpSuggestion.Status, apierrors.NewWithMsg(code, httpSuggestion.Message))
-		return
-	}
+func PostUser(ctx context.Context, reqDTO dto.CreateUserRequestDTO) (gshandler.NoBody, error) {
 
 	var reqModel model.CreateUserRequest
 	err := dtomapper.Map(&reqModel, &reqDTO)
 	if err != nil {
-		gslog.ErrorFrom(err, gsmiddleware.GetTraceID(r.Context()))
-		gsrender.WriteJSON(w, http.StatusInternalServerError, apierrors.New(apierrors.INTERNAL_SERVER_ERROR))
-		return
+		return gshandler.NoBody{}, apierrors.Wrap(apierrors.INTERNAL_SERVER_ERROR, err, "mapping request DTO to model")
 	}
-	gserror := service.CreateUser(r.Context(), reqModel)
+	gserror := service.CreateUser(ctx, reqModel)
 	if gserror != nil {
-		gsrender.WriteJSON(w, http.StatusInternalServerError, gserror)
-		return
+		return gshandler.NoBody{}, gserror
 	}
-	gsrender.Status(w, http.StatusCreated)
+	return gshandler.NoBody{}, nil
 }
 
 // GetUserById godoc
@@ -80,37 +73,34 @@ func PostUser(w http.ResponseWriter, r *http.Request) {
 // @Description Permite la búsqueda de un usuario a través de su ID
 // @ID 			get-user-by-id
 // @Tags 		Users
+// @Produce 	json,xml,application/yaml,text/csv,application/msgpack,application/problem+json
 // @Param 		id 	path 	 int true "The ID of a user"
 // @Success 	200 {object} dto.UserDTO
+// @Failure 	400 {object} apierrors.Problem
+// @Failure 	404 {object} apierrors.Problem
+// @Failure 	406 {object} apierrors.Problem
+// @Failure 	500 {object} apierrors.Problem
+// @Failure 	502 {object} apierrors.Problem
+// @Failure 	503 {object} apierrors.Problem
 // @Router 		/users/{id} [get]
-func GetUserById(w http.ResponseWriter, r *http.Request) {
+func GetUserById(ctx context.Context, _ gshandler.NoBody) (*dto.UserDTO, error) {
 
-	strID := chi.URLParam(r, "id")
+	strID := chi.URLParamFromCtx(ctx, "id")
 
 	userID, e := strconv.Atoi(strID)
 	if (e != nil) {
-		gsrender.WriteJSON(w, http.StatusBadRequest, apierrors.New(apierrors.INVALID_ARGUMENT))
-		return
+		return nil, apierrors.Wrap(apierrors.INVALID_ARGUMENT, e, "parsing user id").WithDetail("id", strID)
 	}
 	
-	user, gserror := service.FindUserById(r.Context(),userID)
+	user, gserror := service.FindUserById(ctx, userID)
 	if gserror != nil {
-		gsrender.WriteJSON(w, http.StatusInternalServerError, gserror)
-		return
-	}
-
-	if (user == nil) {
-		gslog.ErrorFrom(gserror, gsmiddleware.GetTraceID(r.Context()))
-		gsrender.WriteJSON(w, http.StatusNotFound, apierrors.New(apierrors.USER_NOT_FOUND))
-		return
+		return nil, gserror
 	}
 
 	var userDTO dto.UserDTO
 	err := dtomapper.Map(&userDTO, &user)
 	if err != nil {
-		gslog.ErrorFrom(err, gsmiddleware.GetTraceID(r.Context()))
-		gsrender.WriteJSON(w, http.StatusInternalServerError, apierrors.New(apierrors.INTERNAL_SERVER_ERROR))
-		return
+		return nil, apierrors.Wrap(apierrors.INTERNAL_SERVER_ERROR, err, "mapping user to DTO")
 	}
-	gsrender.WriteJSON(w, http.StatusOK, userDTO)
+	return &userDTO, nil
 }
\ No newline at end of file
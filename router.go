@@ -3,9 +3,7 @@ package main
 import (
 	"goserver/apierrors"
 	"goserver/presentation/controller"
-	"goserver/utils/gslog"
-	"goserver/utils/gsmiddleware"
-	"goserver/utils/gsrender"
+	"goserver/utils/gshandler"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
@@ -22,27 +20,27 @@ func Routes(r *chi.Mux) {
 
 		// Health.
 		r.Get("/health", controller.CheckHealth)
+		r.Get("/health/live", controller.CheckLiveness)
+		r.Get("/health/ready", controller.CheckReadiness)
 
 		// Users.
 		r.Route("/users", func(r chi.Router) {
-			r.Post("/", controller.PostUser)
-			r.Get("/", controller.GetUsers)
-			r.Get("/{id}", controller.GetUserById)
+			r.Method(http.MethodPost, "/", gshandler.Typed(http.StatusCreated, controller.PostUser))
+			r.Method(http.MethodGet, "/", gshandler.Typed(http.StatusOK, controller.GetUsers))
+			r.Method(http.MethodGet, "/{id}", gshandler.Typed(http.StatusOK, controller.GetUserById))
 		})
 
 		// Questions.
 		r.Route("/identity-validation", func(r chi.Router) {
-			r.Post("/questions", controller.GetQuestions)
+			r.Method(http.MethodPost, "/questions", gshandler.Func(controller.GetQuestions))
 		})
 	})
 
 	// No matching path.
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		// Trace ID.
-		traceID := gsmiddleware.GetTraceID(r.Context())
-
-		err := apierrors.New(apierrors.OPERATION_NOT_DEFINED)
-		gslog.ErrorFrom(err, traceID)
-		gsrender.WriteJSON(w, http.StatusNotFound, err)
+		err := apierrors.New(apierrors.OPERATION_NOT_DEFINED).
+			WithParam("method", r.Method).
+			WithParam("path", r.URL.Path)
+		apierrors.Handle(w, r, err)
 	})
 }
\ No newline at end of file
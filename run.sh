@@ -1 +1 @@
-go run main.go router.go
\ No newline at end of file
+go run . serve "$@"
\ No newline at end of file
@@ -5,18 +5,16 @@ import (
 	"goserver/apierrors"
 	"goserver/client/mockclient"
 	"goserver/model"
-	"goserver/utils/gslog"
-	"goserver/utils/gsmiddleware"
 
 	dtomapper "github.com/dranikpg/dto-mapper"
 )
 
 func FindUsers(ctx context.Context) ([]model.User, *apierrors.Error) {
 	
-	users, err := mockclient.GetUsers(ctx)
-	if err != nil {
-		gslog.ErrorFrom(err, gsmiddleware.GetTraceID(ctx))
-		return nil, apierrors.New(apierrors.EXTERNAL_API_ERROR)
+	users, apierror := mockclient.GetUsers(ctx)
+	if apierror != nil {
+		gserror := externalError(apierror, "finding users")
+		return nil, gserror
 	}
 
 	var resp []model.User
@@ -24,11 +22,9 @@ func FindUsers(ctx context.Context) ([]model.User, *apierrors.Error) {
 	for _, user := range users {
 		u, err := user.ToModel()
 		if err != nil {
-			gslog.Error(err.Error(), gsmiddleware.GetTraceID(ctx))
-			return []model.User{}, apierrors.NewWithMsg(
-				apierrors.INTERNAL_SERVER_ERROR,
-				"Error found while mapping external API schema to model",
-			)
+			gserror := apierrors.Wrap(apierrors.INTERNAL_SERVER_ERROR, err, "mapping external API schema to model").
+				WithStack()
+			return []model.User{}, gserror
 		}
 		resp = append(resp, *u)
 	}
@@ -40,17 +36,16 @@ func FindUserById(ctx context.Context, id int) (*model.User, *apierrors.Error) {
 	
 	user, apierror := mockclient.GetUserById(ctx, id)
 	if apierror != nil {
-		gslog.ErrorFrom(apierror, gsmiddleware.GetTraceID(ctx))
-		return nil, apierrors.New(apierrors.EXTERNAL_API_ERROR)
+		gserror := externalError(apierror, "finding user by id").WithDetail("user_id", id)
+		return nil, gserror
 	}
 
 	u, err := user.ToModel()
 	if err != nil {
-		gslog.Error(err.Error(), gsmiddleware.GetTraceID(ctx))
-		return nil, apierrors.NewWithMsg(
-			apierrors.INTERNAL_SERVER_ERROR,
-			"Error found while mapping external API schema to model",
-		)
+		gserror := apierrors.Wrap(apierrors.INTERNAL_SERVER_ERROR, err, "mapping external API schema to model").
+			WithDetail("user_id", id).
+			WithStack()
+		return nil, gserror
 	}
 	
 	return u, nil
@@ -61,15 +56,30 @@ func CreateUser(ctx context.Context, createUserRequest model.CreateUserRequest)
 	var createUserCDO mockclient.CreateUserCDO
 	err := dtomapper.Map(&createUserCDO, &createUserRequest)
 	if err != nil {
-		gslog.ErrorFrom(err, gsmiddleware.GetTraceID(ctx))
-		return apierrors.New(apierrors.INTERNAL_SERVER_ERROR)
+		gserror := apierrors.Wrap(apierrors.INTERNAL_SERVER_ERROR, err, "mapping user to CDO").WithStack()
+		return gserror
 	}
 
-	gserror := mockclient.PostUser(ctx, createUserCDO)
-	if gserror != nil {
-		gslog.ErrorFrom(err, gsmiddleware.GetTraceID(ctx))
-		return apierrors.New(apierrors.EXTERNAL_API_ERROR)
+	apierror := mockclient.PostUser(ctx, createUserCDO)
+	if apierror != nil {
+		gserror := externalError(apierror, "creating user")
+		return gserror
 	}
 
 	return nil
 }
+
+// externalError hides the details of an error returned by a client behind an
+// EXTERNAL_API_ERROR wrapping it, with msg as its internal message, except
+// when the dependency is unavailable, which is informed with that code so the
+// caller can tell the client to try again later. Business errors, like
+// USER_NOT_FOUND, are already meant for the client and returned as they are.
+func externalError(err *apierrors.Error, msg string) *apierrors.Error {
+	switch err.Code {
+	case apierrors.USER_NOT_FOUND:
+		return err
+	case apierrors.DEPENDENCY_UNAVAILABLE:
+		return apierrors.Wrap(apierrors.DEPENDENCY_UNAVAILABLE, err, msg)
+	}
+	return apierrors.Wrap(apierrors.EXTERNAL_API_ERROR, err, msg)
+}
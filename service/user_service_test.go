@@ -0,0 +1,34 @@
+package service
+
+import (
+	"errors"
+	"goserver/apierrors"
+	"testing"
+)
+
+func TestExternalError(t *testing.T) {
+	tests := []struct {
+		code apierrors.ErrorCode
+		want apierrors.ErrorCode
+	}{
+		{apierrors.USER_NOT_FOUND, apierrors.USER_NOT_FOUND},
+		{apierrors.DEPENDENCY_UNAVAILABLE, apierrors.DEPENDENCY_UNAVAILABLE},
+		{apierrors.HTTP_CONNECTION_ERROR, apierrors.EXTERNAL_API_ERROR},
+		{apierrors.EXTERNAL_API_ERROR, apierrors.EXTERNAL_API_ERROR},
+		{apierrors.RESPONSE_UNMARSHAL_ERROR, apierrors.EXTERNAL_API_ERROR},
+	}
+	for _, tt := range tests {
+		cause := apierrors.New(tt.code)
+		got := externalError(cause, "finding user by id")
+		if got.Code != tt.want || !errors.Is(got, cause) {
+			t.Errorf("externalError(%s) = %s, want %s", cause.Label, got.Label, apierrors.New(tt.want).Label)
+		}
+	}
+}
+
+func TestExternalErrorKeepsUserNotFound(t *testing.T) {
+	cause := apierrors.New(apierrors.USER_NOT_FOUND).WithParam("user_id", 7)
+	if got := externalError(cause, "finding user by id"); got != cause {
+		t.Errorf("externalError = %v, want the USER_NOT_FOUND with its params", got)
+	}
+}
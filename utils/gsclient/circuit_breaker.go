@@ -0,0 +1,336 @@
+package gsclient
+
+import (
+	"errors"
+	"fmt"
+	"goserver/utils/gslog"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gstime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultFailureRateThreshold is the default fraction of failed requests, among
+// the last ones in the window, that opens the circuit.
+const defaultFailureRateThreshold = 0.5
+
+// defaultWindowSize is the default number of recent requests taken into
+// account when calculating the failure rate.
+const defaultWindowSize = 20
+
+// defaultMinRequests is the default minimum number of requests in the window
+// before the failure rate is evaluated.
+const defaultMinRequests = 10
+
+// defaultConsecutiveFailures is the default number of consecutive failures
+// that opens the circuit, regardless of the failure rate.
+const defaultConsecutiveFailures = 5
+
+// defaultCoolDown is the default time the circuit stays open before letting
+// probe requests through.
+const defaultCoolDown = 30 * time.Second
+
+// defaultHalfOpenProbes is the default number of requests allowed while the
+// circuit is half-open. If all of them succeed, the circuit is closed.
+const defaultHalfOpenProbes = 3
+
+// ErrCircuitOpen is returned by a CircuitBreakerTransport when the circuit of
+// the client is open and the request is rejected without being sent.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState represents the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	CIRCUIT_CLOSED    CircuitState = 0
+	CIRCUIT_HALF_OPEN CircuitState = 1
+	CIRCUIT_OPEN      CircuitState = 2
+)
+
+// String returns the name of the state, as used in logs.
+func (s CircuitState) String() string {
+	switch s {
+	case CIRCUIT_CLOSED:
+		return "CLOSED"
+	case CIRCUIT_HALF_OPEN:
+		return "HALF_OPEN"
+	case CIRCUIT_OPEN:
+		return "OPEN"
+	}
+	return "UNKNOWN"
+}
+
+// CircuitBreakerConfig contains the configuration properties of the circuit
+// breaker of a Client. Every field is optional and, if not set, its default
+// is used.
+type CircuitBreakerConfig struct {
+
+	// FailureRateThreshold is the fraction (between 0 and 1) of failed requests
+	// in the window that opens the circuit.
+	FailureRateThreshold *float64         `json:"failure_rate_threshold"`
+
+	// WindowSize is the number of most recent requests used to calculate the
+	// failure rate.
+	WindowSize           *int             `json:"window_size"`
+
+	// MinRequests is the minimum number of requests in the window before the
+	// failure rate is evaluated.
+	MinRequests          *int             `json:"min_requests"`
+
+	// ConsecutiveFailures is the number of consecutive failures that opens
+	// the circuit. A value of 0 disables it, so only the failure rate is
+	// evaluated.
+	ConsecutiveFailures  *int             `json:"consecutive_failures"`
+
+	// CoolDown specifies the duration the circuit stays open before
+	// moving to half-open.
+	CoolDown             *gstime.Duration `json:"cool_down"`
+
+	// HalfOpenProbes is the number of requests let through while the circuit
+	// is half-open.
+	HalfOpenProbes       *int             `json:"half_open_probes"`
+}
+
+// CircuitBreaker keeps track of the result of the requests made to a backend
+// and stops sending them while the backend is considered down.
+//
+// While closed, every request is sent. Once the failure rate or the number of
+// consecutive failures reaches its threshold, the circuit opens and every
+// request is rejected with ErrCircuitOpen. After the cool-down, the circuit
+// becomes half-open and lets a limited number of probes through: if all of
+// them succeed the circuit closes, and if any fails it opens again.
+type CircuitBreaker struct {
+
+	// Key identifies the breaker in logs and metrics. It's the key of the
+	// client that owns it.
+	Key                  string
+
+	FailureRateThreshold float64
+	MinRequests          int
+	ConsecutiveFailures  int
+	CoolDown             time.Duration
+	HalfOpenProbes       int
+
+	// mu synchronizes the access to the breaker state, shared by every
+	// request made with the client.
+	mu                   sync.Mutex
+	state                CircuitState
+	openedAt             time.Time
+
+	// window is a ring buffer with the result of the most recent requests
+	// (true meaning failure).
+	window               []bool
+	next                 int
+	count                int
+	failures             int
+	consecutive          int
+
+	// probes and successes count the requests sent and succeeded while the
+	// circuit is half-open.
+	probes               int
+	successes            int
+
+	// generation is incremented on every change of state, so that the results
+	// of requests allowed in a previous state are ignored (see Ticket).
+	generation           uint64
+
+	// config is the configuration the breaker was built from.
+	config               CircuitBreakerConfig
+}
+
+// Ticket identifies a request allowed by a CircuitBreaker. Its result is only
+// recorded if the state of the breaker didn't change since it was allowed: a
+// slow request sent while the circuit was closed doesn't count as a probe once
+// it's half-open.
+type Ticket struct {
+	generation uint64
+}
+
+// NewCircuitBreaker builds a closed CircuitBreaker from the given
+// CircuitBreakerConfig, using the package defaults for every field not set.
+// Its state is not published in the metrics until it changes or the registry
+// of its client is made current (see SetRegistry).
+func NewCircuitBreaker(key string, bc CircuitBreakerConfig) *CircuitBreaker {
+	windowSize := defaultWindowSize
+	if bc.WindowSize != nil && *bc.WindowSize > 0 {
+		windowSize = *bc.WindowSize
+	}
+	cb := &CircuitBreaker{
+		Key:                  key,
+		FailureRateThreshold: defaultFailureRateThreshold,
+		MinRequests:          defaultMinRequests,
+		ConsecutiveFailures:  defaultConsecutiveFailures,
+		CoolDown:             bc.CoolDown.Or(defaultCoolDown),
+		HalfOpenProbes:       defaultHalfOpenProbes,
+		window:               make([]bool, windowSize),
+		config:               bc,
+	}
+	if bc.FailureRateThreshold != nil {
+		cb.FailureRateThreshold = *bc.FailureRateThreshold
+	}
+	if bc.MinRequests != nil {
+		cb.MinRequests = *bc.MinRequests
+	}
+	if bc.ConsecutiveFailures != nil {
+		cb.ConsecutiveFailures = *bc.ConsecutiveFailures
+	}
+	if bc.HalfOpenProbes != nil && *bc.HalfOpenProbes > 0 {
+		cb.HalfOpenProbes = *bc.HalfOpenProbes
+	}
+	return cb
+}
+
+// State returns the current state of the breaker.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.refresh()
+	return cb.state
+}
+
+// Allow reports whether a new request can be sent. If it returns true, the
+// caller must report the result of the request with Done, or release it with
+// Cancel, passing the Ticket returned.
+func (cb *CircuitBreaker) Allow() (Ticket, bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.refresh()
+	switch cb.state {
+	case CIRCUIT_OPEN:
+		return Ticket{}, false
+	case CIRCUIT_HALF_OPEN:
+		if cb.probes >= cb.HalfOpenProbes {
+			return Ticket{}, false
+		}
+		cb.probes++
+	}
+	return Ticket{generation: cb.generation}, true
+}
+
+// Done records the result of a request previously allowed by Allow. It's
+// ignored if the state changed since then.
+func (cb *CircuitBreaker) Done(t Ticket, failed bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if t.generation != cb.generation {
+		return
+	}
+
+	switch cb.state {
+	case CIRCUIT_HALF_OPEN:
+		if failed {
+			cb.setState(CIRCUIT_OPEN)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.HalfOpenProbes {
+			cb.setState(CIRCUIT_CLOSED)
+		}
+	case CIRCUIT_CLOSED:
+		cb.record(failed)
+		if cb.ConsecutiveFailures > 0 && cb.consecutive >= cb.ConsecutiveFailures {
+			cb.setState(CIRCUIT_OPEN)
+			return
+		}
+		if cb.count >= cb.MinRequests && float64(cb.failures)/float64(cb.count) >= cb.FailureRateThreshold {
+			cb.setState(CIRCUIT_OPEN)
+		}
+	}
+}
+
+// Cancel releases a request previously allowed by Allow without recording
+// its result, freeing its probe slot if it was allowed as a probe of the
+// current half-open state.
+func (cb *CircuitBreaker) Cancel(t Ticket) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if t.generation == cb.generation && cb.state == CIRCUIT_HALF_OPEN && cb.probes > 0 {
+		cb.probes--
+	}
+}
+
+// record adds a result to the window, replacing the oldest one once full.
+func (cb *CircuitBreaker) record(failed bool) {
+	if cb.count == len(cb.window) {
+		if cb.window[cb.next] {
+			cb.failures--
+		}
+	} else {
+		cb.count++
+	}
+	cb.window[cb.next] = failed
+	cb.next = (cb.next + 1) % len(cb.window)
+	if failed {
+		cb.failures++
+		cb.consecutive++
+	} else {
+		cb.consecutive = 0
+	}
+}
+
+// refresh moves an open circuit to half-open once its cool-down is over.
+// Must be called with the mutex held.
+func (cb *CircuitBreaker) refresh() {
+	if cb.state == CIRCUIT_OPEN && time.Since(cb.openedAt) >= cb.CoolDown {
+		cb.setState(CIRCUIT_HALF_OPEN)
+	}
+}
+
+// setState changes the state of the breaker, resetting its counters, and
+// reports the change in logs and metrics. Must be called with the mutex held.
+func (cb *CircuitBreaker) setState(s CircuitState) {
+	if cb.state == s {
+		return
+	}
+	gslog.Warn(fmt.Sprintf("Circuit breaker of client %s changed from %s to %s", cb.Key, cb.state, s), "")
+	cb.state = s
+	cb.generation++
+	cb.probes = 0
+	cb.successes = 0
+	if s == CIRCUIT_OPEN {
+		cb.openedAt = time.Now()
+	}
+	if s == CIRCUIT_CLOSED {
+		for i := range cb.window {
+			cb.window[i] = false
+		}
+		cb.next, cb.count, cb.failures, cb.consecutive = 0, 0, 0, 0
+	}
+	gsmiddleware.SetCircuitBreakerState(cb.Key, int(s))
+}
+
+// CircuitBreakerTransport wraps an http.RoundTripper rejecting requests while
+// the circuit of its CircuitBreaker is open.
+type CircuitBreakerTransport struct {
+
+	// Base defines the implementation of http.RoundTripper wrapped by this
+	// Transport. It's only called if the breaker allows the request.
+	Base    http.RoundTripper
+
+	// Breaker keeps the state of the circuit.
+	Breaker *CircuitBreaker
+}
+
+// Implements http.RoundTripper so it can be used as a Transport.
+// Transport errors and 5xx responses are considered failures. Errors caused by
+// the request's context being done are not recorded at all.
+func (ct *CircuitBreakerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+
+	ticket, ok := ct.Breaker.Allow()
+	if !ok {
+		return nil, fmt.Errorf("request to client %s rejected: %w", ct.Breaker.Key, ErrCircuitOpen)
+	}
+
+	resp, err := ct.Base.RoundTrip(r)
+	switch {
+	case err != nil && r.Context().Err() != nil:
+		// The caller gave up: this says nothing about the backend health.
+		ct.Breaker.Cancel(ticket)
+	case err != nil:
+		ct.Breaker.Done(ticket, true)
+	default:
+		ct.Breaker.Done(ticket, resp.StatusCode >= http.StatusInternalServerError)
+	}
+	return resp, err
+}
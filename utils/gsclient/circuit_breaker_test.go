@@ -0,0 +1,212 @@
+package gsclient
+
+import (
+	"context"
+	"errors"
+	"goserver/utils/gstime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// breakerConfig returns a config with the given consecutive failures and
+// failure rate evaluated after 4 requests.
+func breakerConfig(consecutive int, coolDown time.Duration) CircuitBreakerConfig {
+	rate := 0.5
+	window := 4
+	minRequests := 4
+	probes := 2
+	d := gstime.Duration(coolDown)
+	return CircuitBreakerConfig{
+		FailureRateThreshold: &rate,
+		WindowSize:           &window,
+		MinRequests:          &minRequests,
+		ConsecutiveFailures:  &consecutive,
+		CoolDown:             &d,
+		HalfOpenProbes:       &probes,
+	}
+}
+
+// report makes a request through the breaker with the given result.
+func report(t *testing.T, cb *CircuitBreaker, failed bool) {
+	t.Helper()
+	ticket, ok := cb.Allow()
+	if !ok {
+		t.Fatalf("request rejected in state %s", cb.State())
+	}
+	cb.Done(ticket, failed)
+}
+
+// allow makes the breaker allow a request, failing the test if it's rejected.
+func allow(t *testing.T, cb *CircuitBreaker) Ticket {
+	t.Helper()
+	ticket, ok := cb.Allow()
+	if !ok {
+		t.Fatalf("request rejected in state %s", cb.State())
+	}
+	return ticket
+}
+
+func TestCircuitBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	cb := NewCircuitBreaker("test", breakerConfig(2, time.Hour))
+
+	report(t, cb, true)
+	if cb.State() != CIRCUIT_CLOSED {
+		t.Fatalf("state = %s after one failure, want CLOSED", cb.State())
+	}
+	report(t, cb, true)
+	if cb.State() != CIRCUIT_OPEN {
+		t.Fatalf("state = %s after two failures, want OPEN", cb.State())
+	}
+	if _, ok := cb.Allow(); ok {
+		t.Error("request allowed while OPEN")
+	}
+}
+
+func TestCircuitBreakerZeroConsecutiveFailuresIsDisabled(t *testing.T) {
+	cb := NewCircuitBreaker("test", breakerConfig(0, time.Hour))
+
+	report(t, cb, false)
+	report(t, cb, true)
+	report(t, cb, false)
+	if cb.State() != CIRCUIT_CLOSED {
+		t.Fatalf("state = %s, want CLOSED", cb.State())
+	}
+}
+
+func TestCircuitBreakerOpensOnFailureRate(t *testing.T) {
+	cb := NewCircuitBreaker("test", breakerConfig(0, time.Hour))
+
+	report(t, cb, true)
+	report(t, cb, false)
+	report(t, cb, true)
+	if cb.State() != CIRCUIT_CLOSED {
+		t.Fatalf("state = %s before min_requests, want CLOSED", cb.State())
+	}
+	report(t, cb, false)
+	if cb.State() != CIRCUIT_OPEN {
+		t.Fatalf("state = %s with a failure rate of 0.5, want OPEN", cb.State())
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	cb := NewCircuitBreaker("test", breakerConfig(1, 10*time.Millisecond))
+	report(t, cb, true)
+	time.Sleep(20 * time.Millisecond)
+
+	if cb.State() != CIRCUIT_HALF_OPEN {
+		t.Fatalf("state = %s after the cool-down, want HALF_OPEN", cb.State())
+	}
+	first, second := allow(t, cb), allow(t, cb)
+	if _, ok := cb.Allow(); ok {
+		t.Fatal("more probes than half_open_probes allowed")
+	}
+	cb.Done(first, false)
+	cb.Done(second, false)
+	if cb.State() != CIRCUIT_CLOSED {
+		t.Fatalf("state = %s after the probes succeeded, want CLOSED", cb.State())
+	}
+}
+
+func TestCircuitBreakerFailedProbeReopens(t *testing.T) {
+	cb := NewCircuitBreaker("test", breakerConfig(1, 10*time.Millisecond))
+	report(t, cb, true)
+	time.Sleep(20 * time.Millisecond)
+
+	report(t, cb, true)
+	if cb.State() != CIRCUIT_OPEN {
+		t.Fatalf("state = %s after a failed probe, want OPEN", cb.State())
+	}
+}
+
+func TestCircuitBreakerIgnoresRequestsOfPreviousState(t *testing.T) {
+	cb := NewCircuitBreaker("test", breakerConfig(1, 10*time.Millisecond))
+	slow := allow(t, cb)
+	report(t, cb, true)
+	time.Sleep(20 * time.Millisecond)
+	if cb.State() != CIRCUIT_HALF_OPEN {
+		t.Fatalf("state = %s after the cool-down, want HALF_OPEN", cb.State())
+	}
+
+	// The request allowed while CLOSED is neither a probe nor frees a slot.
+	cb.Done(slow, false)
+	cb.Done(slow, false)
+	cb.Cancel(slow)
+	if cb.State() != CIRCUIT_HALF_OPEN {
+		t.Fatalf("state = %s after a request of the CLOSED state succeeded, want HALF_OPEN", cb.State())
+	}
+	allow(t, cb)
+	allow(t, cb)
+	if _, ok := cb.Allow(); ok {
+		t.Error("more probes than half_open_probes allowed")
+	}
+}
+
+func TestCircuitBreakerCancelFreesProbe(t *testing.T) {
+	cb := NewCircuitBreaker("test", breakerConfig(1, 10*time.Millisecond))
+	report(t, cb, true)
+	time.Sleep(20 * time.Millisecond)
+
+	probe := allow(t, cb)
+	allow(t, cb)
+	cb.Cancel(probe)
+	allow(t, cb)
+	if _, ok := cb.Allow(); ok {
+		t.Error("more probes than half_open_probes allowed")
+	}
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	ct := &CircuitBreakerTransport{Base: http.DefaultTransport, Breaker: NewCircuitBreaker("test", breakerConfig(1, time.Hour))}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := ct.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	_, err = ct.RoundTrip(req)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestCircuitBreakerTransportIgnoresCanceledRequests(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	ct := &CircuitBreakerTransport{Base: http.DefaultTransport, Breaker: NewCircuitBreaker("test", breakerConfig(1, time.Hour))}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if _, err := ct.RoundTrip(req); err == nil {
+		t.Fatal("expected an error for a canceled request")
+	}
+	if ct.Breaker.State() != CIRCUIT_CLOSED {
+		t.Fatalf("state = %s after a canceled request, want CLOSED", ct.Breaker.State())
+	}
+}
+
+func TestResponseErrorIsCircuitOpen(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	bc := breakerConfig(1, time.Hour)
+	c, _ := newTestRegistry(t, srv.URL, &bc).GetClient("test")
+
+	_, rerr := Get[struct{}, struct{}](context.Background(), c, "/")
+	if rerr == nil || !rerr.IsErrorResponse() || rerr.IsCircuitOpen() {
+		t.Fatalf("err = %v, want the error response", rerr)
+	}
+	_, rerr = Get[struct{}, struct{}](context.Background(), c, "/")
+	if rerr == nil || !rerr.IsTransportError() || !rerr.IsCircuitOpen() {
+		t.Fatalf("err = %v, want the request rejected by the open circuit", rerr)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"goserver/utils/gsmiddleware"
+	"goserver/utils/gstime"
+	"goserver/utils/gstrace"
 	"io"
 	"net/http"
 	"net/url"
@@ -17,51 +19,61 @@ import (
 // The timeout includes connection time, any redirects, and reading the response body.
 var defaultTimeout = 30 * time.Second
 
-// clients contains all configured clients.
-var clients map[string]*Client
-
 // ClientConfig contains all the information needed to construct a new Client.
 type ClientConfig struct {
 
-	// Key used in the internal clients map to store and retrieve the client.
-	Key            string             `json:"key"`
+	// Key used in the registry to store and retrieve the client.
+	Key            string                `json:"key"`
 
 	// Basepath to be used by the client in every of its http requests.
-	Basepath       string             `json:"basepath"`
+	Basepath       string                `json:"basepath"`
 
 	// Transport specifies any middleware used for the outgoing http requests.
 	// If not defined, the DefaultTransport function will set this field.
-	Transport      *http.RoundTripper
+	Transport      *http.RoundTripper    `json:"-"`
 
-	// Timeout specifies the duration in seconds to wait for an http response
+	// Timeout specifies the duration to wait for an http response
 	// from the client.
 	// If not set, defaultTimeout will be used.
-	Timeout        *int               `json:"timeout"`
+	Timeout        *gstime.Duration      `json:"timeout"`
 
 	// DefaultHeaders define headers to be sent in every request.
-	DefaultHeaders *http.Header       `json:"default_headers"`
+	DefaultHeaders *http.Header          `json:"default_headers"`
 
 	// DefaultParams define query parameters to be sent in every request.
-	DefaultParams  *url.Values        `json:"default_params"`
+	DefaultParams  *url.Values           `json:"default_params"`
 
 	// SkipSSL may be used to skip ssl verify when calling an https endpoint
 	// whose certificate we can't validate.
 	// This should be used cautiously.
-	SkipSSL        bool               `json:"skip_ssl"`
+	SkipSSL        bool                  `json:"skip_ssl"`
 
 	// TokenSourceKey is used to configure a token source in the client. This
 	// token source should already be configured when adding this client.
 	// 
 	// If the client does not required Oauth 2.0 authentication, this field
 	// must be omited.
-	TokenSourceKey *string            `json:"token_source_key"`
+	TokenSourceKey *string               `json:"token_source_key"`
+
+	// Retry configures the retry policy of the client. If not set, failed
+	// requests are not retried.
+	Retry          *RetryConfig          `json:"retry"`
+
+	// CircuitBreaker configures the circuit breaker of the client. If not set,
+	// requests are always sent, no matter how many of them failed before.
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker"`
+
+	// HealthPath is the path, appended to the basepath, probed with a GET to
+	// know whether the external API is available. If not set, the client
+	// isn't checked.
+	HealthPath     *string               `json:"health_path"`
 }
 
 // Client contains all the information needed to interact with an external API via
 // HTTP protocol.
 type Client struct {
 
-	// Key used in the internal clients map to store and retrieve the client.
+	// Key used in the registry to store and retrieve the client.
 	Key            string
 
 	// Basepath to be used by the client in every of its http requests.
@@ -80,51 +92,62 @@ type Client struct {
 	// to authenticate all http requests made to this client. Once the token source
 	// is configured, the token handling is automatically.
 	TokenSource    *TokenSource
-}
 
-// Initialization. Only initializes the clients map.
-func init() {
-	clients = make(map[string]*Client)
+	// HealthPath is the path probed by CheckHealth. Empty if the client has
+	// no health check.
+	HealthPath     string
+
+	// transport is the http.Transport built by DefaultTransport, holding the
+	// connections of the client. Nil if the ClientConfig provided its own.
+	transport      *http.Transport
+
+	// breaker is the circuit breaker transport built by DefaultTransport, if
+	// the ClientConfig configures one.
+	breaker        *CircuitBreakerTransport
 }
 
-// GetClient retrieves a previously configured Client from the internal map. The
-// only way this will return false is by a lack of client configuration.
+// GetClient retrieves a previously configured Client from the current registry.
+// The only way this will return false is by a lack of client configuration.
 func GetClient(key string) (c *Client, ok bool) {
-	c, ok = clients[key]
-	return c, ok
+	return current().GetClient(key)
+}
+
+// NewClient creates a new Client in the current registry. See Registry.NewClient.
+func NewClient(cc ClientConfig) (*Client, error) {
+	return current().NewClient(cc)
 }
 
 // NewClient receives a ClientConfig struct containing all the information needed to
 // create a new Client. If no transport is provided, the DefaultTransport is used. 
 // Likewise, if no timeout is given, defaultTimeout is used.
-// Once the Client is created, it is added to the internal map with the provided
-// key.
+// Once the Client is created, it is added to the registry with the provided key.
 //
-// If the TokenSourceKey is present and doesn't reference an already configured
-// token source, an error is returned.
+// If the TokenSourceKey is present and doesn't reference a token source already
+// configured in the registry, an error is returned.
 //
-// Note: if there's already an existing Client in the internal map with the same
+// Note: if there's already an existing Client in the registry with the same
 // key, this is replaced with the new one.
-func NewClient(cc ClientConfig) (*Client, error) {
+func (reg *Registry) NewClient(cc ClientConfig) (*Client, error) {
 
 	// Get token source by its key, if any.
 	var tokenSource *TokenSource
 	if cc.TokenSourceKey != nil {
-		ts, ok := GetTokenSource(*cc.TokenSourceKey)
+		ts, ok := reg.GetTokenSource(*cc.TokenSourceKey)
 		if !ok {
 			return nil, fmt.Errorf("client configuration failed: couldn't find token source with key %s", *cc.TokenSourceKey)
 		}
 		tokenSource = ts
 	}
 
-	transport := DefaultTransport(cc.SkipSSL, tokenSource)
+	var transport http.RoundTripper
+	var base *http.Transport
+	var breaker *CircuitBreakerTransport
 	if cc.Transport != nil {
 		transport = *cc.Transport
+	} else {
+		transport, base, breaker = defaultTransport(cc, tokenSource)
 	}
-	timeout := defaultTimeout
-	if cc.Timeout != nil {
-		timeout = time.Duration(*cc.Timeout) * time.Second
-	}
+	timeout := cc.Timeout.Or(defaultTimeout)
 	headers := make(map[string][]string)
 	if cc.DefaultHeaders != nil {
 		headers = *cc.DefaultHeaders
@@ -133,6 +156,10 @@ func NewClient(cc ClientConfig) (*Client, error) {
 	if cc.DefaultParams != nil {
 		params = *cc.DefaultParams
 	}
+	healthPath := ""
+	if cc.HealthPath != nil {
+		healthPath = *cc.HealthPath
+	}
 	client := &Client{
 		Key: cc.Key,
 		Basepath: cc.Basepath,
@@ -143,21 +170,32 @@ func NewClient(cc ClientConfig) (*Client, error) {
 		DefaultHeaders: headers,
 		DefaultParams: params,
 		TokenSource: tokenSource,
+		HealthPath: healthPath,
+		transport: base,
+		breaker: breaker,
 	}
 
-	// Save (or overwrite) new client to internal map.
-	clients[cc.Key] = client
+	// Save (or overwrite) new client to the registry.
+	reg.mu.Lock()
+	reg.clients[cc.Key] = client
+	reg.mu.Unlock()
 
 	return client, nil
 }
 
-// ConfigureClients wraps NewClient function allowing the configuration of
-// multiple clients at once.
+// ConfigureClients configures multiple clients at once in the current registry.
+// See Registry.ConfigureClients.
 //
 // Function intended to be called from an application's configuration file.
 func ConfigureClients(ccs []ClientConfig) error {
+	return current().ConfigureClients(ccs)
+}
+
+// ConfigureClients wraps NewClient function allowing the configuration of
+// multiple clients at once.
+func (reg *Registry) ConfigureClients(ccs []ClientConfig) error {
 	for _, cc := range ccs {
-		_, err := NewClient(cc)
+		_, err := reg.NewClient(cc)
 		if err != nil {
 			return err
 		}
@@ -166,32 +204,74 @@ func ConfigureClients(ccs []ClientConfig) error {
 }
 
 // DefaultTransport return the default http.RoundTripper implementation of this
-// package. This includes a logging, a tracing, and an oauth transports.
+// package. This includes a logging, a retry, a tracing, an oauth, a circuit
+// breaker, a span (see gstrace.Transport) and a metrics transports.
 //
-// SSL verification can be skipped by sending "skipSSL" true.
+// SSL verification can be skipped by setting SkipSSL in the ClientConfig.
+// The retry and circuit breaker transports are only added if the ClientConfig
+// configures them.
 // To enable oauth transport, a token source must be provided.
-func DefaultTransport(skipSSL bool, ts *TokenSource) http.RoundTripper {
+func DefaultTransport(cc ClientConfig, ts *TokenSource) http.RoundTripper {
+	transport, _, _ := defaultTransport(cc, ts)
+	return transport
+}
+
+// defaultTransport builds the DefaultTransport, returning as well its
+// http.Transport and its circuit breaker transport (nil if not configured), so
+// that the Client can close its connections and keep its breaker on reloads.
+func defaultTransport(cc ClientConfig, ts *TokenSource) (http.RoundTripper, *http.Transport, *CircuitBreakerTransport) {
 	base := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: skipSSL},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: cc.SkipSSL},
+	}
+	var next http.RoundTripper = &gsmiddleware.HttpLogTransport{
+		Base: base,
+	}
+	if cc.Retry != nil {
+		next = &RetryTransport{
+			Base: next,
+			Policy: NewRetryPolicy(*cc.Retry),
+		}
+	}
+	next = &gsmiddleware.TracingTransport{
+		Base: next,
 	}
-	logging := &gsmiddleware.HttpLogTransport{
-		Base: *base,
+	if ts != nil {
+		next = &OauthTransport{
+			Base: next,
+			TokenSource: ts,
+		}
 	}
-	tracing := &gsmiddleware.TracingTransport{
-		Base: logging,
+	var breaker *CircuitBreakerTransport
+	if cc.CircuitBreaker != nil {
+		breaker = &CircuitBreakerTransport{
+			Base: next,
+			Breaker: NewCircuitBreaker(cc.Key, *cc.CircuitBreaker),
+		}
+		next = breaker
 	}
-	if ts == nil {
-		return tracing
+	next = &gstrace.Transport{
+		Base: next,
+		ClientKey: cc.Key,
 	}
-	return &OauthTransport{
-		Base: tracing,
-		TokenSource: ts,
+	return &gsmiddleware.MetricsTransport{
+		Base: next,
+		ClientKey: cc.Key,
+	}, base, breaker
+}
+
+// CloseIdleConnections closes the idle connections of the client, which are
+// kept open to be reused otherwise. Connections in use are not interrupted.
+func (c *Client) CloseIdleConnections() {
+	if c.transport != nil {
+		c.transport.CloseIdleConnections()
+		return
 	}
+	c.HttpClient.CloseIdleConnections()
 }
 
 // SetRequestDefaults adds the default headers and query parameters
 // configured for the given Client, if any, to an http.Request struct.
-func (c *Client) SetRequestDefaults(r http.Request) {
+func (c *Client) SetRequestDefaults(r *http.Request) {
 	
 	// Add default headers, if any.
 	for k, values := range c.DefaultHeaders {
@@ -217,7 +297,8 @@ func (c *Client) SetRequestDefaults(r http.Request) {
 // NewJSONRequest wraps http.NewRequestWithContext, adding JSON marshalling
 // instead of receiving an io.Reader directly.
 // In addition, receives only the operation path to be invoked, appending it
-// to the client's basepath.
+// to the client's basepath, and sets the client's default headers and query
+// parameters.
 func (c *Client) NewJSONRequest(ctx context.Context, method string, path string, v any) (*http.Request, error) {
 
 	var reader io.Reader
@@ -230,7 +311,42 @@ func (c *Client) NewJSONRequest(ctx context.Context, method string, path string,
 	}
 
 	url := c.Basepath + path
-	return http.NewRequestWithContext(ctx, method, url, reader)
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if v != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.SetRequestDefaults(req)
+	return req, nil
+}
+
+// CheckHealth makes a GET request to the client's HealthPath and returns an
+// error if it fails or its status is not 2xx. If the client has no HealthPath,
+// it's always considered healthy.
+//
+// Meant to be registered as a gshealth.CheckerFunc.
+func (c *Client) CheckHealth(ctx context.Context) error {
+	if c.HealthPath == "" {
+		return nil
+	}
+	ctx = gsmiddleware.WithCallKind(ctx, gsmiddleware.HEALTH_CHECK_CALL)
+	ctx = gsmiddleware.WithRouteTemplate(ctx, c.HealthPath)
+	req, err := c.NewRequest(ctx, http.MethodGet, c.HealthPath)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("health check of client %s answered with status %d", c.Key, resp.StatusCode)
+	}
+	return nil
 }
 
 // NewRequest wraps http.NewRequestWithContext receiving only the operation 
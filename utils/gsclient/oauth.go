@@ -4,53 +4,57 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gstime"
+	"goserver/utils/gstrace"
 	"goserver/utils/gsvalidation"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // defaultGrantType specifies the default grant type value to use when requesting
 // a new Oauth 2.0 token.
 const defaultGrantType = "client_credentials"
 
-// sources is the internal map of token sources. It's initialized empty and
-// populated by adding new sources by configuration.
-var sources map[string]*TokenSource
-
 // TokenSourceConfig contains the configuration properties needed to add a new 
 // token source to the internal map for later use.
 type TokenSourceConfig struct {
 
-	// Key is the entry used to set and access the token source in the source map.
-	Key          string         `json:"key"`
+	// Key is the entry used to set and access the token source in the registry.
+	Key          string           `json:"key"`
 
 	// ExpiryDelta is used to configure the token source's expiry delta. If not
 	// specified, defaultExpiryDelta is used.
-	ExpiryDelta  *time.Duration `json:"expiry_delta"`
+	ExpiryDelta  *gstime.Duration `json:"expiry_delta"`
 
 	// ClientID is the application's ID.
-	ClientID     string         `json:"client_id"`
+	ClientID     string           `json:"client_id"`
 
 	// ClientSecret is the application's secret.
-	ClientSecret string         `json:"client_secret"`
+	ClientSecret string           `json:"client_secret"`
 
 	// GrantType configures the grant type of the token source.
-	GrantType    *string        `json:"grant_type"`
+	GrantType    *string          `json:"grant_type"`
 
 	// Scopes specifies optional requested permissions.
-	Scopes       []string       `json:"scopes"`
+	Scopes       []string         `json:"scopes"`
 
 	// ClientKey is the key that allows to access the client used to request a new
 	// token. This client should already be configured when adding this token
 	// configuration.
-	ClientKey    string         `json:"client_key"`
+	ClientKey    string           `json:"client_key"`
 }
 
 type TokenSource struct {
 
+	// Key used in the registry to store and retrieve the token source.
+	Key          string
+
 	// ExpiryDelta is used to calculate when a token is considered expired, by
 	// subtracting it from the expiration date (Expiry).
 	ExpiryDelta  time.Duration
@@ -80,40 +84,39 @@ type TokenSource struct {
 	mu           sync.Mutex
 }
 
-// Initialization. Only initializes the sources map.
-func init() {
-	sources = make(map[string]*TokenSource)
+// GetTokenSource retrieves a previously configured TokenSource from the current
+// registry. The only way this will return false is by a lack of token source
+// configuration.
+func GetTokenSource(key string) (ts *TokenSource, ok bool) {
+	return current().GetTokenSource(key)
 }
 
-// GetTokenSource retrieves a previously configured TokenSource from the internal map.
-// The only way this will return false is by a lack of token source configuration.
-func GetTokenSource(key string) (ts *TokenSource, ok bool) {
-	ts, ok = sources[key]
-	return ts, ok
+// NewTokenSource creates a new TokenSource in the current registry. See
+// Registry.NewTokenSource.
+func NewTokenSource(tc TokenSourceConfig) (*TokenSource, error) {
+	return current().NewTokenSource(tc)
 }
 
 // NewTokenSource receives a TokenSourceConfig struct containing all the information
 // needed to create a new TokenSource.
 //
-// If the given ClientKey doesn't reference an already configured Client, an error 
-// is returned.
+// If the given ClientKey doesn't reference a Client already configured in the
+// registry, an error is returned.
 //
-// Note: if there's already an existing TokenSource in the internal map with the same
+// Note: if there's already an existing TokenSource in the registry with the same
 // key, this is replaced with the new one.
-func NewTokenSource(tc TokenSourceConfig) (*TokenSource, error) {
-	expiryDelta := defaultExpiryDelta
-	if tc.ExpiryDelta != nil {
-		expiryDelta = *tc.ExpiryDelta
-	}
+func (reg *Registry) NewTokenSource(tc TokenSourceConfig) (*TokenSource, error) {
+	expiryDelta := tc.ExpiryDelta.Or(defaultExpiryDelta)
 	grantType := defaultGrantType
 	if tc.GrantType != nil {
 		grantType = *tc.GrantType
 	}
-	client, ok := GetClient(tc.ClientKey)
+	client, ok := reg.GetClient(tc.ClientKey)
 	if !ok {
 		return nil, fmt.Errorf("token source configuration failed: couldn't find client with key %s", tc.ClientKey)
 	}
 	tokenSource := &TokenSource{
+		Key: tc.Key,
 		ExpiryDelta: expiryDelta,
 		ClientID: tc.ClientID,
 		ClientSecret: tc.ClientSecret,
@@ -121,17 +124,25 @@ func NewTokenSource(tc TokenSourceConfig) (*TokenSource, error) {
 		Scopes: tc.Scopes,
 		Client: *client,
 	}
-	sources[tc.Key] = tokenSource
+	reg.mu.Lock()
+	reg.sources[tc.Key] = tokenSource
+	reg.mu.Unlock()
 	return tokenSource, nil
 }
 
-// ConfigureTokenSources wraps NewTokenSource function allowing the configuration of
-// multiple token sources at once.
+// ConfigureTokenSources configures multiple token sources at once in the current
+// registry. See Registry.ConfigureTokenSources.
 //
 // Function intended to be called from an application's configuration file.
 func ConfigureTokenSources(tcs []TokenSourceConfig) error {
+	return current().ConfigureTokenSources(tcs)
+}
+
+// ConfigureTokenSources wraps NewTokenSource function allowing the configuration of
+// multiple token sources at once.
+func (reg *Registry) ConfigureTokenSources(tcs []TokenSourceConfig) error {
 	for _, tc := range tcs {
-		_, err := NewTokenSource(tc)
+		_, err := reg.NewTokenSource(tc)
 		if err != nil {
 			return err
 		}
@@ -139,6 +150,17 @@ func ConfigureTokenSources(tcs []TokenSourceConfig) error {
 	return nil
 }
 
+// sameCredentials reports whether both token sources request their tokens with
+// the same credentials and to the same endpoint, so that a token obtained by
+// one of them is valid for the other.
+func (ts *TokenSource) sameCredentials(other *TokenSource) bool {
+	return ts.ClientID == other.ClientID &&
+		ts.ClientSecret == other.ClientSecret &&
+		ts.GrantType == other.GrantType &&
+		strings.Join(ts.Scopes, ",") == strings.Join(other.Scopes, ",") &&
+		ts.Client.Basepath == other.Client.Basepath
+}
+
 // GetToken retrieves a valid token for the given token source. If there's a saved
 // one in memory and it's valid, returns it. Otherwise, calls RenewToken to get
 // a new one from the token source.
@@ -155,13 +177,35 @@ func (ts *TokenSource) GetToken(ctx context.Context) (*Token, error) {
 	return ts.RenewToken(ctx)
 }
 
+// CheckHealth reports whether the token source can currently provide a valid
+// token, either the stored one or a new one.
+//
+// Meant to be registered as a gshealth.CheckerFunc.
+func (ts *TokenSource) CheckHealth(ctx context.Context) error {
+	_, err := ts.GetToken(ctx)
+	return err
+}
+
 // RenewToken retrieves a new token from the token source and saves it to memory.
 // Uses the Client stored in the token source for the retrieval and the given
 // context to create the http.Request (to preserve tracing_id, etc.).
-func (ts *TokenSource) RenewToken(ctx context.Context) (*Token, error) {
+// The request is reported in metrics as a TOKEN_RENEWAL_CALL, within its own
+// span.
+func (ts *TokenSource) RenewToken(ctx context.Context) (token *Token, err error) {
 	
 	endpoint := ts.Client.Basepath
 
+	ctx, span := gstrace.Start(ctx, "token renewal "+ts.Key,
+		attribute.String("token_source.key", ts.Key),
+		attribute.String("client.key", ts.Client.Key),
+	)
+	defer func() {
+		gstrace.End(span, err)
+	}()
+
+	ctx = gsmiddleware.WithCallKind(ctx, gsmiddleware.TOKEN_RENEWAL_CALL)
+	ctx = gsmiddleware.WithRouteTemplate(ctx, "/")
+
 	data := url.Values{}
 	data.Set("client_id", ts.ClientID)
 	data.Set("client_secret", ts.ClientSecret)
@@ -184,11 +228,11 @@ func (ts *TokenSource) RenewToken(ctx context.Context) (*Token, error) {
 
 	var tokenCDO TokenCDO 
 
-	respType, err := gsvalidation.DecodeJSONResponseBody(resp, &tokenCDO, nil)
-	switch respType {
-	case gsvalidation.OK_RESPONSE:
+	res, err := gsvalidation.DecodeResponse(resp, &tokenCDO, nil)
+	switch {
+	case res.Type == gsvalidation.OK_RESPONSE && !res.Empty:
 		creationTime := time.Now()
-		token := &Token{
+		token = &Token{
 			TokenType: tokenCDO.TokenType,
 			AccessToken: tokenCDO.AccessToken,
 			CreationTime: creationTime,
@@ -196,8 +240,10 @@ func (ts *TokenSource) RenewToken(ctx context.Context) (*Token, error) {
 		}
 		ts.Token = token
 		return token, nil
-	default:
+	case err != nil:
 		return nil, err
+	default:
+		return nil, fmt.Errorf("error retrieving token from %s: status %d: %s", endpoint, res.Status, string(res.Body))
 	}
 
 }
\ No newline at end of file
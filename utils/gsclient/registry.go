@@ -0,0 +1,139 @@
+package gsclient
+
+import (
+	"goserver/utils/gsmiddleware"
+	"reflect"
+	"sync"
+)
+
+// registry is the Registry used by the package level functions (GetClient,
+// NewClient, etc.).
+var registry *Registry
+
+// registryMu synchronizes the replacement of the current registry.
+var registryMu sync.RWMutex
+
+// Registry contains a set of configured clients and token sources, accessible
+// by their keys. Its methods are safe for concurrent use.
+//
+// A new Registry can be built and filled in aside and then made current with
+// SetRegistry, so that a whole new configuration is applied at once.
+type Registry struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+	sources map[string]*TokenSource
+}
+
+// Initialization. Only initializes the current registry.
+func init() {
+	registry = NewRegistry()
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		clients: make(map[string]*Client),
+		sources: make(map[string]*TokenSource),
+	}
+}
+
+// current returns the current registry.
+func current() *Registry {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return registry
+}
+
+// SetRegistry replaces the current registry with the given one. Requests
+// already started with a client of the previous registry are not affected.
+//
+// Tokens of the previous registry are kept by those token sources whose key,
+// credentials and token client's basepath didn't change, so they don't need
+// to be renewed. Likewise, circuit breakers are kept by those clients whose
+// key and circuit breaker configuration didn't change, so an open circuit
+// stays open. Once replaced, the state of the circuit breakers is published
+// in the metrics and the idle connections of the previous clients are closed.
+func SetRegistry(reg *Registry) {
+	registryMu.Lock()
+	reg.inheritTokens(registry)
+	reg.inheritBreakers(registry)
+	old := registry
+	registry = reg
+	reg.publishBreakerStates()
+	registryMu.Unlock()
+	old.closeIdleConnections()
+}
+
+// GetClient retrieves a Client from the registry. The only way this will
+// return false is by a lack of client configuration.
+func (reg *Registry) GetClient(key string) (c *Client, ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	c, ok = reg.clients[key]
+	return c, ok
+}
+
+// GetTokenSource retrieves a TokenSource from the registry. The only way this
+// will return false is by a lack of token source configuration.
+func (reg *Registry) GetTokenSource(key string) (ts *TokenSource, ok bool) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	ts, ok = reg.sources[key]
+	return ts, ok
+}
+
+// inheritTokens copies into the token sources of reg the tokens stored by the
+// equivalent token sources of old.
+func (reg *Registry) inheritTokens(old *Registry) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for key, ts := range reg.sources {
+		prev, ok := old.GetTokenSource(key)
+		if !ok || !ts.sameCredentials(prev) {
+			continue
+		}
+		prev.mu.Lock()
+		token := prev.Token
+		prev.mu.Unlock()
+		ts.mu.Lock()
+		ts.Token = token
+		ts.mu.Unlock()
+	}
+}
+
+// inheritBreakers replaces the circuit breakers of the clients of reg with
+// those of the equivalent clients of old. Must be called before reg is used.
+func (reg *Registry) inheritBreakers(old *Registry) {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for key, c := range reg.clients {
+		prev, ok := old.GetClient(key)
+		if !ok || c.breaker == nil || prev.breaker == nil ||
+			!reflect.DeepEqual(c.breaker.Breaker.config, prev.breaker.Breaker.config) {
+			continue
+		}
+		c.breaker.Breaker = prev.breaker.Breaker
+	}
+}
+
+// publishBreakerStates sets the metric of the state of the circuit breaker of
+// every client. Must only be called on the current registry, so that the
+// metric always holds the state of the breakers in use.
+func (reg *Registry) publishBreakerStates() {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for key, c := range reg.clients {
+		if c.breaker != nil {
+			gsmiddleware.SetCircuitBreakerState(key, int(c.breaker.Breaker.State()))
+		}
+	}
+}
+
+// closeIdleConnections closes the idle connections of every client.
+func (reg *Registry) closeIdleConnections() {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	for _, c := range reg.clients {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,145 @@
+package gsclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestRegistry returns a registry with a client for the given basepath,
+// with a circuit breaker if bc is not nil.
+func newTestRegistry(t *testing.T, basepath string, bc *CircuitBreakerConfig) *Registry {
+	t.Helper()
+	reg := NewRegistry()
+	_, err := reg.NewClient(ClientConfig{Key: "test", Basepath: basepath, CircuitBreaker: bc})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return reg
+}
+
+// restoreRegistry makes the current registry current again after the test.
+func restoreRegistry(t *testing.T) {
+	prev := current()
+	t.Cleanup(func() { SetRegistry(prev) })
+}
+
+func TestSetRegistryKeepsUnchangedBreakers(t *testing.T) {
+	restoreRegistry(t)
+	bc := breakerConfig(1, time.Hour)
+	old := newTestRegistry(t, "http://localhost", &bc)
+	SetRegistry(old)
+	oldClient, _ := old.GetClient("test")
+	report(t, oldClient.breaker.Breaker, true)
+
+	same := breakerConfig(1, time.Hour)
+	reg := newTestRegistry(t, "http://localhost", &same)
+	SetRegistry(reg)
+	c, _ := GetClient("test")
+	if c.breaker.Breaker != oldClient.breaker.Breaker {
+		t.Fatal("breaker replaced although its configuration didn't change")
+	}
+	if c.breaker.Breaker.State() != CIRCUIT_OPEN {
+		t.Errorf("state = %s, want OPEN", c.breaker.Breaker.State())
+	}
+}
+
+func TestSetRegistryReplacesChangedBreakers(t *testing.T) {
+	restoreRegistry(t)
+	bc := breakerConfig(1, time.Hour)
+	old := newTestRegistry(t, "http://localhost", &bc)
+	SetRegistry(old)
+	oldClient, _ := old.GetClient("test")
+	report(t, oldClient.breaker.Breaker, true)
+
+	changed := breakerConfig(2, time.Hour)
+	SetRegistry(newTestRegistry(t, "http://localhost", &changed))
+	c, _ := GetClient("test")
+	if c.breaker.Breaker == oldClient.breaker.Breaker {
+		t.Fatal("breaker kept although its configuration changed")
+	}
+	if c.breaker.Breaker.State() != CIRCUIT_CLOSED {
+		t.Errorf("state = %s, want CLOSED", c.breaker.Breaker.State())
+	}
+}
+
+// breakerGauge returns the value of the circuit breaker state metric of the
+// test client.
+func breakerGauge(t *testing.T) float64 {
+	t.Helper()
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != "client_circuit_breaker_state" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if len(m.GetLabel()) == 1 && m.GetLabel()[0].GetValue() == "test" {
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	t.Fatal("no circuit breaker state for client test")
+	return 0
+}
+
+func TestBreakerStateIsPublishedWhenRegistryIsSet(t *testing.T) {
+	restoreRegistry(t)
+	bc := breakerConfig(1, time.Hour)
+	old := newTestRegistry(t, "http://localhost", &bc)
+	SetRegistry(old)
+	oldClient, _ := old.GetClient("test")
+	report(t, oldClient.breaker.Breaker, true)
+	if got := breakerGauge(t); got != float64(CIRCUIT_OPEN) {
+		t.Fatalf("gauge = %v, want OPEN", got)
+	}
+
+	// A registry which is only validated, or never made current, doesn't
+	// change the metric.
+	changed := breakerConfig(2, time.Hour)
+	reg := newTestRegistry(t, "http://localhost", &changed)
+	if got := breakerGauge(t); got != float64(CIRCUIT_OPEN) {
+		t.Fatalf("gauge = %v before the registry is set, want OPEN", got)
+	}
+	SetRegistry(reg)
+	if got := breakerGauge(t); got != float64(CIRCUIT_CLOSED) {
+		t.Errorf("gauge = %v once the registry is set, want CLOSED", got)
+	}
+}
+
+func TestSetRegistryClosesIdleConnections(t *testing.T) {
+	restoreRegistry(t)
+	closed := make(chan struct{}, 1)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(c net.Conn, s http.ConnState) {
+		if s == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	old := newTestRegistry(t, srv.URL, nil)
+	SetRegistry(old)
+	c, _ := GetClient("test")
+	req, _ := c.NewRequest(context.Background(), http.MethodGet, "/")
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	SetRegistry(newTestRegistry(t, srv.URL, nil))
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("idle connection of the previous client not closed")
+	}
+}
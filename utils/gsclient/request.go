@@ -0,0 +1,240 @@
+package gsclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gsvalidation"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidRequest is the cause of the ResponseErrors returned when the
+// request couldn't be built (an unresolved path parameter or a body that can't
+// be marshalled), so it was never sent.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// pathParamPattern matches the placeholders of a request path.
+var pathParamPattern = regexp.MustCompile(`\{[^{}/]*\}`)
+
+// RequestOption configures a request made with the generic helpers of this
+// package (Get, Post, Put, Delete and Do).
+type RequestOption func(*requestOptions)
+
+// requestOptions holds every value set by the RequestOptions of a request.
+type requestOptions struct {
+	pathParams map[string]string
+	query      url.Values
+	headers    http.Header
+	body       any
+}
+
+// WithPathParam replaces the {name} placeholder of the request path with the
+// given value, escaped to be used as a path segment.
+func WithPathParam(name string, value any) RequestOption {
+	return func(o *requestOptions) {
+		o.pathParams[name] = fmt.Sprint(value)
+	}
+}
+
+// WithQueryParam adds a query parameter to the request.
+func WithQueryParam(name string, value string) RequestOption {
+	return func(o *requestOptions) {
+		o.query.Add(name, value)
+	}
+}
+
+// WithHeader sets a header in the request, overriding the client's default
+// headers.
+func WithHeader(name string, value string) RequestOption {
+	return func(o *requestOptions) {
+		o.headers.Set(name, value)
+	}
+}
+
+// WithBody sets the value to be sent, marshalled as JSON, as request body.
+func WithBody(v any) RequestOption {
+	return func(o *requestOptions) {
+		o.body = v
+	}
+}
+
+// ResponseError is returned by the generic helpers of this package when a
+// request could not be completed successfully. There are four cases:
+//
+//   - The request couldn't be built: Status is 0 and Err wraps
+//     ErrInvalidRequest. It was never sent.
+//   - The request couldn't be sent or no response was received: Status is 0
+//     and Err holds the transport error.
+//   - The response status is not successful: Status, Headers and RawBody are
+//     set, and Body holds the decoded error response, if it could be decoded.
+//   - The response status is successful but its body couldn't be decoded or
+//     validated: Status, Headers and RawBody are set, and Err holds the cause.
+type ResponseError[E any] struct {
+	Status  int
+	Headers http.Header
+	RawBody []byte
+	Body    *E
+	Err     error
+}
+
+// Error implements the error interface.
+func (e *ResponseError[E]) Error() string {
+	if e.IsRequestError() {
+		return e.Err.Error()
+	}
+	if e.Status == 0 {
+		return fmt.Sprintf("error executing http call: %s", e.Err.Error())
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("error decoding response with status %d: %s", e.Status, e.Err.Error())
+	}
+	return fmt.Sprintf("error response received with status %d: %s", e.Status, string(e.RawBody))
+}
+
+// Unwrap returns the underlying transport or decoding error, if any, so that
+// errors.Is and errors.As can inspect it.
+func (e *ResponseError[E]) Unwrap() error {
+	return e.Err
+}
+
+// IsRequestError reports whether the request couldn't be built, so it never
+// reached the external API. It's a mistake of the caller.
+func (e *ResponseError[E]) IsRequestError() bool {
+	return e.Status == 0 && errors.Is(e.Err, ErrInvalidRequest)
+}
+
+// IsTransportError reports whether the error was caused by the request not
+// reaching the external API or its response not being received.
+func (e *ResponseError[E]) IsTransportError() bool {
+	return e.Status == 0 && !e.IsRequestError()
+}
+
+// IsCircuitOpen reports whether the request was rejected by the circuit
+// breaker of the client (see CircuitBreakerTransport), so the external API is
+// considered unavailable.
+func (e *ResponseError[E]) IsCircuitOpen() bool {
+	return e.IsTransportError() && errors.Is(e.Err, ErrCircuitOpen)
+}
+
+// IsErrorResponse reports whether the external API answered with a non
+// successful status code.
+func (e *ResponseError[E]) IsErrorResponse() bool {
+	return e.Status != 0 && e.Err == nil
+}
+
+// Get makes a GET request to the given path of the client. See Do.
+func Get[T any, E any](ctx context.Context, c *Client, path string, opts ...RequestOption) (*T, *ResponseError[E]) {
+	return Do[T, E](ctx, c, http.MethodGet, path, opts...)
+}
+
+// Post makes a POST request to the given path of the client. The body is set
+// with WithBody. See Do.
+func Post[T any, E any](ctx context.Context, c *Client, path string, opts ...RequestOption) (*T, *ResponseError[E]) {
+	return Do[T, E](ctx, c, http.MethodPost, path, opts...)
+}
+
+// Put makes a PUT request to the given path of the client. The body is set
+// with WithBody. See Do.
+func Put[T any, E any](ctx context.Context, c *Client, path string, opts ...RequestOption) (*T, *ResponseError[E]) {
+	return Do[T, E](ctx, c, http.MethodPut, path, opts...)
+}
+
+// Delete makes a DELETE request to the given path of the client. See Do.
+func Delete[T any, E any](ctx context.Context, c *Client, path string, opts ...RequestOption) (*T, *ResponseError[E]) {
+	return Do[T, E](ctx, c, http.MethodDelete, path, opts...)
+}
+
+// Do makes an http request to the given path of the client and decodes its
+// JSON response. The path may contain placeholders such as "/users/{id}",
+// replaced through WithPathParam; the raw path is used as route template in
+// the client metrics.
+//
+// A successful (2xx) response is decoded into T and validated. An empty body
+// results in a zero T. Any other status is decoded, if possible, into E and
+// returned in a ResponseError along with the status, headers and raw body.
+// See gsvalidation.DecodeResponse for the supported content types.
+func Do[T any, E any](ctx context.Context, c *Client, method string, path string, opts ...RequestOption) (*T, *ResponseError[E]) {
+
+	o := &requestOptions{
+		pathParams: make(map[string]string),
+		query:      make(url.Values),
+		headers:    make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	req, err := c.newRequest(ctx, method, path, o)
+	if err != nil {
+		return nil, &ResponseError[E]{Err: err}
+	}
+
+	resp, err := c.HttpClient.Do(req)
+	if err != nil {
+		return nil, &ResponseError[E]{Err: err}
+	}
+
+	dstOk := new(T)
+	dstErr := new(E)
+	res, err := gsvalidation.DecodeResponse(resp, dstOk, dstErr)
+	switch res.Type {
+	case gsvalidation.OK_RESPONSE:
+		return dstOk, nil
+	case gsvalidation.ERR_RESPONSE:
+		rerr := &ResponseError[E]{
+			Status:  res.Status,
+			Headers: res.Header,
+			RawBody: res.Body,
+		}
+		if !res.Empty {
+			rerr.Body = dstErr
+		}
+		return nil, rerr
+	}
+
+	// The body couldn't be read, decoded or validated. For error responses
+	// this is not relevant: the caller already knows the call failed.
+	rerr := &ResponseError[E]{
+		Status:  res.Status,
+		Headers: res.Header,
+		RawBody: res.Body,
+	}
+	if res.Status >= 200 && res.Status <= 299 {
+		rerr.Err = err
+	}
+	return nil, rerr
+}
+
+// newRequest builds the http.Request described by the given options: path
+// parameters are replaced, the query parameters and headers are added, and
+// the body is marshalled as JSON. The error returned, if any, wraps
+// ErrInvalidRequest.
+func (c *Client) newRequest(ctx context.Context, method string, path string, o *requestOptions) (*http.Request, error) {
+
+	ctx = gsmiddleware.WithRouteTemplate(ctx, path)
+
+	expanded := path
+	for name, value := range o.pathParams {
+		expanded = strings.ReplaceAll(expanded, "{"+name+"}", url.PathEscape(value))
+	}
+	if param := pathParamPattern.FindString(expanded); param != "" {
+		return nil, fmt.Errorf("error creating request to call %s: %w: path parameter %s not set", c.Basepath+path, ErrInvalidRequest, param)
+	}
+	if len(o.query) > 0 {
+		expanded += "?" + o.query.Encode()
+	}
+
+	req, err := c.NewJSONRequest(ctx, method, expanded, o.body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to call %s: %w: %s", c.Basepath+path, ErrInvalidRequest, err.Error())
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, values := range o.headers {
+		req.Header[k] = values
+	}
+	return req, nil
+}
@@ -0,0 +1,178 @@
+package gsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// testUser is the body of the responses of these tests.
+type testUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// testError is the body of the error responses of these tests.
+type testError struct {
+	Code string `json:"code"`
+}
+
+// requestTestClient returns a client for a server answering with the given
+// handler, counting the requests received in calls.
+func requestTestClient(t *testing.T, calls *int32, h http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	c, _ := newTestRegistry(t, srv.URL, nil).GetClient("test")
+	return c
+}
+
+func TestGetDecodesSuccessfulResponse(t *testing.T) {
+	var calls int32
+	var got *http.Request
+	c := requestTestClient(t, &calls, func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":7,"name":"ana"}`))
+	})
+
+	user, rerr := Get[testUser, testError](context.Background(), c, "/users/{id}",
+		WithPathParam("id", "a/b"), WithQueryParam("q", "x y"), WithHeader("X-Test", "1"))
+	if rerr != nil {
+		t.Fatalf("unexpected error: %v", rerr)
+	}
+	if user.ID != 7 || user.Name != "ana" {
+		t.Errorf("user = %+v, want the decoded body", user)
+	}
+	if got.URL.EscapedPath() != "/users/a%2Fb" || got.URL.RawQuery != "q=x+y" {
+		t.Errorf("request to %s?%s, want the path param escaped and the query", got.URL.EscapedPath(), got.URL.RawQuery)
+	}
+	if got.Header.Get("X-Test") != "1" || got.Header.Get("Accept") != "application/json" {
+		t.Errorf("headers = %v, want X-Test and Accept", got.Header)
+	}
+}
+
+func TestPostSendsJSONBody(t *testing.T) {
+	var calls int32
+	var body testUser
+	var contentType string
+	c := requestTestClient(t, &calls, func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	_, rerr := Post[struct{}, testError](context.Background(), c, "/users", WithBody(testUser{ID: 1, Name: "ana"}))
+	if rerr != nil {
+		t.Fatalf("unexpected error: %v", rerr)
+	}
+	if contentType != "application/json" || body.Name != "ana" {
+		t.Errorf("body = %+v with Content-Type %q, want the JSON body", body, contentType)
+	}
+}
+
+func TestDoEmptySuccessfulResponse(t *testing.T) {
+	var calls int32
+	c := requestTestClient(t, &calls, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	user, rerr := Delete[testUser, testError](context.Background(), c, "/users/1")
+	if rerr != nil {
+		t.Fatalf("unexpected error: %v", rerr)
+	}
+	if user == nil || *user != (testUser{}) {
+		t.Errorf("user = %+v, want a zero value", user)
+	}
+}
+
+func TestDoErrorResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantBody *testError
+	}{
+		{"with body", http.StatusNotFound, `{"code":"NOT_FOUND"}`, &testError{Code: "NOT_FOUND"}},
+		{"empty body", http.StatusBadRequest, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			c := requestTestClient(t, &calls, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("X-Request", "1")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			})
+
+			_, rerr := Get[testUser, testError](context.Background(), c, "/users/1")
+			if rerr == nil || !rerr.IsErrorResponse() || rerr.IsTransportError() || rerr.IsRequestError() {
+				t.Fatalf("err = %v, want an error response", rerr)
+			}
+			if rerr.Status != tt.status || string(rerr.RawBody) != tt.body || rerr.Headers.Get("X-Request") != "1" {
+				t.Errorf("err = %d %q %v, want the response", rerr.Status, rerr.RawBody, rerr.Headers)
+			}
+			if (rerr.Body == nil) != (tt.wantBody == nil) || (rerr.Body != nil && *rerr.Body != *tt.wantBody) {
+				t.Errorf("body = %+v, want %+v", rerr.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestDoUndecodableSuccessfulResponse(t *testing.T) {
+	var calls int32
+	c := requestTestClient(t, &calls, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":`))
+	})
+
+	_, rerr := Get[testUser, testError](context.Background(), c, "/users/1")
+	if rerr == nil || rerr.Status != http.StatusOK || rerr.Err == nil || rerr.IsErrorResponse() || rerr.IsTransportError() {
+		t.Fatalf("err = %v, want a decoding error", rerr)
+	}
+}
+
+func TestDoTransportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	c, _ := newTestRegistry(t, srv.URL, nil).GetClient("test")
+
+	_, rerr := Get[testUser, testError](context.Background(), c, "/users/1")
+	if rerr == nil || !rerr.IsTransportError() || rerr.IsRequestError() || rerr.IsErrorResponse() {
+		t.Fatalf("err = %v, want a transport error", rerr)
+	}
+}
+
+func TestDoRequestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		opts []RequestOption
+	}{
+		{"path param not set", "/users/{id}", nil},
+		{"body can't be marshalled", "/users", []RequestOption{WithBody(make(chan int))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			c := requestTestClient(t, &calls, func(w http.ResponseWriter, r *http.Request) {})
+
+			_, rerr := Post[testUser, testError](context.Background(), c, tt.path, tt.opts...)
+			if rerr == nil || !rerr.IsRequestError() || rerr.IsTransportError() || !errors.Is(rerr, ErrInvalidRequest) {
+				t.Fatalf("err = %v, want a request error", rerr)
+			}
+			if calls := atomic.LoadInt32(&calls); calls != 0 {
+				t.Errorf("%d requests sent, want none", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package gsclient
+
+import (
+	"fmt"
+	"goserver/utils/gslog"
+	"goserver/utils/gstime"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultMaxAttempts specifies the default number of attempts (first call
+// included) made by a RetryTransport before giving up.
+const defaultMaxAttempts = 3
+
+// defaultBaseBackoff is the default wait before the second attempt. Every
+// subsequent attempt doubles it, until defaultMaxBackoff is reached.
+const defaultBaseBackoff = 100 * time.Millisecond
+
+// defaultMaxBackoff is the default upper bound for the wait between attempts.
+const defaultMaxBackoff = 2 * time.Second
+
+// defaultJitter is the default fraction of the backoff that is randomized.
+const defaultJitter = 0.2
+
+// drainLimit is the maximum number of bytes read from a discarded response
+// body before closing it, so the underlying connection can be reused.
+const drainLimit = 4096
+
+// defaultRetryableStatusCodes are the status codes that, by default, are
+// considered transient errors from the backend.
+var defaultRetryableStatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// defaultRetryableMethods are the idempotent methods that, by default, can
+// be safely retried.
+var defaultRetryableMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodOptions,
+	http.MethodPut,
+	http.MethodDelete,
+	http.MethodTrace,
+}
+
+// RetryConfig contains the configuration properties of the retry policy of a
+// Client. Every field is optional and, if not set, its default is used.
+type RetryConfig struct {
+
+	// MaxAttempts specifies the total number of attempts, including the first
+	// one. A value of 1 disables retries.
+	MaxAttempts          *int             `json:"max_attempts"`
+
+	// BaseBackoff specifies the duration to wait before the second
+	// attempt. It doubles on every new attempt.
+	BaseBackoff          *gstime.Duration `json:"base_backoff"`
+
+	// MaxBackoff specifies the maximum duration to wait between
+	// two attempts.
+	MaxBackoff           *gstime.Duration `json:"max_backoff"`
+
+	// Jitter is the fraction (between 0 and 1) of every backoff that will be
+	// randomized, to avoid many clients retrying at the same time.
+	Jitter               *float64         `json:"jitter"`
+
+	// RetryableStatusCodes are the response status codes that trigger a new
+	// attempt.
+	RetryableStatusCodes []int            `json:"retryable_status_codes"`
+
+	// RetryableMethods are the http methods that may be retried. Only
+	// idempotent methods are retried by default.
+	RetryableMethods     []string         `json:"retryable_methods"`
+
+	// RespectRetryAfter specifies whether the Retry-After header sent by the
+	// backend should be used as the wait before the next attempt (bounded by
+	// MaxBackoff). Enabled by default.
+	RespectRetryAfter    *bool            `json:"respect_retry_after"`
+}
+
+// RetryPolicy is the resolved retry configuration used by a RetryTransport.
+type RetryPolicy struct {
+	MaxAttempts          int
+	BaseBackoff          time.Duration
+	MaxBackoff           time.Duration
+	Jitter               float64
+	RetryableStatusCodes map[int]struct{}
+	RetryableMethods     map[string]struct{}
+	RespectRetryAfter    bool
+}
+
+// NewRetryPolicy builds a RetryPolicy from the given RetryConfig, using the
+// package defaults for every field not set.
+func NewRetryPolicy(rc RetryConfig) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts:          defaultMaxAttempts,
+		BaseBackoff:          defaultBaseBackoff,
+		MaxBackoff:           defaultMaxBackoff,
+		Jitter:               defaultJitter,
+		RetryableStatusCodes: make(map[int]struct{}),
+		RetryableMethods:     make(map[string]struct{}),
+		RespectRetryAfter:    true,
+	}
+	if rc.MaxAttempts != nil {
+		policy.MaxAttempts = *rc.MaxAttempts
+	}
+	policy.BaseBackoff = rc.BaseBackoff.Or(defaultBaseBackoff)
+	policy.MaxBackoff = rc.MaxBackoff.Or(defaultMaxBackoff)
+	if rc.Jitter != nil {
+		policy.Jitter = math.Max(0, math.Min(1, *rc.Jitter))
+	}
+	if rc.RespectRetryAfter != nil {
+		policy.RespectRetryAfter = *rc.RespectRetryAfter
+	}
+	statusCodes := defaultRetryableStatusCodes
+	if rc.RetryableStatusCodes != nil {
+		statusCodes = rc.RetryableStatusCodes
+	}
+	for _, sc := range statusCodes {
+		policy.RetryableStatusCodes[sc] = struct{}{}
+	}
+	methods := defaultRetryableMethods
+	if rc.RetryableMethods != nil {
+		methods = rc.RetryableMethods
+	}
+	for _, m := range methods {
+		policy.RetryableMethods[strings.ToUpper(m)] = struct{}{}
+	}
+	return policy
+}
+
+// RetryTransport wraps an http.RoundTripper retrying the requests that fail
+// with a transient error, following a RetryPolicy.
+type RetryTransport struct {
+
+	// Base defines the implementation of http.RoundTripper wrapped by this
+	// Transport. It is called once per attempt.
+	Base   http.RoundTripper
+
+	// Policy defines which requests are retried and how long to wait between
+	// attempts.
+	Policy RetryPolicy
+}
+
+// Implements http.RoundTripper so it can be used as a Transport.
+// Requests with a body are only retried if their GetBody function is set, so
+// the body can be rewound on every attempt. This is the case for every request
+// created with http.NewRequest using a bytes or strings reader.
+func (rt *RetryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+
+	if !rt.retryable(r) {
+		return rt.Base.RoundTrip(r)
+	}
+
+	logger := gslog.FromContext(r.Context()).With(
+		"method", r.Method,
+		"url", r.URL.Host+r.URL.Path,
+		"max_attempts", rt.Policy.MaxAttempts,
+	)
+
+	for attempt := 1; ; attempt++ {
+
+		// The first attempt uses the original request. Following ones use a
+		// copy with a fresh body.
+		req := r
+		if attempt > 1 {
+			var err error
+			req, err = rewind(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := rt.Base.RoundTrip(req)
+		outcome := describe(resp, err)
+		if !rt.shouldRetry(r, resp, err) {
+			if err != nil {
+				logger.Warn("Request attempt failed", "attempt", attempt, "outcome", outcome)
+			} else {
+				logger.Info("Request attempt done", "attempt", attempt, "outcome", outcome)
+			}
+			return resp, err
+		}
+		if attempt >= rt.Policy.MaxAttempts {
+			logger.Warn("Request attempt failed. No retries left", "attempt", attempt, "outcome", outcome)
+			return resp, err
+		}
+
+		wait := rt.backoff(attempt, resp)
+
+		// Discard the response, if any.
+		if resp != nil {
+			io.CopyN(io.Discard, resp.Body, drainLimit)
+			resp.Body.Close()
+		}
+
+		logger.Warn("Request attempt failed. Retrying", "attempt", attempt, "outcome", outcome, "wait", wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-r.Context().Done():
+			timer.Stop()
+			return nil, r.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether the request can be sent more than once.
+func (rt *RetryTransport) retryable(r *http.Request) bool {
+	if rt.Policy.MaxAttempts <= 1 {
+		return false
+	}
+	if _, ok := rt.Policy.RetryableMethods[r.Method]; !ok {
+		return false
+	}
+	return r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+}
+
+// shouldRetry reports whether the result of an attempt is a transient error.
+// Errors caused by the request's context being done are never retried.
+func (rt *RetryTransport) shouldRetry(r *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return r.Context().Err() == nil
+	}
+	_, ok := rt.Policy.RetryableStatusCodes[resp.StatusCode]
+	return ok
+}
+
+// backoff returns the time to wait after the given attempt. If enabled and
+// present, the Retry-After response header takes precedence over the
+// exponential backoff. In both cases, the result is bounded by MaxBackoff.
+func (rt *RetryTransport) backoff(attempt int, resp *http.Response) time.Duration {
+	if rt.Policy.RespectRetryAfter && resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if wait > rt.Policy.MaxBackoff {
+				return rt.Policy.MaxBackoff
+			}
+			return wait
+		}
+	}
+	wait := math.Min(float64(rt.Policy.BaseBackoff)*math.Pow(2, float64(attempt-1)), float64(rt.Policy.MaxBackoff))
+	// Randomize the given fraction of the wait, in both directions, and bound
+	// it again, so that the jitter never exceeds MaxBackoff.
+	wait += wait * rt.Policy.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(math.Min(wait, float64(rt.Policy.MaxBackoff)))
+}
+
+// describe returns the outcome of an attempt, as logged: its error or the
+// status of its response.
+func describe(resp *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("status %d", resp.StatusCode)
+}
+
+// retryAfter parses a Retry-After header value, which can be either a number
+// of seconds or an http date.
+func retryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		wait := time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// rewind returns a copy of the given request with its body restored through
+// GetBody.
+func rewind(r *http.Request) (*http.Request, error) {
+	req := r.Clone(r.Context())
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("error rewinding request body to retry %s: %s", r.URL.String(), err.Error())
+		}
+		req.Body = body
+	}
+	return req, nil
+}
@@ -0,0 +1,219 @@
+package gsclient
+
+import (
+	"bytes"
+	"goserver/utils/gslog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryTestPolicy returns a policy retrying fast, without jitter.
+func retryTestPolicy(maxAttempts int) RetryPolicy {
+	policy := NewRetryPolicy(RetryConfig{})
+	policy.MaxAttempts = maxAttempts
+	policy.BaseBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	policy.Jitter = 0
+	return policy
+}
+
+// failingServer answers with the given status the first failures requests and
+// with 200 the following ones, counting them in calls.
+func failingServer(t *testing.T, status int, failures int32, calls *int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// captureLog redirects the log lines written during the test to the returned
+// buffer.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	gslog.SetOutput(&buf)
+	t.Cleanup(func() { gslog.SetOutput(os.Stderr) })
+	return &buf
+}
+
+func TestRetryTransportRetriesTransientStatus(t *testing.T) {
+	var calls int32
+	srv := failingServer(t, http.StatusServiceUnavailable, 2, &calls)
+	rt := &RetryTransport{Base: http.DefaultTransport, Policy: retryTestPolicy(3)}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestRetryTransportGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int32
+	srv := failingServer(t, http.StatusBadGateway, 10, &calls)
+	rt := &RetryTransport{Base: http.DefaultTransport, Policy: retryTestPolicy(3)}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", resp.StatusCode)
+	}
+	if calls := atomic.LoadInt32(&calls); calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestRetryTransportDoesNotRetryNonIdempotentMethods(t *testing.T) {
+	var calls int32
+	srv := failingServer(t, http.StatusServiceUnavailable, 10, &calls)
+	rt := &RetryTransport{Base: http.DefaultTransport, Policy: retryTestPolicy(3)}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("{}"))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if calls := atomic.LoadInt32(&calls); calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestRetryTransportRewindsBody(t *testing.T) {
+	var calls int32
+	bodies := make(chan string, 3)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		bodies <- buf.String()
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	rt := &RetryTransport{Base: http.DefaultTransport, Policy: retryTestPolicy(3)}
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader(`{"a":1}`))
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	close(bodies)
+	var got []string
+	for b := range bodies {
+		got = append(got, b)
+	}
+	if len(got) != 2 || got[0] != `{"a":1}` || got[1] != `{"a":1}` {
+		t.Errorf("bodies = %q, want the same body twice", got)
+	}
+}
+
+func TestRetryTransportLogsEveryAttempt(t *testing.T) {
+	var calls int32
+	srv := failingServer(t, http.StatusServiceUnavailable, 1, &calls)
+	rt := &RetryTransport{Base: http.DefaultTransport, Policy: retryTestPolicy(3)}
+	buf := captureLog(t)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want 2:\n%s", len(lines), buf.String())
+	}
+	if !strings.Contains(lines[0], `"attempt":1`) || !strings.Contains(lines[0], `"outcome":"status 503"`) {
+		t.Errorf("first line does not describe the failed attempt: %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"attempt":2`) || !strings.Contains(lines[1], `"outcome":"status 200"`) {
+		t.Errorf("second line does not describe the successful attempt: %s", lines[1])
+	}
+}
+
+func TestBackoffIsBoundedByMaxBackoff(t *testing.T) {
+	policy := retryTestPolicy(10)
+	policy.BaseBackoff = 100 * time.Millisecond
+	policy.MaxBackoff = 300 * time.Millisecond
+	policy.Jitter = 1
+	rt := &RetryTransport{Policy: policy}
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		for i := 0; i < 100; i++ {
+			if wait := rt.backoff(attempt, nil); wait < 0 || wait > policy.MaxBackoff {
+				t.Fatalf("backoff(%d) = %s, want between 0 and %s", attempt, wait, policy.MaxBackoff)
+			}
+		}
+	}
+}
+
+func TestBackoffDoublesWithoutJitter(t *testing.T) {
+	policy := retryTestPolicy(10)
+	policy.BaseBackoff = 100 * time.Millisecond
+	policy.MaxBackoff = time.Second
+	rt := &RetryTransport{Policy: policy}
+
+	want := []time.Duration{100, 200, 400, 800, 1000}
+	for i, w := range want {
+		if got := rt.backoff(i+1, nil); got != w*time.Millisecond {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w*time.Millisecond)
+		}
+	}
+}
+
+func TestBackoffRespectsRetryAfter(t *testing.T) {
+	rt := &RetryTransport{Policy: retryTestPolicy(3)}
+	rt.Policy.MaxBackoff = 10 * time.Second
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"2"}}}
+	if got := rt.backoff(1, resp); got != 2*time.Second {
+		t.Errorf("backoff = %s, want 2s", got)
+	}
+	resp.Header.Set("Retry-After", "120")
+	if got := rt.backoff(1, resp); got != 10*time.Second {
+		t.Errorf("backoff = %s, want it bounded to 10s", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %s, %t, want %s, %t", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package gshandler
+
+import (
+	"context"
+	"fmt"
+	"goserver/utils/gslog"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gsrender"
+	"goserver/utils/gsvalidation"
+	"net/http"
+	"reflect"
+	"sync/atomic"
+)
+
+// Func is an http handler which returns the error it finds instead of writing
+// it, so that every error is logged and written in the same way by the error
+// handler (see SetErrorHandler). Implements http.Handler.
+//
+// If the handler returns an error, it must not have written the response.
+type Func func(w http.ResponseWriter, r *http.Request) error
+
+// ErrorHandler logs and writes the error returned by a handler.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+// NoBody is used as the request or response type of a Typed handler which
+// has no body.
+type NoBody struct{}
+
+// errorHandler contains the current ErrorHandler.
+var errorHandler atomic.Value
+
+// Initialization
+func init() {
+	errorHandler.Store(ErrorHandler(defaultErrorHandler))
+}
+
+// SetErrorHandler sets the handler of the errors returned by every Func.
+func SetErrorHandler(h ErrorHandler) {
+	errorHandler.Store(h)
+}
+
+// Implements interface http.Handler. Calls the function and, if it returns an
+// error, the error handler.
+func (f Func) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := f(w, r)
+	if isNil(err) {
+		return
+	}
+	errorHandler.Load().(ErrorHandler)(w, r, err)
+}
+
+// Typed returns a Func which decodes the JSON body of the request into a Req,
+// calls h with it and writes the Resp returned with the given status, in the
+// format accepted by the client (see gsrender.Negotiate).
+//
+// If Req is NoBody, the body of the request is not read; if Resp is NoBody,
+// only the status is written. A body which can't be decoded or is not valid
+// (see gsvalidation.DecodeJSONRequestBody) is returned as a
+// *gsvalidation.HttpSuggestionError, as any error returned by h, to the error
+// handler. Path parameters can be read from the context with
+// chi.URLParamFromCtx.
+func Typed[Req any, Resp any](status int, h func(ctx context.Context, req Req) (Resp, error)) Func {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		var req Req
+		if _, ok := any(req).(NoBody); !ok {
+			if s := gsvalidation.DecodeJSONRequestBody(r, &req); s != nil {
+				return s
+			}
+		}
+		resp, err := h(r.Context(), req)
+		if !isNil(err) {
+			return err
+		}
+		if _, ok := any(resp).(NoBody); ok {
+			gsrender.Status(w, status)
+			return nil
+		}
+		gsrender.Negotiate(w, r, uint(status), resp)
+		return nil
+	}
+}
+
+// isNil reports whether err is nil, including nil pointers of a concrete
+// error type returned as error (for example, a nil *apierrors.Error), which
+// are not equal to nil.
+func isNil(err error) bool {
+	if err == nil {
+		return true
+	}
+	v := reflect.ValueOf(err)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// defaultErrorHandler logs the error and answers with status 500, until an
+// ErrorHandler is set.
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	gslog.ErrorFrom(err, gsmiddleware.GetTraceID(r.Context()))
+	http.Error(w, fmt.Sprintf("%d %s", http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)),
+		http.StatusInternalServerError)
+}
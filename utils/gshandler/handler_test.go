@@ -0,0 +1,170 @@
+package gshandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"goserver/apierrors"
+	"goserver/utils/gsvalidation"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// handledErrors sets an error handler recording the errors it receives, which
+// are returned, and answers them with status 418.
+func handledErrors(t *testing.T) *[]error {
+	var handled []error
+	SetErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = append(handled, err)
+		w.WriteHeader(http.StatusTeapot)
+	})
+	t.Cleanup(func() { SetErrorHandler(defaultErrorHandler) })
+	return &handled
+}
+
+// user is the request and response body of the Typed handlers tested.
+type user struct {
+	Name string `json:"name" validate:"required"`
+	Age  int    `json:"age" validate:"lte=130"`
+}
+
+func TestFuncCallsErrorHandler(t *testing.T) {
+	handled := handledErrors(t)
+	failure := errors.New("failure")
+
+	tests := []struct {
+		name   string
+		err    error
+		want   []error
+		status int
+	}{
+		{"nil", nil, nil, http.StatusOK},
+		{"typed nil", (*apierrors.Error)(nil), nil, http.StatusOK},
+		{"error", failure, []error{failure}, http.StatusTeapot},
+	}
+	for _, tt := range tests {
+		*handled = nil
+		w := httptest.NewRecorder()
+		Func(func(w http.ResponseWriter, r *http.Request) error {
+			return tt.err
+		}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if len(*handled) != len(tt.want) || (len(tt.want) > 0 && (*handled)[0] != tt.want[0]) {
+			t.Errorf("%s: handled %v, want %v", tt.name, *handled, tt.want)
+		}
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
+
+func TestIsNil(t *testing.T) {
+	var apiErr *apierrors.Error
+	var validationErr *gsvalidation.HttpSuggestionError
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, true},
+		{apiErr, true},
+		{validationErr, true},
+		{apierrors.New(apierrors.USER_NOT_FOUND), false},
+		{errors.New("failure"), false},
+		{context.Canceled, false},
+	}
+	for _, tt := range tests {
+		if got := isNil(tt.err); got != tt.want {
+			t.Errorf("isNil(%#v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestTypedDecodesRequestAndWritesResponse(t *testing.T) {
+	handledErrors(t)
+	h := Typed(http.StatusCreated, func(ctx context.Context, req user) (*user, error) {
+		req.Name = strings.ToUpper(req.Name)
+		return &req, nil
+	})
+
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "ana", "age": 30}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if w.Code != http.StatusCreated || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("response = %d %s, want 201 application/json", w.Code, w.Header().Get("Content-Type"))
+	}
+	var got user
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got != (user{Name: "ANA", Age: 30}) {
+		t.Errorf("body = %s, want the user returned", w.Body.String())
+	}
+}
+
+func TestTypedReturnsInvalidBody(t *testing.T) {
+	handled := handledErrors(t)
+	called := false
+	h := Typed(http.StatusCreated, func(ctx context.Context, req user) (NoBody, error) {
+		called = true
+		return NoBody{}, nil
+	})
+
+	for _, body := range []string{`{"name": "ana", "age": 131}`, `{"name":`, `{"unknown": 1}`} {
+		*handled = nil
+		r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		var s *gsvalidation.HttpSuggestionError
+		if len(*handled) != 1 || !errors.As((*handled)[0], &s) {
+			t.Errorf("%s: handled %v, want an HttpSuggestionError", body, *handled)
+		}
+	}
+	if called {
+		t.Error("the handler was called with an invalid body")
+	}
+}
+
+func TestTypedWithoutBodies(t *testing.T) {
+	handled := handledErrors(t)
+	h := Typed(http.StatusNoContent, func(ctx context.Context, req NoBody) (NoBody, error) {
+		var e *apierrors.Error
+		return NoBody{}, e
+	})
+
+	// The body is not read, so neither its content type nor its content
+	// matter.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/users/7", strings.NewReader("not JSON")))
+
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 || len(*handled) != 0 {
+		t.Errorf("response = %d %q (handled %v), want only 204", w.Code, w.Body.String(), *handled)
+	}
+}
+
+func TestTypedReturnsHandlerError(t *testing.T) {
+	handled := handledErrors(t)
+	notFound := apierrors.New(apierrors.USER_NOT_FOUND)
+	h := Typed(http.StatusOK, func(ctx context.Context, req NoBody) (*user, error) {
+		return nil, notFound
+	})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+
+	if len(*handled) != 1 || (*handled)[0] != notFound || w.Code != http.StatusTeapot {
+		t.Errorf("handled %v (status %d), want the error returned", *handled, w.Code)
+	}
+}
+
+func TestDefaultErrorHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	Func(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("failure")
+	}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusInternalServerError || strings.TrimSpace(w.Body.String()) != "500 Internal Server Error" {
+		t.Errorf("response = %d %q, want 500", w.Code, w.Body.String())
+	}
+}
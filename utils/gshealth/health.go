@@ -0,0 +1,213 @@
+package gshealth
+
+import (
+	"context"
+	"fmt"
+	"goserver/utils/gstime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultCacheInterval is the default time a check result is reused before
+// running the check again.
+const defaultCacheInterval = 10 * time.Second
+
+// defaultTimeout is the default time limit of a single check.
+const defaultTimeout = 2 * time.Second
+
+// Status is the result of a check, or of the whole readiness report.
+type Status string
+
+const (
+	UP   Status = "UP"
+	DOWN Status = "DOWN"
+)
+
+// cacheInterval and timeout hold the current configuration. See HealthConfig.
+var cacheInterval = defaultCacheInterval
+var timeout = defaultTimeout
+
+// checks contains every registered check by name.
+var checks map[string]*check
+
+// mu synchronizes the access to the configuration and the checks map.
+var mu sync.RWMutex
+
+// HealthConfig contains the configuration properties of the readiness checks.
+// Every field is optional and, if not set, its default is used.
+type HealthConfig struct {
+
+	// CacheInterval specifies the duration a check result is reused before
+	// the check is run again.
+	CacheInterval *gstime.Duration `json:"cache_interval"`
+
+	// Timeout specifies the duration a single check may take before it's
+	// considered failed.
+	Timeout       *gstime.Duration `json:"timeout"`
+}
+
+// Checker is implemented by anything able to report whether a dependency of
+// the application is available.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc allows the use of ordinary functions as Checkers.
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx).
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// CheckResult is the last known result of a single check.
+type CheckResult struct {
+	Name        string  `json:"name"`
+	Status      Status  `json:"status"`
+	LatencyMs   float64 `json:"latency_ms"`
+	CheckedAt   string  `json:"checked_at"`
+	LastError   string  `json:"last_error,omitempty"`
+	LastErrorAt string  `json:"last_error_at,omitempty"`
+}
+
+// Report is the aggregated result of every registered check. Its status is
+// UP only if every check is UP.
+type Report struct {
+	Status Status        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// check is a registered Checker along with its cached result.
+type check struct {
+	checker   Checker
+	mu        sync.Mutex
+	result    CheckResult
+	checkedAt time.Time
+}
+
+// Initialization. Only initializes the checks map.
+func init() {
+	checks = make(map[string]*check)
+}
+
+// Configure enables the configuration of the readiness checks.
+func Configure(hc HealthConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+	cacheInterval = hc.CacheInterval.Or(defaultCacheInterval)
+	timeout = hc.Timeout.Or(defaultTimeout)
+}
+
+// Register adds a Checker to the readiness report with the given name.
+//
+// Note: if there's already a Checker with the same name, it is replaced.
+func Register(name string, c Checker) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = &check{
+		checker: c,
+		result:  CheckResult{Name: name},
+	}
+}
+
+// Unregister removes the Checker with the given name, if any.
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(checks, name)
+}
+
+// Readiness runs every registered check whose cached result is older than the
+// cache interval, concurrently and bounded by the configured timeout, and
+// returns the aggregated report.
+//
+// Checks don't use the context of the request asking for the report, so that
+// a caller giving up doesn't leave a failed result in the cache.
+func Readiness() Report {
+
+	mu.RLock()
+	interval, limit := cacheInterval, timeout
+	registered := make([]*check, 0, len(checks))
+	for _, c := range checks {
+		registered = append(registered, c)
+	}
+	mu.RUnlock()
+
+	results := make([]CheckResult, len(registered))
+	var wg sync.WaitGroup
+	for i, c := range registered {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(interval, limit)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+
+	report := Report{Status: UP, Checks: results}
+	for _, r := range results {
+		if r.Status != UP {
+			report.Status = DOWN
+		}
+	}
+	return report
+}
+
+// run returns the cached result of the check, running it first if the result
+// is older than interval. Concurrent callers wait for a single run, which
+// takes at most limit: a checker ignoring its context is left running and
+// reported as timed out.
+func (c *check) run(interval time.Duration, limit time.Duration) CheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < interval {
+		return c.result
+	}
+
+	checkCtx, cancel := context.WithTimeout(context.Background(), limit)
+	defer cancel()
+
+	start := time.Now()
+	var err error
+	select {
+	case err = <-c.call(checkCtx):
+		if err == nil && checkCtx.Err() != nil {
+			err = fmt.Errorf("check timed out after %s", limit)
+		}
+	case <-checkCtx.Done():
+		err = fmt.Errorf("check timed out after %s", limit)
+	}
+
+	c.checkedAt = time.Now()
+	c.result.LatencyMs = float64(c.checkedAt.Sub(start).Microseconds()) / 1000
+	c.result.CheckedAt = c.checkedAt.Format(time.RFC3339Nano)
+	c.result.Status = UP
+	if err != nil {
+		c.result.Status = DOWN
+		c.result.LastError = err.Error()
+		c.result.LastErrorAt = c.result.CheckedAt
+	}
+	return c.result
+}
+
+// call runs the checker in a new goroutine and returns the channel its error
+// is sent to. A panic of the checker is sent as an error as well, so that it
+// is reported as DOWN instead of crashing the caller.
+func (c *check) call(ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				done <- fmt.Errorf("check panicked: %v", rec)
+			}
+		}()
+		done <- c.checker.Check(ctx)
+	}()
+	return done
+}
@@ -0,0 +1,109 @@
+package gshealth
+
+import (
+	"context"
+	"errors"
+	"goserver/utils/gstime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// configure sets the given cache interval and timeout for the test and
+// registers the checks, removing them afterwards.
+func configure(t *testing.T, interval time.Duration, limit time.Duration, cs map[string]Checker) {
+	i, l := gstime.Duration(interval), gstime.Duration(limit)
+	Configure(HealthConfig{CacheInterval: &i, Timeout: &l})
+	for name, c := range cs {
+		Register(name, c)
+	}
+	t.Cleanup(func() {
+		for name := range cs {
+			Unregister(name)
+		}
+		Configure(HealthConfig{})
+	})
+}
+
+// result returns the result of the check with the given name.
+func result(t *testing.T, r Report, name string) CheckResult {
+	t.Helper()
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no result for check %s", name)
+	return CheckResult{}
+}
+
+func TestReadinessAggregatesChecks(t *testing.T) {
+	configure(t, time.Minute, time.Second, map[string]Checker{
+		"up":   CheckerFunc(func(ctx context.Context) error { return nil }),
+		"down": CheckerFunc(func(ctx context.Context) error { return errors.New("unreachable") }),
+	})
+
+	r := Readiness()
+	if r.Status != DOWN {
+		t.Errorf("status = %s, want DOWN", r.Status)
+	}
+	if len(r.Checks) != 2 || r.Checks[0].Name != "down" || r.Checks[1].Name != "up" {
+		t.Fatalf("checks = %+v, want down and up sorted by name", r.Checks)
+	}
+	if got := result(t, r, "down"); got.Status != DOWN || got.LastError != "unreachable" {
+		t.Errorf("down = %+v, want DOWN with its error", got)
+	}
+	if got := result(t, r, "up"); got.Status != UP {
+		t.Errorf("up = %+v, want UP", got)
+	}
+}
+
+func TestReadinessCachesResults(t *testing.T) {
+	var calls int32
+	configure(t, time.Minute, time.Second, map[string]Checker{
+		"counted": CheckerFunc(func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		}),
+	})
+
+	Readiness()
+	Readiness()
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestReadinessTimesOutCheckersIgnoringContext(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	configure(t, 0, 20*time.Millisecond, map[string]Checker{
+		"stuck": CheckerFunc(func(ctx context.Context) error {
+			<-block
+			return nil
+		}),
+	})
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		r := Readiness()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("readiness took %s, want it bounded by the timeout", elapsed)
+		}
+		if got := result(t, r, "stuck"); got.Status != DOWN || !strings.Contains(got.LastError, "timed out") {
+			t.Errorf("stuck = %+v, want DOWN timed out", got)
+		}
+	}
+}
+
+func TestReadinessReportsPanicsAsDown(t *testing.T) {
+	configure(t, time.Minute, time.Second, map[string]Checker{
+		"panics": CheckerFunc(func(ctx context.Context) error { panic("boom") }),
+	})
+
+	r := Readiness()
+	if got := result(t, r, "panics"); got.Status != DOWN || !strings.Contains(got.LastError, "boom") {
+		t.Errorf("panics = %+v, want DOWN with the panic", got)
+	}
+}
@@ -0,0 +1,294 @@
+package gslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AccessLogFormat specifies the format of the access log lines.
+type AccessLogFormat string
+
+const (
+	// JSON_FORMAT writes every line as a JSON object.
+	JSON_FORMAT     AccessLogFormat = "json"
+
+	// COMBINED_FORMAT writes every line with the Apache combined log format,
+	// followed by the route, the trace ID and the duration in milliseconds.
+	COMBINED_FORMAT AccessLogFormat = "combined"
+
+	// LOGFMT_FORMAT writes every line as key=value pairs.
+	LOGFMT_FORMAT   AccessLogFormat = "logfmt"
+)
+
+// defaultAccessLogFormat is the format of the access log if none is
+// configured.
+const defaultAccessLogFormat = JSON_FORMAT
+
+// AccessLogConfig contains the configuration properties of the access log,
+// which has one line per request received, written to its own file. Every
+// field is optional and, if not set, its default is used.
+type AccessLogConfig struct {
+
+	// Enabled specifies whether the access log is written. Enabled by
+	// default.
+	Enabled     *bool            `json:"enabled"`
+
+	// Format is the format of the lines. If not set, defaultAccessLogFormat
+	// is used.
+	Format      *AccessLogFormat `json:"format"`
+
+	// SampleRatio is the fraction (between 0 and 1) of the successful
+	// requests (status below 400) logged. Failed requests are always logged.
+	// If not set, every request is logged.
+	SampleRatio *float64         `json:"sample_ratio"`
+
+	// Filename is the path of the access log file. If not set, it's
+	// ./log/access-<date>.log.
+	Filename    *string          `json:"filename"`
+
+	// File contains the rotation properties of the file, as the ones of the
+	// main log file (see LogFileConfig).
+	File        LogFileConfig    `json:"file"`
+}
+
+// AccessEntry contains the information of a request written to the access
+// log. Path is the path of the request URL, used to exclude it (see
+// LoggerConfig.ExcludeUrls), and URI is the request target as received, with
+// its query, written by the combined format.
+type AccessEntry struct {
+	Time      time.Time
+	Method    string
+	Route     string
+	Path      string
+	URI       string
+	Proto     string
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+	RemoteIP  string
+	UserAgent string
+	Referer   string
+	TraceID   string
+}
+
+// accessSettings contains the resolved configuration of the access log.
+type accessSettings struct {
+
+	// enabled specifies whether the access log is written.
+	enabled     bool
+
+	// format is the format of the lines.
+	format      AccessLogFormat
+
+	// sampleRatio is the fraction of the successful requests logged.
+	sampleRatio float64
+}
+
+// accessFile is the lumberjack logger writing the access log file, kept
+// across configurations if its properties don't change.
+var accessFile *lumberjack.Logger
+
+// accessFileConfig is the configuration accessFile was created with.
+var accessFileConfig *AccessLogConfig
+
+// accessMu synchronizes the replacement of accessFile and the writes to it.
+var accessMu sync.Mutex
+
+// newAccessSettings resolves the configuration of the access log and, if the
+// properties of its file changed, replaces the file.
+func newAccessSettings(c *AccessLogConfig) *accessSettings {
+	if c == nil {
+		c = &AccessLogConfig{}
+	}
+	s := &accessSettings{
+		enabled:     true,
+		format:      defaultAccessLogFormat,
+		sampleRatio: 1,
+	}
+	if c.Enabled != nil {
+		s.enabled = *c.Enabled
+	}
+	if c.Format != nil {
+		s.format = AccessLogFormat(strings.ToLower(string(*c.Format)))
+	}
+	if c.SampleRatio != nil {
+		s.sampleRatio = *c.SampleRatio
+	}
+	configureAccessFile(c)
+	return s
+}
+
+// configureAccessFile replaces the access log file if the given properties
+// are not the ones it was created with. The file is only created on the
+// first write.
+func configureAccessFile(c *AccessLogConfig) {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+
+	if accessFileConfig != nil && reflect.DeepEqual(accessFileConfig.Filename, c.Filename) &&
+		reflect.DeepEqual(accessFileConfig.File, c.File) {
+		return
+	}
+
+	filename := fmt.Sprintf("./log/access-%s.log", time.Now().Format("2006-01-02"))
+	if c.Filename != nil {
+		filename = *c.Filename
+	}
+	maxSize, maxBackups, maxAge := defaultMaxSize, defaultMaxBackups, defaultMaxAge
+	if c.File.MaxSize != nil {
+		maxSize = *c.File.MaxSize
+	}
+	if c.File.MaxBackups != nil {
+		maxBackups = *c.File.MaxBackups
+	}
+	if c.File.MaxAge != nil {
+		maxAge = *c.File.MaxAge
+	}
+
+	if accessFile != nil {
+		accessFile.Close()
+	}
+	accessFile = &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAge,
+		Compress:   true,
+		LocalTime:  true,
+	}
+	accessFileConfig = c
+}
+
+// closeAccessFile closes the access log file, if any. It's opened again if
+// something is written afterwards.
+func closeAccessFile() error {
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	if accessFile == nil {
+		return nil
+	}
+	return accessFile.Close()
+}
+
+// Access writes the entry to the access log, if enabled and its path is not
+// excluded (see LoggerConfig.ExcludeUrls). Successful requests (status below
+// 400) are sampled according to the configuration; the rest are always
+// written.
+func Access(e AccessEntry) {
+	ls := current()
+	s := ls.access
+	if !s.enabled || ls.excluded(e.Path) {
+		return
+	}
+	if e.Status < 400 && s.sampleRatio < 1 && rand.Float64() >= s.sampleRatio {
+		return
+	}
+
+	var line string
+	switch s.format {
+	case COMBINED_FORMAT:
+		line = e.combined()
+	case LOGFMT_FORMAT:
+		line = e.logfmt()
+	default:
+		line = e.json()
+	}
+
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	if _, err := accessFile.Write([]byte(line + "\n")); err != nil {
+		Server(fmt.Sprintf("Error writing access log: %s", err.Error()))
+	}
+}
+
+// json returns the entry formatted as a JSON object.
+func (e AccessEntry) json() string {
+	b, _ := json.Marshal(struct {
+		Time       string  `json:"time"`
+		Method     string  `json:"method"`
+		Route      string  `json:"route,omitempty"`
+		Path       string  `json:"path"`
+		Proto      string  `json:"proto"`
+		Status     int     `json:"status"`
+		Bytes      int64   `json:"bytes"`
+		DurationMs float64 `json:"duration_ms"`
+		RemoteIP   string  `json:"remote_ip"`
+		UserAgent  string  `json:"user_agent,omitempty"`
+		Referer    string  `json:"referer,omitempty"`
+		TraceID    string  `json:"trace_id,omitempty"`
+	}{
+		formatTime(e.Time), e.Method, e.Route, e.Path, e.Proto, e.Status, e.Bytes,
+		milliseconds(e.Duration), e.RemoteIP, e.UserAgent, e.Referer, e.TraceID,
+	})
+	return string(b)
+}
+
+// combined returns the entry formatted with the Apache combined log format,
+// followed by the route, the trace ID and the duration in milliseconds:
+//
+//	127.0.0.1 - - [17/Oct/2026:10:00:00 -0300] "GET /users/1?fields=name HTTP/1.1" 200 52 "-" "curl/8.0" "/users/{id}" 0a1b... 1.234
+func (e AccessEntry) combined() string {
+	return fmt.Sprintf(`%s - - [%s] "%s %s %s" %d %d %s %s %s %s %s`,
+		orDash(e.RemoteIP), e.Time.Format("02/Jan/2006:15:04:05 -0700"), e.Method, orDash(e.URI), e.Proto,
+		e.Status, e.Bytes, quoted(e.Referer), quoted(e.UserAgent), quoted(e.Route), orDash(e.TraceID),
+		strconv.FormatFloat(milliseconds(e.Duration), 'f', 3, 64))
+}
+
+// logfmt returns the entry formatted as key=value pairs.
+func (e AccessEntry) logfmt() string {
+	pairs := [][2]string{
+		{"time", formatTime(e.Time)},
+		{"method", e.Method},
+		{"route", e.Route},
+		{"path", e.Path},
+		{"proto", e.Proto},
+		{"status", strconv.Itoa(e.Status)},
+		{"bytes", strconv.FormatInt(e.Bytes, 10)},
+		{"duration_ms", strconv.FormatFloat(milliseconds(e.Duration), 'f', 3, 64)},
+		{"remote_ip", e.RemoteIP},
+		{"user_agent", e.UserAgent},
+		{"referer", e.Referer},
+		{"trace_id", e.TraceID},
+	}
+	var sb strings.Builder
+	for _, p := range pairs {
+		if p[1] == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(p[0])
+		sb.WriteByte('=')
+		if strings.ContainsAny(p[1], " \"=\\") || !strconv.CanBackquote(p[1]) {
+			sb.WriteString(strconv.Quote(p[1]))
+		} else {
+			sb.WriteString(p[1])
+		}
+	}
+	return sb.String()
+}
+
+// orDash returns s, or "-" if it's empty, as in the Apache log formats.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// quoted returns s quoted for the Apache log formats, or "-" if it's empty.
+func quoted(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	return strconv.Quote(s)
+}
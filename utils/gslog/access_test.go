@@ -0,0 +1,146 @@
+package gslog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEntry returns an entry with every field set.
+func testEntry() AccessEntry {
+	return AccessEntry{
+		Time:      time.Date(2026, 10, 17, 10, 0, 0, 0, time.FixedZone("", -3*3600)),
+		Method:    "GET",
+		Route:     "/users/{id}",
+		Path:      "/users/1",
+		URI:       "/users/1?fields=name",
+		Proto:     "HTTP/1.1",
+		Status:    200,
+		Bytes:     52,
+		Duration:  1234 * time.Microsecond,
+		RemoteIP:  "127.0.0.1",
+		UserAgent: "curl/8.0",
+		TraceID:   "trace-1",
+	}
+}
+
+// configureAccess writes the access log with the given configuration to a
+// file of the test, whose path is returned.
+func configureAccess(t *testing.T, c AccessLogConfig) string {
+	filename := filepath.Join(t.TempDir(), "access.log")
+	c.Filename = &filename
+	ConfigureLog(LoggerConfig{ExcludeUrls: []string{"/health"}, Access: &c})
+	t.Cleanup(func() {
+		closeAccessFile()
+		ConfigureLog(LoggerConfig{})
+	})
+	return filename
+}
+
+// accessLines returns the lines written to the access log file.
+func accessLines(t *testing.T, filename string) []string {
+	t.Helper()
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("couldn't read the access log: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestAccessEntryJSON(t *testing.T) {
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte(testEntry().json()), &got); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := map[string]interface{}{
+		"time": formatTime(testEntry().Time), "method": "GET", "route": "/users/{id}", "path": "/users/1",
+		"proto": "HTTP/1.1", "status": 200.0, "bytes": 52.0, "duration_ms": 1.234, "remote_ip": "127.0.0.1",
+		"user_agent": "curl/8.0", "trace_id": "trace-1",
+	}
+	if len(got) != len(want) {
+		t.Errorf("line = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestAccessEntryCombined(t *testing.T) {
+	want := `127.0.0.1 - - [17/Oct/2026:10:00:00 -0300] "GET /users/1?fields=name HTTP/1.1" 200 52 "-" "curl/8.0" "/users/{id}" trace-1 1.234`
+	if got := testEntry().combined(); got != want {
+		t.Errorf("combined =\n%s\nwant\n%s", got, want)
+	}
+
+	e := AccessEntry{Time: testEntry().Time, Method: "GET", Path: "/", Proto: "HTTP/1.1", Status: 404}
+	want = `- - - [17/Oct/2026:10:00:00 -0300] "GET - HTTP/1.1" 404 0 "-" "-" "-" - 0.000`
+	if got := e.combined(); got != want {
+		t.Errorf("combined =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAccessEntryLogfmt(t *testing.T) {
+	e := testEntry()
+	e.UserAgent = `Mozilla/5.0 "test"`
+	want := `time=` + formatTime(e.Time) + ` method=GET route=/users/{id} path=/users/1 proto=HTTP/1.1 status=200 bytes=52 ` +
+		`duration_ms=1.234 remote_ip=127.0.0.1 user_agent="Mozilla/5.0 \"test\"" trace_id=trace-1`
+	if got := e.logfmt(); got != want {
+		t.Errorf("logfmt =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestAccessWritesConfiguredFormat(t *testing.T) {
+	format := COMBINED_FORMAT
+	filename := configureAccess(t, AccessLogConfig{Format: &format})
+
+	Access(testEntry())
+	excluded := testEntry()
+	excluded.Path = "/health"
+	Access(excluded)
+
+	got := accessLines(t, filename)
+	if len(got) != 1 || got[0] != testEntry().combined() {
+		t.Errorf("lines = %q, want only the combined line of the entry not excluded", got)
+	}
+}
+
+func TestAccessSamplesOnlySuccessfulRequests(t *testing.T) {
+	ratio := 0.0
+	filename := configureAccess(t, AccessLogConfig{SampleRatio: &ratio})
+
+	for _, status := range []int{200, 201, 302, 400, 404, 500, 503} {
+		e := testEntry()
+		e.Status = status
+		Access(e)
+	}
+
+	var statuses []float64
+	for _, line := range accessLines(t, filename) {
+		var m map[string]interface{}
+		json.Unmarshal([]byte(line), &m)
+		statuses = append(statuses, m["status"].(float64))
+	}
+	if len(statuses) != 4 || statuses[0] != 400 || statuses[3] != 503 {
+		t.Errorf("statuses logged = %v, want only the errors", statuses)
+	}
+}
+
+func TestAccessDisabled(t *testing.T) {
+	enabled := false
+	filename := configureAccess(t, AccessLogConfig{Enabled: &enabled})
+
+	e := testEntry()
+	e.Status = 500
+	Access(e)
+
+	if got := accessLines(t, filename); len(got) != 0 {
+		t.Errorf("lines = %q, want none", got)
+	}
+}
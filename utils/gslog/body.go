@@ -0,0 +1,139 @@
+package gslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// binaryMediaTypes are the media types (or their prefixes, ending with /)
+// whose bodies are summarized instead of logged.
+var binaryMediaTypes = []string{
+	"multipart/", "image/", "audio/", "video/", "font/",
+	"application/octet-stream", "application/pdf", "application/zip",
+	"application/gzip", "application/x-protobuf", "application/grpc",
+}
+
+// xmlSpaces matches the whitespace between XML tags, used to indent them.
+var xmlSpaces = regexp.MustCompile(`>\s+<`)
+
+// loggedBody contains a request or response body ready to be logged.
+type loggedBody struct {
+
+	// value is the body: a json.RawMessage if it's JSON and wasn't truncated,
+	// a string otherwise.
+	value     interface{}
+
+	// size is the size of the whole body, in bytes.
+	size      int64
+
+	// truncated reports whether the body was truncated.
+	truncated bool
+}
+
+// formatBody prepares a body to be logged, according to its content type:
+//   - binary and multipart bodies are summarized with their size and type.
+//   - JSON bodies are compacted and, if they are not truncated, logged as
+//     nested objects.
+//   - XML bodies are logged without the whitespace between tags.
+//   - Other bodies are logged as they are.
+//
+// raw are the first bytes captured of a body of size bytes. Sensitive data is
+// redacted with the given redactor before the body is truncated to maxLength
+// characters (if greater than 0).
+func formatBody(raw []byte, size int64, contentType string, rd *redactor, maxLength int) loggedBody {
+	if size == 0 {
+		return loggedBody{}
+	}
+	partial := int64(len(raw)) < size
+	if partial {
+		raw = trimIncompleteRune(raw)
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if isBinary(mediaType) || !utf8.Valid(raw) {
+		if mediaType == "" {
+			mediaType = "binary"
+		}
+		return loggedBody{value: fmt.Sprintf("<%d bytes of %s>", size, mediaType), size: size}
+	}
+
+	body := rd.redactBody(string(raw), contentType)
+	switch {
+	case isJSON(mediaType, body):
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(body)); err == nil {
+			if maxLength <= 0 || utf8.RuneCount(buf.Bytes()) <= maxLength {
+				return loggedBody{value: json.RawMessage(buf.Bytes()), size: size}
+			}
+			body = buf.String()
+		}
+	case strings.HasSuffix(mediaType, "xml"):
+		body = strings.TrimSpace(xmlSpaces.ReplaceAllString(body, "><"))
+	}
+
+	lb := loggedBody{value: body, size: size, truncated: partial}
+	if s, ok := truncate(body, maxLength); ok {
+		lb.value, lb.truncated = s, true
+	}
+	return lb
+}
+
+// trimIncompleteRune removes the last bytes of b if they are the beginning of
+// a rune cut by the capture.
+func trimIncompleteRune(b []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// set adds the body to the log line.
+func (lb loggedBody) set(l *customLog) {
+	l.Body = lb.value
+	l.BodySize = lb.size
+	l.BodyTruncated = lb.truncated
+}
+
+// isBinary reports whether the bodies of the given media type are binary.
+func isBinary(mediaType string) bool {
+	for _, t := range binaryMediaTypes {
+		if mediaType == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSON reports whether the body is JSON: its media type says so or, if
+// there's none, it looks like JSON.
+func isJSON(mediaType string, body string) bool {
+	if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+		return true
+	}
+	return mediaType == "" && body != "" && strings.ContainsAny(body[:1], "{[")
+}
+
+// truncate returns the first n characters of s, cutting on rune boundaries,
+// and whether s was longer. If n <= 0, returns s.
+func truncate(s string, n int) (string, bool) {
+	if n <= 0 || len(s) <= n {
+		return s, false
+	}
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos], true
+		}
+		i++
+	}
+	return s, false
+}
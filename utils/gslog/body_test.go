@@ -0,0 +1,124 @@
+package gslog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFormatBody(t *testing.T) {
+	rd := testRedactor(nil)
+	tests := []struct {
+		name        string
+		raw         string
+		size        int64
+		contentType string
+		maxLength   int
+		want        loggedBody
+	}{
+		{"empty", "", 0, "application/json", 0, loggedBody{}},
+		{"image", "\x89PNG\r\n", 2048, "image/png", 0,
+			loggedBody{value: "<2048 bytes of image/png>", size: 2048}},
+		{"multipart", "--boundary\r\n", 300, "multipart/form-data; boundary=boundary", 0,
+			loggedBody{value: "<300 bytes of multipart/form-data>", size: 300}},
+		{"invalid UTF-8 without type", "\xff\xfe\x00", 3, "", 0,
+			loggedBody{value: "<3 bytes of binary>", size: 3}},
+		{"JSON", "{ \"id\": 1,\n \"tags\": [\"a\", \"b\"] }", 33, "application/json; charset=utf-8", 0,
+			loggedBody{value: json.RawMessage(`{"id":1,"tags":["a","b"]}`), size: 33}},
+		{"vendor JSON", `{"id": 1}`, 9, "application/problem+json", 0,
+			loggedBody{value: json.RawMessage(`{"id":1}`), size: 9}},
+		{"JSON without type", `[1, 2]`, 6, "", 0,
+			loggedBody{value: json.RawMessage(`[1,2]`), size: 6}},
+		{"JSON fitting", `{"name": "abc"}`, 15, "application/json", 14,
+			loggedBody{value: json.RawMessage(`{"name":"abc"}`), size: 15}},
+		{"JSON truncated", `{"name": "abcdef"}`, 18, "application/json", 10,
+			loggedBody{value: `{"name":"a`, size: 18, truncated: true}},
+		{"JSON captured partially", `{"name": "abc`, 100, "application/json", 0,
+			loggedBody{value: `{"name": "abc`, size: 100, truncated: true}},
+		{"invalid JSON", `{"name": `, 9, "application/json", 0,
+			loggedBody{value: `{"name": `, size: 9}},
+		{"XML", "<user>\n  <id>1</id>\n  <name>Ana María</name>\n</user>\n", 53, "application/xml", 0,
+			loggedBody{value: "<user><id>1</id><name>Ana María</name></user>", size: 53}},
+		{"vendor XML", "<a>\t<b/> </a>", 13, "application/soap+xml", 0,
+			loggedBody{value: "<a><b/></a>", size: 13}},
+		{"text", "hello  world\n", 13, "text/plain", 0,
+			loggedBody{value: "hello  world\n", size: 13}},
+		{"text truncated on runes", "ñandú ñandú", 13, "text/plain", 4,
+			loggedBody{value: "ñand", size: 13, truncated: true}},
+		{"text captured partially on a rune", "añ"[:2], 20, "text/plain", 0,
+			loggedBody{value: "a", size: 20, truncated: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatBody([]byte(tt.raw), tt.size, tt.contentType, rd, tt.maxLength)
+			gotValue, _ := json.Marshal(got.value)
+			wantValue, _ := json.Marshal(tt.want.value)
+			if string(gotValue) != string(wantValue) || got.size != tt.want.size || got.truncated != tt.want.truncated {
+				t.Errorf("formatBody = {%s %d %v}, want {%s %d %v}", gotValue, got.size, got.truncated, wantValue, tt.want.size, tt.want.truncated)
+			}
+			if _, isJSON := tt.want.value.(json.RawMessage); isJSON != isRawMessage(got.value) {
+				t.Errorf("value of type %T, want %T", got.value, tt.want.value)
+			}
+		})
+	}
+}
+
+func TestFormatBodyRedactsBeforeTruncating(t *testing.T) {
+	rd := testRedactor(nil)
+	got := formatBody([]byte(`{"password": "123456789", "user": "ana"}`), 40, "application/json", rd, 20)
+	if got.value != `{"password":"****","` || !got.truncated {
+		t.Errorf("formatBody = %#v, want the redacted body truncated", got)
+	}
+}
+
+func TestTrimIncompleteRune(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"", ""},
+		{"abc", "abc"},
+		{"ñ", "ñ"},
+		{"añ"[:2], "a"},
+		{"a€"[:2], "a"},
+		{"a€"[:3], "a"},
+		{"a€", "a€"},
+		{"a😀"[:4], "a"},
+		{"a😀", "a😀"},
+		{"a\xff", "a\xff"},
+	}
+	for _, tt := range tests {
+		if got := string(trimIncompleteRune([]byte(tt.raw))); got != tt.want {
+			t.Errorf("trimIncompleteRune(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s         string
+		n         int
+		want      string
+		truncated bool
+	}{
+		{"abc", 0, "abc", false},
+		{"abc", 3, "abc", false},
+		{"abcd", 3, "abc", true},
+		{"ñññ", 3, "ñññ", false},
+		{"ññññ", 3, "ñññ", true},
+		{strings.Repeat("€", 5), 2, "€€", true},
+	}
+	for _, tt := range tests {
+		got, truncated := truncate(tt.s, tt.n)
+		if got != tt.want || truncated != tt.truncated {
+			t.Errorf("truncate(%q, %d) = %q, %v, want %q, %v", tt.s, tt.n, got, truncated, tt.want, tt.truncated)
+		}
+	}
+}
+
+// isRawMessage reports whether v is a json.RawMessage, logged as a nested
+// object.
+func isRawMessage(v interface{}) bool {
+	_, ok := v.(json.RawMessage)
+	return ok
+}
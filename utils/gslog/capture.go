@@ -0,0 +1,69 @@
+package gslog
+
+import (
+	"sync"
+)
+
+// BodyCapture keeps the first bytes of a body being streamed, to be logged
+// once it was consumed, and counts all of them. Only the first maxBodyLength
+// bytes (see LoggerConfig) are retained, so large bodies are not held in
+// memory.
+//
+// It's safe for concurrent use, as the body may be written by a goroutine
+// other than the one logging it.
+type BodyCapture struct {
+
+	// mu synchronizes the access to the other fields.
+	mu    sync.Mutex
+
+	// buf holds the first bytes written, up to limit.
+	buf   []byte
+
+	// limit is the number of bytes retained. If <= 0, every byte is.
+	limit int
+
+	// total is the number of bytes written.
+	total int64
+}
+
+// NewBodyCapture returns an empty BodyCapture retaining up to the currently
+// configured maxBodyLength bytes.
+func NewBodyCapture() *BodyCapture {
+	return &BodyCapture{limit: current().maxBodyLength}
+}
+
+// Write retains the bytes of p that fit in the capture and counts all of
+// them. Never fails, so it can be used with io.TeeReader and io.MultiWriter.
+func (c *BodyCapture) Write(p []byte) (int, error) {
+	n := len(p)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total += int64(n)
+	if c.limit <= 0 {
+		c.buf = append(c.buf, p...)
+	} else if room := c.limit - len(c.buf); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		c.buf = append(c.buf, p...)
+	}
+	return n, nil
+}
+
+// Total returns the number of bytes written.
+func (c *BodyCapture) Total() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// snapshot returns a copy of the bytes retained and the number of bytes
+// written.
+func (c *BodyCapture) snapshot() ([]byte, int64) {
+	if c == nil {
+		return nil, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.buf...), c.total
+}
@@ -0,0 +1,73 @@
+package gslog
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestBodyCaptureRetainsUpToLimit(t *testing.T) {
+	c := &BodyCapture{limit: 5}
+	for _, chunk := range []string{"abc", "defg", "hij"} {
+		if n, err := c.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v, want %d, nil", chunk, n, err, len(chunk))
+		}
+	}
+	raw, total := c.snapshot()
+	if string(raw) != "abcde" || total != 10 || c.Total() != 10 {
+		t.Errorf("snapshot = %q, %d, want \"abcde\", 10", raw, total)
+	}
+}
+
+func TestBodyCaptureWithoutLimit(t *testing.T) {
+	c := &BodyCapture{}
+	c.Write([]byte(strings.Repeat("a", 3000)))
+	if raw, total := c.snapshot(); len(raw) != 3000 || total != 3000 {
+		t.Errorf("snapshot = %d bytes, %d, want every byte", len(raw), total)
+	}
+}
+
+func TestBodyCaptureUsesConfiguredLength(t *testing.T) {
+	maxBodyLength := 8
+	ConfigureLog(LoggerConfig{MaxBodyLength: &maxBodyLength})
+	t.Cleanup(func() { ConfigureLog(LoggerConfig{}) })
+
+	c := NewBodyCapture()
+	c.Write([]byte("0123456789"))
+	if raw, total := c.snapshot(); string(raw) != "01234567" || total != 10 {
+		t.Errorf("snapshot = %q, %d, want \"01234567\", 10", raw, total)
+	}
+}
+
+func TestBodyCaptureSnapshotIsACopy(t *testing.T) {
+	c := &BodyCapture{}
+	c.Write([]byte("abc"))
+	raw, _ := c.snapshot()
+	raw[0] = 'x'
+	if again, _ := c.snapshot(); string(again) != "abc" {
+		t.Errorf("snapshot = %q after modifying a previous one", again)
+	}
+	var none *BodyCapture
+	if raw, total := none.snapshot(); raw != nil || total != 0 {
+		t.Errorf("nil snapshot = %q, %d, want nothing", raw, total)
+	}
+}
+
+func TestBodyCaptureConcurrentWrites(t *testing.T) {
+	c := &BodyCapture{limit: 100}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Write([]byte("ab"))
+				c.Total()
+			}
+		}()
+	}
+	wg.Wait()
+	if raw, total := c.snapshot(); len(raw) != 100 || total != 2000 {
+		t.Errorf("snapshot = %d bytes, %d, want 100, 2000", len(raw), total)
+	}
+}
@@ -0,0 +1,203 @@
+package gslog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// Handler implements slog.Handler, writing the records with the same format
+// (and to the same output) as the rest of this package. The attributes of the
+// records are written in the "fields" property of the log line.
+//
+// To make the libraries logging through slog (or the log package) use it:
+//
+//	slog.SetDefault(slog.New(gslog.NewHandler()))
+type Handler struct {
+
+	// attrs are the attributes added with WithAttrs, already nested in the
+	// groups opened when they were added.
+	attrs  []slog.Attr
+
+	// groups are the names of the groups opened with WithGroup, in order.
+	groups []string
+}
+
+// NewHandler returns a new Handler without attributes.
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+// Enabled reports whether records of the given level are written, according
+// to the configured minimum level.
+func (h *Handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return current().minLogLevel <= fromSlogLevel(level)
+}
+
+// Handle writes the record, with the trace ID and span ID held by ctx (see
+// SetTraceIDExtractor and SetSpanIDExtractor).
+func (h *Handler) Handle(ctx context.Context, r slog.Record) error {
+
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	fields := make(map[string]interface{})
+	for _, a := range h.attrs {
+		addField(fields, a)
+	}
+	for _, a := range nest(h.groups, attrs) {
+		addField(fields, a)
+	}
+	if len(fields) == 0 {
+		fields = nil
+	}
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	l := &customLog{
+		Time: formatTime(t),
+		TraceID: traceID(ctx),
+		SpanID: spanID(ctx),
+		Level: fromSlogLevel(r.Level).String(),
+		Type: MESSAGE,
+		Message: r.Message,
+		Fields: fields,
+	}
+
+	// Get caller function and code line from the record.
+	fn, line := "function not available", -1
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		fn, line = frame.File, frame.Line
+	}
+	l.printAt(fn, line)
+	return nil
+}
+
+// WithAttrs returns a copy of the handler writing the given attributes in
+// every record, inside the groups currently opened.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	c := h.clone()
+	c.attrs = append(c.attrs, nest(h.groups, attrs)...)
+	return c
+}
+
+// WithGroup returns a copy of the handler writing the attributes added
+// afterwards inside a group with the given name.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	c := h.clone()
+	c.groups = append(c.groups, name)
+	return c
+}
+
+// clone returns a copy of the handler which can be modified without changing
+// the original one.
+func (h *Handler) clone() *Handler {
+	return &Handler{
+		attrs:  append([]slog.Attr(nil), h.attrs...),
+		groups: append([]string(nil), h.groups...),
+	}
+}
+
+// nest returns the attributes inside the given groups, from the outermost to
+// the innermost.
+func nest(groups []string, attrs []slog.Attr) []slog.Attr {
+	if len(attrs) == 0 {
+		return nil
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		attrs = []slog.Attr{{Key: groups[i], Value: slog.GroupValue(attrs...)}}
+	}
+	return attrs
+}
+
+// addField adds the attribute to the fields of a log line. Groups are written
+// as nested objects, merged with the ones already present with the same name.
+func addField(fields map[string]interface{}, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() != slog.KindGroup {
+		fields[a.Key] = fieldValue(a.Value)
+		return
+	}
+	group := a.Value.Group()
+	if len(group) == 0 {
+		return
+	}
+	// Attributes of groups without a name are added to the enclosing level.
+	if a.Key == "" {
+		for _, ga := range group {
+			addField(fields, ga)
+		}
+		return
+	}
+	sub, ok := fields[a.Key].(map[string]interface{})
+	if !ok {
+		sub = make(map[string]interface{})
+		fields[a.Key] = sub
+	}
+	for _, ga := range group {
+		addField(sub, ga)
+	}
+}
+
+// fieldValue returns the value to be marshaled as JSON for the given
+// (resolved, not group) slog value.
+func fieldValue(v slog.Value) interface{} {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return x.Error()
+		case fmt.Stringer:
+			return x.String()
+		}
+	}
+	return v.Any()
+}
+
+// fromSlogLevel returns the LogLevel matching the given slog.Level. Levels
+// between two slog levels are rounded down.
+func fromSlogLevel(level slog.Level) LogLevel {
+	switch {
+	case level >= slog.LevelError:
+		return ERROR
+	case level >= slog.LevelWarn:
+		return WARN
+	case level >= slog.LevelInfo:
+		return INFO
+	}
+	return DEBUG
+}
+
+// toSlogLevel returns the slog.Level matching the given LogLevel.
+func toSlogLevel(level LogLevel) slog.Level {
+	switch level {
+	case ERROR:
+		return slog.LevelError
+	case WARN:
+		return slog.LevelWarn
+	case INFO:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
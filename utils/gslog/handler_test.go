@@ -0,0 +1,133 @@
+package gslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureLines redirects the log lines written during the test to the returned
+// buffer.
+func captureLines(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	SetOutput(&buf)
+	t.Cleanup(func() { SetOutput(os.Stderr) })
+	return &buf
+}
+
+// lines parses the log lines written to buf, without their prefix.
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var parsed []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		_, js, found := strings.Cut(line, "] ")
+		if !found {
+			t.Fatalf("line without prefix: %s", line)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(js), &m); err != nil {
+			t.Fatalf("invalid line %s: %v", js, err)
+		}
+		parsed = append(parsed, m)
+	}
+	return parsed
+}
+
+// ctxKeyTest is the key of the trace ID in the contexts of these tests.
+type ctxKeyTest int
+
+func TestHandlerWritesFieldsAndGroups(t *testing.T) {
+	buf := captureLines(t)
+
+	logger := slog.New(NewHandler()).With("user_id", 7).WithGroup("req").With("method", "GET")
+	logger.Warn("Slow request", "elapsed", 1500*time.Millisecond, slog.Group("db", "rows", 3), "err", errors.New("timeout"))
+
+	got := lines(t, buf)
+	if len(got) != 1 {
+		t.Fatalf("got %d lines, want 1", len(got))
+	}
+	l := got[0]
+	if l["level"] != "WARN" || l["message"] != "Slow request" || l["type"] != "MESSAGE" {
+		t.Errorf("line = %v, want a WARN message", l)
+	}
+	fields, _ := json.Marshal(l["fields"])
+	want := `{"req":{"db":{"rows":3},"elapsed":"1.5s","err":"timeout","method":"GET"},"user_id":7}`
+	if string(fields) != want {
+		t.Errorf("fields = %s, want %s", fields, want)
+	}
+}
+
+func TestHandlerWritesTraceIDFromContext(t *testing.T) {
+	buf := captureLines(t)
+	SetTraceIDExtractor(func(ctx context.Context) string {
+		id, _ := ctx.Value(ctxKeyTest(0)).(string)
+		return id
+	})
+	t.Cleanup(func() { SetTraceIDExtractor(func(ctx context.Context) string { return "" }) })
+
+	ctx := context.WithValue(context.Background(), ctxKeyTest(0), "trace-1")
+	slog.New(NewHandler()).InfoContext(ctx, "Hello")
+
+	if got := lines(t, buf); len(got) != 1 || got[0]["trace_id"] != "trace-1" {
+		t.Errorf("lines = %v, want one with trace_id trace-1", got)
+	}
+}
+
+func TestHandlerRespectsMinimumLevel(t *testing.T) {
+	buf := captureLines(t)
+	level := WARN
+	ConfigureLog(LoggerConfig{Level: &level})
+	t.Cleanup(func() { ConfigureLog(LoggerConfig{}) })
+
+	logger := slog.New(NewHandler())
+	logger.Info("Hidden")
+	logger.Error("Shown")
+
+	got := lines(t, buf)
+	if len(got) != 1 || got[0]["message"] != "Shown" {
+		t.Errorf("lines = %v, want only the ERROR one", got)
+	}
+}
+
+func TestLoggerFieldsFromContext(t *testing.T) {
+	buf := captureLines(t)
+
+	ctx := NewContext(context.Background(), FromContext(context.Background()).With("request", "abc"))
+	FromContext(ctx).With("step", 2).Info("Done")
+
+	got := lines(t, buf)
+	if len(got) != 1 {
+		t.Fatalf("got %d lines, want 1", len(got))
+	}
+	fields, _ := json.Marshal(got[0]["fields"])
+	if string(fields) != `{"request":"abc","step":2}` {
+		t.Errorf("fields = %s, want the ones of the context and the logger", fields)
+	}
+}
+
+func TestFromSlogLevel(t *testing.T) {
+	tests := []struct {
+		level slog.Level
+		want  LogLevel
+	}{
+		{slog.LevelDebug - 4, DEBUG},
+		{slog.LevelInfo, INFO},
+		{slog.LevelInfo + 2, INFO},
+		{slog.LevelWarn, WARN},
+		{slog.LevelError + 4, ERROR},
+	}
+	for _, tt := range tests {
+		if got := fromSlogLevel(tt.level); got != tt.want {
+			t.Errorf("fromSlogLevel(%s) = %s, want %s", tt.level, got, tt.want)
+		}
+	}
+}
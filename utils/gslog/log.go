@@ -1,10 +1,11 @@
 package gslog
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"log"
 	"runtime"
+	"strings"
 )
 
 // MaxPrefixLength specifies the number of characters that will compose the
@@ -27,55 +28,134 @@ const (
 
 // LogLevel specifies the level (INFO, DEBUG, etc.) with which a log line will
 // be written.
-type logLevel int
+type LogLevel int
 
 const (
-	DEBUG logLevel = iota
+	DEBUG LogLevel = iota
 	INFO
 	WARN
 	ERROR
 )
 
+// levelNames contains the name of every LogLevel, in order.
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// ParseLevel returns the LogLevel with the given name (DEBUG, INFO, WARN or
+// ERROR), case insensitive.
+func ParseLevel(name string) (LogLevel, error) {
+	for i, n := range levelNames {
+		if strings.EqualFold(n, strings.TrimSpace(name)) {
+			return LogLevel(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q, expected one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// String returns the name of the level.
+func (l LogLevel) String() string {
+	if l < DEBUG || l > ERROR {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// Implements interface json.Marshaler. Levels are written by name.
+func (l LogLevel) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// Implements interface json.Unmarshaler. Accepts the name of the level or its
+// number (0 for DEBUG up to 3 for ERROR).
+func (l *LogLevel) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		level, err := ParseLevel(name)
+		if err != nil {
+			return err
+		}
+		*l = level
+		return nil
+	}
+	var n int
+	if err := json.Unmarshal(b, &n); err != nil || n < int(DEBUG) || n > int(ERROR) {
+		return fmt.Errorf("invalid log level %s, expected one of %s", string(b), strings.Join(levelNames, ", "))
+	}
+	*l = LogLevel(n)
+	return nil
+}
+
 // customLog is the main struct of this package and contains all the information 
 // to be logged. 'Method', 'Url', 'Headers' and 'Body' should be used only by Handlers
 // and Transports that need to log HTTP request and response.
 type customLog struct {
-	Time     string              `json:"time,omitempty"`
-	TraceID  string 			 `json:"trace_id,omitempty"`
-	Level 	 string 			 `json:"level,omitempty"`
-	Type  	 logType 			 `json:"type,omitempty"`
-	Message  string 			 `json:"message,omitempty"`
-	Method   string              `json:"method,omitempty"`
-	Url      string              `json:"url,omitempty"`
-	Status   int                 `json:"status,omitempty"`
-	Headers  map[string][]string `json:"headers,omitempty"`
-	Body 	 string 			 `json:"body,omitempty"`
+	Time          string                 `json:"time,omitempty"`
+	TraceID       string                 `json:"trace_id,omitempty"`
+	SpanID        string                 `json:"span_id,omitempty"`
+	Level         string                 `json:"level,omitempty"`
+	Type          logType                `json:"type,omitempty"`
+	Message       string                 `json:"message,omitempty"`
+	Fields        map[string]interface{} `json:"fields,omitempty"`
+	Method        string                 `json:"method,omitempty"`
+	Url           string                 `json:"url,omitempty"`
+	Status        int                    `json:"status,omitempty"`
+	Headers       map[string][]string    `json:"headers,omitempty"`
+	Body          interface{}            `json:"body,omitempty"`
+	BodySize      int64                  `json:"body_size,omitempty"`
+	BodyTruncated bool                   `json:"body_truncated,omitempty"`
+	DurationMs    float64                `json:"duration_ms,omitempty"`
 }
 
 // toString is an internal function to get a Log instance as a JSON string.
 
 // Note: if json.Marshal throws an error, this code will panic.
-// No application should run with logging errors.
+// No application should run with logging errors. Fields that can't be
+// marshaled are written with their default format instead.
 func (l *customLog) toString() string {
-	logJson, err := json.Marshal(l)
+	logJson, err := marshal(l)
+	if err != nil && l.Fields != nil {
+		for k, v := range l.Fields {
+			if _, e := json.Marshal(v); e != nil {
+				l.Fields[k] = fmt.Sprintf("%+v", v)
+			}
+		}
+		logJson, err = marshal(l)
+	}
 	if err != nil {
 		panic(err)
 	}
-	return string(logJson)
+	return logJson
+}
+
+// marshal returns the log as JSON, without escaping HTML characters so that
+// XML bodies are readable.
+func marshal(l *customLog) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(l); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
 } 
 
-// Prints to output writer a new log struct. 
-func (l *customLog) print() {
+// Prints to output writer a new log struct. The code line written in the
+// prefix is the one skip frames above this function: 1 for its caller, 2 for
+// the caller of its caller, etc.
+func (l *customLog) print(skip int) {
 
 	// Get caller function and code line.
-	// A skip value of 2 is used because the first caller to this function
-	// is allways another function from this package.
-	_, fn, line, ok := runtime.Caller(2)
+	_, fn, line, ok := runtime.Caller(skip)
 
 	if !ok {
 		fn = "function not available"
 		line = -1
 	}
+	l.printAt(fn, line)
+}
+
+// printAt prints to output writer a new log struct, with the given file and
+// code line in the prefix.
+func (l *customLog) printAt(fn string, line int) {
 
 	// Set and truncate the log line's prefix.
 	prefix := fn + ":" + fmt.Sprint(line)
@@ -83,5 +163,5 @@ func (l *customLog) print() {
 		prefix = prefix[len(prefix)-MaxPrefixLength:]
 	}
 
-	log.Printf("[%s] %s\n", prefix, l.toString())
+	writeLine(fmt.Sprintf("[%s] %s\n", prefix, l.toString()))
 }
\ No newline at end of file
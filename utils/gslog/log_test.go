@@ -0,0 +1,42 @@
+package gslog
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  LogLevel
+		valid bool
+	}{
+		{"DEBUG", DEBUG, true},
+		{" warn ", WARN, true},
+		{"Error", ERROR, true},
+		{"TRACE", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.name)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %s, %v, want %s, valid %t", tt.name, got, err, tt.want, tt.valid)
+		}
+	}
+}
+
+func TestLogLevelJSON(t *testing.T) {
+	var levels []LogLevel
+	if err := json.Unmarshal([]byte(`["info", 3]`), &levels); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(levels) != 2 || levels[0] != INFO || levels[1] != ERROR {
+		t.Fatalf("levels = %v, want [INFO ERROR]", levels)
+	}
+	data, _ := json.Marshal(levels)
+	if string(data) != `["INFO","ERROR"]` {
+		t.Errorf("json = %s, want the level names", data)
+	}
+	if err := json.Unmarshal([]byte(`7`), &levels[0]); err == nil {
+		t.Error("expected an error for an unknown level number")
+	}
+}
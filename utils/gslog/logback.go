@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"gopkg.in/natefinch/lumberjack.v2"
@@ -23,6 +24,16 @@ var defaultMaxBackups int = 10
 // be stored before being deleted.
 var defaultMaxAge int = 5
 
+// output is the writer every log line is written to. See SetOutput.
+var output io.Writer = os.Stderr
+
+// outputMu serializes the writes to output, so that lines are not mixed.
+var outputMu sync.Mutex
+
+// logFile is the lumberjack logger currently writing the log files. Kept to be
+// able to close it on shutdown.
+var logFile *lumberjack.Logger
+
 // LogFileConfig contains the configuration properties of the log files.
 type LogFileConfig struct {
 	MaxSize    *int `json:"max_size"`
@@ -71,5 +82,47 @@ func ConfigureLogFile(c LogFileConfig) {
 	// stdout and stored in a log file as well.
 	multiWriter := io.MultiWriter(os.Stdout, lumberjackLogger)
 	log.SetOutput(multiWriter)
+	SetOutput(multiWriter)
+	logFile = lumberjackLogger
+
+}
+
+// Close closes the current log file and the access log file, if any. Lines
+// logged afterwards are only written to stdout.
+func Close() error {
+	accessErr := closeAccessFile()
+	if logFile == nil {
+		return accessErr
+	}
+	// The log package may have been redirected to Handler in the meantime.
+	outputMu.Lock()
+	if log.Writer() == output {
+		log.SetOutput(os.Stdout)
+	}
+	outputMu.Unlock()
+	SetOutput(os.Stdout)
+	err := logFile.Close()
+	logFile = nil
+	if err == nil {
+		err = accessErr
+	}
+	return err
+}
+
+// SetOutput sets the writer every log line is written to, which is stderr
+// until ConfigureLogFile is called.
+//
+// Lines are not written through the log package, so that its output can be
+// redirected to Handler (see slog.SetDefault) without writing them twice.
+func SetOutput(w io.Writer) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	output = w
+}
 
+// writeLine writes a whole line to the output.
+func writeLine(line string) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	io.WriteString(output, line)
 }
\ No newline at end of file
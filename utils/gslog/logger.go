@@ -1,64 +1,154 @@
 package gslog
 
 import (
-	"bytes"
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"log"
 	"net/http"
-	"regexp"
-	"strings"
+	"sync/atomic"
 	"time"
 )
 
-// minLogLevel specifies the log level from which the lines will be written.
-// The order is DEBUG < INFO < WARN < ERROR.
-var minLogLevel logLevel = INFO
+// defaultMinLogLevel specifies the log level from which the lines will be
+// written if none is configured. The order is DEBUG < INFO < WARN < ERROR.
+const defaultMinLogLevel LogLevel = INFO
 
-// maxBodyLength specifies the number of characters of the request/response 
-// body to be logged.
-var maxBodyLength int = 1000
+// defaultMaxBodyLength specifies the number of characters of the request/response
+// body to be logged if none is configured.
+const defaultMaxBodyLength int = 1000
 
-// excludeUrls is a set (sort of) of urls that, if found in a request, its
-// request and response won't be logged.
-var excludeUrls map[string] struct{}
+// settings holds the current *loggerSettings. It's replaced as a whole every
+// time the logger is configured, so it can be safely read by concurrent
+// requests while the configuration is reloaded.
+var settings atomic.Value
+
+// loggerSettings contains the resolved configuration of the logger.
+type loggerSettings struct {
+
+	// minLogLevel specifies the log level from which the lines will be written.
+	minLogLevel    LogLevel
+
+	// maxBodyLength specifies the number of characters of the request/response
+	// body to be logged.
+	maxBodyLength  int
+
+	// excludeUrls is a set (sort of) of urls that, if found in a request, its
+	// request and response won't be logged.
+	excludeUrls    map[string]struct{}
+
+	// redactor redacts the sensitive data of the requests and responses
+	// logged, unless one of routeRedactors matches the url.
+	redactor       *redactor
+
+	// routeRedactors are the redactors of specific urls.
+	routeRedactors []routeRedactor
+
+	// access contains the settings of the access log.
+	access         *accessSettings
+}
 
 // LogConfig contains the configuration properties used in the logging. If this
 // function is not called, default values will be used.
 type LoggerConfig struct {
 
-	// Level allows the configuration of the internal var minLogLevel.
-	Level         *logLevel `json:"level"`
+	// Level allows the configuration of the minimum level logged.
+	Level         *LogLevel        `json:"level"`
+
+	// MaxBodyLength allows the configuration of the maximum body length logged.
+	MaxBodyLength *int             `json:"max_body_length"`
+
+	// ExcludeUrls specifies the urls whose requests and responses won't be logged.
+	ExcludeUrls   []string         `json:"exclude_urls"`
 
-	// MaxBodyLength allows the configuration of hte internal var maxBodyLength.
-	MaxBodyLength *int      `json:"max_body_length"`
+	// Redact allows the configuration of the redaction of sensitive data in
+	// the requests and responses logged. Authorization and cookie headers and
+	// token request and response secrets are redacted by default.
+	Redact        *RedactConfig    `json:"redact"`
 
-	// ExcludeUrls specifies the urls to be added to the internal set excludeUrls.
-	ExcludeUrls   []string  `json:"exclude_urls"`
+	// Access allows the configuration of the access log, which has one line
+	// per request received and is written to its own file.
+	Access        *AccessLogConfig `json:"access"`
 }
 
-// Initialization. Only initializes the excludeUrls map.
+// Initialization. Only sets the default settings.
 func init() {
-	excludeUrls = make(map[string]struct{})
+	ConfigureLog(LoggerConfig{})
 }
 
-// ConfigureLog enables the configuration of the logger.
+// ConfigureLog enables the configuration of the logger. Every call replaces the
+// whole configuration: properties not set go back to their defaults.
 func ConfigureLog(c LoggerConfig) {
+	s := &loggerSettings{
+		minLogLevel:   defaultMinLogLevel,
+		maxBodyLength: defaultMaxBodyLength,
+		excludeUrls:   make(map[string]struct{}),
+	}
 	if c.Level != nil {
-		minLogLevel = *c.Level
+		s.minLogLevel = *c.Level
 	}
 	if c.MaxBodyLength != nil {
-		maxBodyLength = *c.MaxBodyLength
+		s.maxBodyLength = *c.MaxBodyLength
+	}
+	for _, url := range c.ExcludeUrls {
+		s.excludeUrls[url] = struct{}{}
+	}
+	s.redactor, s.routeRedactors = newRedactors(c.Redact)
+	s.access = newAccessSettings(c.Access)
+	settings.Store(s)
+}
+
+// current returns the current settings of the logger.
+func current() *loggerSettings {
+	return settings.Load().(*loggerSettings)
+}
+
+// excluded reports whether the requests to the given path shouldn't be logged.
+func (s *loggerSettings) excluded(path string) bool {
+	_, ok := s.excludeUrls[path]
+	return ok
+}
+
+// traceIDExtractor returns the trace ID held by a context. See
+// SetTraceIDExtractor.
+var traceIDExtractor atomic.Value
+
+// spanIDExtractor returns the span ID held by a context. See SetSpanIDExtractor.
+var spanIDExtractor atomic.Value
+
+// SetTraceIDExtractor sets the function used to get the trace ID from the
+// context given to FromContext and Handler. This package doesn't know where
+// the trace ID is kept.
+func SetTraceIDExtractor(fn func(ctx context.Context) string) {
+	traceIDExtractor.Store(fn)
+}
+
+// SetSpanIDExtractor sets the function used to get the span ID from the
+// context of the requests logged, so that log lines can be correlated with
+// traces. This package doesn't know where the span ID is kept.
+func SetSpanIDExtractor(fn func(ctx context.Context) string) {
+	spanIDExtractor.Store(fn)
+}
+
+// traceID returns the trace ID held by the given context, or the empty string
+// if there's none or no extractor is set.
+func traceID(ctx context.Context) string {
+	if fn, ok := traceIDExtractor.Load().(func(ctx context.Context) string); ok {
+		return fn(ctx)
 	}
-	if c.ExcludeUrls != nil {
-		for _, url := range c.ExcludeUrls {
-			excludeUrls[url] = struct{}{}
-		}
+	return ""
+}
+
+// spanID returns the span ID held by the given context, or the empty string if
+// there's none or no extractor is set.
+func spanID(ctx context.Context) string {
+	if fn, ok := spanIDExtractor.Load().(func(ctx context.Context) string); ok {
+		return fn(ctx)
 	}
+	return ""
 }
 
 // logMessage writes a new log line. Receives the level, message and traceID.
+// Must be called directly by the exported functions, so that the code line of
+// their caller is logged.
 func logMessage(level string, m string, traceID string) {
 	l := &customLog{
 		Time: timeString(),
@@ -67,26 +157,26 @@ func logMessage(level string, m string, traceID string) {
 		Type: MESSAGE,
 		Message: m,
 	}
-	l.print()
+	l.print(3)
 }
 
 // Debug creates a Log with the given message and Level DEBUG and prints it.
 func Debug(m string, traceID string) {
-	if minLogLevel <= DEBUG {
+	if current().minLogLevel <= DEBUG {
 		logMessage("DEBUG", m, traceID)
 	}
 }
 
 // Info creates a Log with the given message and Level INFO and prints it.
 func Info(m string, traceID string) {
-	if minLogLevel <= INFO {
+	if current().minLogLevel <= INFO {
 		logMessage("INFO", m, traceID)
 	}
 }
 
 // Warn creates a Log with the given message and Level WARN and prints it.
 func Warn(m string, traceID string) {
-	if minLogLevel <= WARN {
+	if current().minLogLevel <= WARN {
 		logMessage("WARN", m, traceID)
 	}
 }
@@ -96,142 +186,150 @@ func Error(m string, traceID string) {
 	logMessage("ERROR", m, traceID)
 }
 
-// ErrorFrom creates a Log from the given Error and prints it.
+// ErrorFrom creates a Log from the given Error and prints it. If the error
+// has fields to be logged with it (implementing LogFields, as apierrors.Error
+// does), they are written in the fields property.
 func ErrorFrom(err error, traceID string) {
-	Error(err.Error(), traceID)
+	logError("ERROR", err, traceID)
+}
+
+// WarnFrom is like ErrorFrom, with Level WARN, for errors which are not a
+// failure of the server (for example, invalid requests).
+func WarnFrom(err error, traceID string) {
+	if current().minLogLevel <= WARN {
+		logError("WARN", err, traceID)
+	}
+}
+
+// logError creates a Log from the given Error, with its fields, and prints it.
+func logError(level string, err error, traceID string) {
+	l := &customLog{
+		Time: timeString(),
+		TraceID: traceID,
+		Level: level,
+		Type: MESSAGE,
+		Message: err.Error(),
+	}
+	if lf, ok := err.(interface{ LogFields() map[string]interface{} }); ok {
+		l.Fields = lf.LogFields()
+	}
+	l.print(3)
 }
 
 // Server writes the message with the following format: [server - %time] %s.
 // This function is only meant to be called when starting up a server. Any
 // program watching log files should ignore the lines logged by this function.
 func Server(m string) {
-	log.Printf("[server/%s] %s\n", timeString(), m)
+	writeLine(fmt.Sprintf("[server/%s] %s\n", timeString(), m))
 }
 
 // Request writes a new line to the log containing all the relevant information
-// of an http.Request, if its path shouldn't be excluded.
+// of an http.Request, if its path shouldn't be excluded. The body is taken from
+// the given capture (nil if the request has no body), as the request's one is
+// being streamed; see BodyCapture.
 //
 // LogType is received but only OUTER_REQUEST and INNER_REQUEST should be passed.
-func Request(t logType, r *http.Request, trace string) {
+func Request(t logType, r *http.Request, body *BodyCapture, trace string) {
 
 	// Check if the recieved url should be excluded from log.
-	if _, ok := excludeUrls[r.URL.Path]; ok {
+	s := current()
+	if s.excluded(r.URL.Path) {
 		return;
 	}
 
-	// Extract request body leaving the Reader untouched.
-	body := ""
-	if r.Body != nil {
-		buf, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			ErrorFrom(err, trace)
-		} else {
-			body = string(buf)
-			r.Body = io.NopCloser(bytes.NewReader(buf))
-		}
-	}
-
-	// Write the log line to output.
+	// Write the log line to output, without sensitive data.
+	rd := s.redactorFor(r.URL.Path)
 	l := &customLog{
 		Time: timeString(),
 		TraceID: trace,
+		SpanID: spanID(r.Context()),
 		Level: "INFO",
 		Type: t,
 		Method: r.Method,
 		Url: r.URL.Host + r.URL.Path,
-		Headers: r.Header,
-		Body: stringUpperBound(trim(body), maxBodyLength),
+		Headers: rd.redactHeaders(r.Header),
 	}
-	l.print()
+	raw, size := body.snapshot()
+	formatBody(raw, size, r.Header.Get("Content-Type"), rd, s.maxBodyLength).set(l)
+	l.print(2)
 }
 
 // Response allows to log an http.Response. Allows trace id to be specified.
 // Logs information from the http.Request that was sent to obtain the given response.
-func Response(r *http.Response, trace string) {
+// The body is taken from the given capture and d is the time elapsed since
+// the request was sent.
+func Response(r *http.Response, body *BodyCapture, d time.Duration, trace string) {
 
 	// Check if the recieved url should be excluded from log.
-	if _, ok := excludeUrls[r.Request.URL.Path]; ok {
+	s := current()
+	if s.excluded(r.Request.URL.Path) {
 		return;
 	}
 
-	// Extract request body leaving the Reader untouched.
-	body := ""
-	if r.Body != nil {
-		buf, err := ioutil.ReadAll(r.Body)
-		if err != nil {
-			ErrorFrom(err, trace)
-		} else {
-			body = string(buf)
-			r.Body = io.NopCloser(bytes.NewReader(buf))
-		}
-	}
-
-	// Write the log line to output.
+	// Write the log line to output, without sensitive data.
+	rd := s.redactorFor(r.Request.URL.Path)
 	l := &customLog{
 		Time: timeString(),
 		TraceID: trace,
+		SpanID: spanID(r.Request.Context()),
 		Level: "INFO",
 		Type: INNER_RESPONSE,
 		Method: r.Request.Method,
 		Url: r.Request.URL.Host + r.Request.URL.Path,
 		Status: r.StatusCode,
-		Headers: r.Header,
-		Body: stringUpperBound(trim(body), maxBodyLength),
+		Headers: rd.redactHeaders(r.Header),
+		DurationMs: milliseconds(d),
 	}
-	l.print()
+	raw, size := body.snapshot()
+	formatBody(raw, size, r.Header.Get("Content-Type"), rd, s.maxBodyLength).set(l)
+	l.print(2)
 }
 
 // ResponseWriter allows to log a controller response. Allows trace id to be specified.
 // Receives the http.Request that was received that ended in the given response and logs
-// information from it.
-func ResponseWriter(rwBody *bytes.Buffer, rwHeaders http.Header, status int, 
-	r *http.Request, trace string) {
+// information from it. The body is taken from the given capture and d is the
+// time elapsed since the request was received.
+func ResponseWriter(body *BodyCapture, rwHeaders http.Header, status int, 
+	r *http.Request, d time.Duration, trace string) {
 	
 	// Check if the recieved url should be excluded from log.
-	if _, ok := excludeUrls[r.URL.Path]; ok {
+	s := current()
+	if s.excluded(r.URL.Path) {
 		return;
 	}
 
+	rd := s.redactorFor(r.URL.Path)
 	l := &customLog{
 		Time: timeString(),
 		TraceID: trace,
+		SpanID: spanID(r.Context()),
 		Level: "INFO",
 		Type: OUTER_RESPONSE,
 		Method: r.Method,
 		Url: r.URL.Host + r.URL.Path,
 		Status: status,
-		Headers: rwHeaders,
-		Body: stringUpperBound(rwBody.String(), maxBodyLength),
+		Headers: rd.redactHeaders(rwHeaders),
+		DurationMs: milliseconds(d),
 	}
-	l.print()
-}
-
-// trim revomes newlines (works for Windows and Linux) and whitespace.
-func trim(s string) string {
-	re := regexp.MustCompile(`\r?\n`)
-	resp := re.ReplaceAllString(s, " ")
-	resp = strings.ReplaceAll(resp, " ", "")
-	return resp
+	raw, size := body.snapshot()
+	formatBody(raw, size, rwHeaders.Get("Content-Type"), rd, s.maxBodyLength).set(l)
+	l.print(2)
 }
 
-// stringUpperBound Returns first n characters of string or s if len(s) < n.
-// This is useful for adding upper bound to strings.
-//
-// If n <= 0, returns s.
-func stringUpperBound(s string, n int) string {
-	if n <= 0 {
-		return s
-	}
-	if len(s) < n {
-		return s
-	}
-	return s[:n]
+// milliseconds returns the duration in milliseconds, with microsecond
+// precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
 }
 
 // timeString returns the current time in the following format:
 // yyyy-mm-ddTHH:mm:ss.SSS
 func timeString() string {
-	t := time.Now()
+	return formatTime(time.Now())
+}
+
+// formatTime returns the given time in the format of timeString.
+func formatTime(t time.Time) string {
 	return fmt.Sprintf("%d-%02d-%02dT%02d:%02d:%02d.%03d", 
 		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/int(time.Millisecond))
 }
\ No newline at end of file
@@ -0,0 +1,591 @@
+package gslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// defaultMask replaces the redacted values if no mask is configured.
+const defaultMask = "****"
+
+// defaultRedactedHeaders are the headers redacted if none are configured.
+var defaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// defaultRedactedFields are the JSON body properties and form fields redacted
+// if none are configured. They cover the token requests and responses of
+// gsclient.TokenSource.
+var defaultRedactedFields = []string{"password", "client_secret", "access_token", "refresh_token", "id_token"}
+
+// maskPattern is a predefined pattern of sensitive data.
+type maskPattern struct {
+
+	// re matches the candidates.
+	re    *regexp.Regexp
+
+	// valid reports whether a candidate must be masked. If nil, every
+	// candidate is.
+	valid func(s string) bool
+}
+
+// maskPatterns are the predefined patterns that can be referenced by name in
+// RedactConfig.Patterns.
+var maskPatterns = map[string]maskPattern{
+	"CARD_NUMBER": {re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: luhn},
+	"EMAIL":       {re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	"DNI":         {re: regexp.MustCompile(`\b\d{1,2}\.?\d{3}\.?\d{3}\b`)},
+}
+
+// RedactConfig contains the configuration of the redaction of sensitive data
+// in the requests and responses logged. Every field is optional and, if not
+// set (null), its default is used. An empty list disables that redaction.
+type RedactConfig struct {
+
+	// Headers are the names of the headers whose values are redacted. If not
+	// set, defaultRedactedHeaders are.
+	Headers    []string            `json:"headers"`
+
+	// BodyFields are the properties of JSON bodies whose values are redacted.
+	// An entry starting with "$." is a path from the root of the body (like
+	// $.user.card.number), in which arrays are traversed transparently. Any
+	// other entry is a property name, redacted at any depth. Both are case
+	// insensitive. If not set, defaultRedactedFields are.
+	BodyFields []string            `json:"body_fields"`
+
+	// FormFields are the fields of url encoded form bodies whose values are
+	// redacted. If not set, defaultRedactedFields are.
+	FormFields []string            `json:"form_fields"`
+
+	// Patterns are regular expressions, or names of predefined patterns
+	// (CARD_NUMBER, EMAIL or DNI), whose matches in bodies are redacted. None
+	// by default.
+	Patterns   []string            `json:"patterns"`
+
+	// Mask replaces every value redacted. If not set, defaultMask is used.
+	Mask       *string             `json:"mask"`
+
+	// Routes override the properties above for the urls matching their path.
+	Routes     []RouteRedactConfig `json:"routes"`
+}
+
+// RouteRedactConfig overrides the redaction of the requests and responses of
+// the urls matching Path. Properties not set are taken from the RedactConfig.
+type RouteRedactConfig struct {
+
+	// Path is the pattern the path of the url must match, with the syntax of
+	// path.Match (for example, /go-server/v1/users/*). The first route
+	// matching is used.
+	Path       string   `json:"path"`
+
+	// Headers overrides RedactConfig.Headers.
+	Headers    []string `json:"headers"`
+
+	// BodyFields overrides RedactConfig.BodyFields.
+	BodyFields []string `json:"body_fields"`
+
+	// FormFields overrides RedactConfig.FormFields.
+	FormFields []string `json:"form_fields"`
+
+	// Patterns overrides RedactConfig.Patterns.
+	Patterns   []string `json:"patterns"`
+
+	// Mask overrides RedactConfig.Mask.
+	Mask       *string  `json:"mask"`
+}
+
+// redactor contains the resolved redaction rules of a route (or the default
+// ones).
+type redactor struct {
+
+	// headers is the set of canonical names of the headers redacted.
+	headers    map[string]struct{}
+
+	// bodyKeys is the set of lowercase JSON property names redacted at any
+	// depth.
+	bodyKeys   map[string]struct{}
+
+	// bodyPaths is the set of lowercase JSON paths redacted, without "$.".
+	bodyPaths  map[string]struct{}
+
+	// bodyKeysRe matches the properties in bodyKeys and their values, used
+	// with JSON bodies that are malformed (see redactPartialJSON).
+	bodyKeysRe *regexp.Regexp
+
+	// formFields is the set of lowercase form fields redacted.
+	formFields map[string]struct{}
+
+	// patterns are matched against the bodies.
+	patterns   []maskPattern
+
+	// mask replaces every value redacted.
+	mask       string
+}
+
+// routeRedactor is a redactor used for the urls matching a path pattern.
+type routeRedactor struct {
+	path     string
+	redactor *redactor
+}
+
+// newRedactors resolves the redaction configuration into the default
+// redactor and the ones of every route. Invalid patterns are ignored, as they
+// are reported by the configuration validation (see ValidatePattern).
+func newRedactors(c *RedactConfig) (*redactor, []routeRedactor) {
+	if c == nil {
+		c = &RedactConfig{}
+	}
+	def := newRedactor(
+		orDefault(c.Headers, defaultRedactedHeaders),
+		orDefault(c.BodyFields, defaultRedactedFields),
+		orDefault(c.FormFields, defaultRedactedFields),
+		c.Patterns,
+		c.Mask,
+	)
+	routes := make([]routeRedactor, 0, len(c.Routes))
+	for _, rc := range c.Routes {
+		mask := c.Mask
+		if rc.Mask != nil {
+			mask = rc.Mask
+		}
+		rd := newRedactor(
+			orDefault(rc.Headers, orDefault(c.Headers, defaultRedactedHeaders)),
+			orDefault(rc.BodyFields, orDefault(c.BodyFields, defaultRedactedFields)),
+			orDefault(rc.FormFields, orDefault(c.FormFields, defaultRedactedFields)),
+			orDefault(rc.Patterns, c.Patterns),
+			mask,
+		)
+		routes = append(routes, routeRedactor{path: rc.Path, redactor: rd})
+	}
+	return def, routes
+}
+
+// newRedactor returns a redactor with the given rules.
+func newRedactor(headers []string, bodyFields []string, formFields []string, patterns []string, mask *string) *redactor {
+	rd := &redactor{
+		headers:    make(map[string]struct{}),
+		bodyKeys:   make(map[string]struct{}),
+		bodyPaths:  make(map[string]struct{}),
+		formFields: make(map[string]struct{}),
+		mask:       defaultMask,
+	}
+	for _, h := range headers {
+		rd.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	for _, f := range bodyFields {
+		f = strings.ToLower(f)
+		if p, ok := strings.CutPrefix(f, "$."); ok {
+			rd.bodyPaths[strings.ReplaceAll(p, "[*]", "")] = struct{}{}
+		} else {
+			rd.bodyKeys[f] = struct{}{}
+		}
+	}
+	if len(rd.bodyKeys) > 0 {
+		keys := make([]string, 0, len(rd.bodyKeys))
+		for k := range rd.bodyKeys {
+			keys = append(keys, regexp.QuoteMeta(k))
+		}
+		// A string value may be cut by the end of the body.
+		rd.bodyKeysRe = regexp.MustCompile(`(?i)("(?:` + strings.Join(keys, "|") + `)"\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,}\]\s]+)`)
+	}
+	for _, f := range formFields {
+		rd.formFields[strings.ToLower(f)] = struct{}{}
+	}
+	for _, p := range patterns {
+		if mp, err := compilePattern(p); err == nil {
+			rd.patterns = append(rd.patterns, mp)
+		}
+	}
+	if mask != nil {
+		rd.mask = *mask
+	}
+	return rd
+}
+
+// orDefault returns values if set (even if empty), or def otherwise.
+func orDefault(values []string, def []string) []string {
+	if values == nil {
+		return def
+	}
+	return values
+}
+
+// compilePattern returns the predefined pattern with the given name or,
+// if there's none, the pattern compiled from the regular expression.
+func compilePattern(p string) (maskPattern, error) {
+	if mp, ok := maskPatterns[p]; ok {
+		return mp, nil
+	}
+	re, err := regexp.Compile(p)
+	if err != nil {
+		return maskPattern{}, err
+	}
+	return maskPattern{re: re}, nil
+}
+
+// ValidatePattern returns an error if p is neither the name of a predefined
+// pattern nor a valid regular expression.
+func ValidatePattern(p string) error {
+	_, err := compilePattern(p)
+	return err
+}
+
+// redactorFor returns the redactor of the first route matching the given url
+// path, or the default one.
+func (s *loggerSettings) redactorFor(urlPath string) *redactor {
+	for _, rr := range s.routeRedactors {
+		if ok, _ := path.Match(rr.path, urlPath); ok {
+			return rr.redactor
+		}
+	}
+	return s.redactor
+}
+
+// redactHeaders returns the headers with the values of the redacted ones
+// replaced by the mask. The given headers are not modified.
+func (rd *redactor) redactHeaders(h http.Header) http.Header {
+	var redacted http.Header
+	for name, values := range h {
+		if _, ok := rd.headers[http.CanonicalHeaderKey(name)]; !ok {
+			continue
+		}
+		if redacted == nil {
+			redacted = h.Clone()
+		}
+		masked := make([]string, len(values))
+		for i := range masked {
+			masked[i] = rd.mask
+		}
+		redacted[name] = masked
+	}
+	if redacted == nil {
+		return h
+	}
+	return redacted
+}
+
+// redactBody returns the body with the redacted JSON properties or form fields
+// (according to the given content type) and the matches of the patterns
+// replaced by the mask.
+func (rd *redactor) redactBody(body string, contentType string) string {
+	if body == "" {
+		return body
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		body = rd.redactForm(body)
+	case strings.HasSuffix(mediaType, "json") || (mediaType == "" && strings.ContainsAny(body[:1], "{[")):
+		body = rd.redactJSON(body)
+	}
+	for _, mp := range rd.patterns {
+		body = mp.re.ReplaceAllStringFunc(body, func(s string) string {
+			if mp.valid != nil && !mp.valid(s) {
+				return s
+			}
+			return rd.mask
+		})
+	}
+	return body
+}
+
+// redactForm returns the url encoded form with the values of the redacted
+// fields replaced by the mask. The order of the fields is kept.
+func (rd *redactor) redactForm(body string) string {
+	if len(rd.formFields) == 0 {
+		return body
+	}
+	pairs := strings.Split(body, "&")
+	for i, pair := range pairs {
+		key, _, _ := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if _, ok := rd.formFields[strings.ToLower(name)]; ok {
+			pairs[i] = key + "=" + rd.mask
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// redactJSON returns the JSON body with the values of the redacted properties
+// replaced by the mask. If nothing is redacted, it's returned as is. If it
+// can't be parsed, it's redacted with redactPartialJSON.
+func (rd *redactor) redactJSON(body string) string {
+	if len(rd.bodyKeys) == 0 && len(rd.bodyPaths) == 0 {
+		return body
+	}
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return rd.redactPartialJSON(body)
+	}
+	v, changed := rd.redactValue(v, "")
+	if !changed {
+		return body
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return body
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// redactPartialJSON returns the JSON body that can't be parsed with the
+// values of the redacted properties replaced by the mask. Bodies truncated by
+// the capture are scanned up to their end, so that properties are redacted by
+// name and by path, and a value cut by the end of the body is masked as well.
+//
+// Malformed bodies can't be scanned: the properties redacted by name are
+// found with bodyKeysRe and, if there are paths to redact, the whole body is
+// masked, as they can't be followed.
+func (rd *redactor) redactPartialJSON(body string) string {
+	sc := &jsonScanner{rd: rd, s: body}
+	sc.value("")
+	if sc.malformed {
+		if len(rd.bodyPaths) > 0 {
+			return rd.mask
+		}
+		return rd.redactJSONKeys(body)
+	}
+	if len(sc.spans) == 0 {
+		return body
+	}
+	mask, _ := json.Marshal(rd.mask)
+	var sb strings.Builder
+	last := 0
+	for _, sp := range sc.spans {
+		sb.WriteString(body[last:sp[0]])
+		sb.Write(mask)
+		last = sp[1]
+	}
+	sb.WriteString(body[last:])
+	return sb.String()
+}
+
+// jsonScanner walks a JSON text which may end at any point, finding the
+// values of the properties redacted by a redactor.
+type jsonScanner struct {
+	rd        *redactor
+
+	// s is the text and i the position of the next character to read.
+	s         string
+	i         int
+
+	// spans are the start and end positions of the values redacted, in
+	// order. An end of len(s) means the value was cut.
+	spans     [][2]int
+
+	// skipping is greater than 0 while a redacted value is walked, so that
+	// the values inside it are not redacted again.
+	skipping  int
+
+	// malformed reports whether the text is not the beginning of a JSON
+	// value.
+	malformed bool
+}
+
+// done reports whether the scan is over, because the text ended or is
+// malformed.
+func (sc *jsonScanner) done() bool {
+	return sc.malformed || sc.i >= len(sc.s)
+}
+
+// space skips the whitespace at the current position.
+func (sc *jsonScanner) space() {
+	for sc.i < len(sc.s) && strings.IndexByte(" \t\r\n", sc.s[sc.i]) >= 0 {
+		sc.i++
+	}
+}
+
+// value walks the value at the current position, found at the given path
+// (lowercase, without "$.").
+func (sc *jsonScanner) value(p string) {
+	sc.space()
+	if sc.done() {
+		return
+	}
+	switch sc.s[sc.i] {
+	case '{':
+		sc.i++
+		for {
+			sc.space()
+			if sc.done() {
+				return
+			}
+			switch sc.s[sc.i] {
+			case '}':
+				sc.i++
+				return
+			case ',':
+				sc.i++
+				continue
+			case '"':
+			default:
+				sc.malformed = true
+				return
+			}
+			k, ok := sc.str()
+			sc.space()
+			if !ok || sc.done() {
+				return
+			}
+			if sc.s[sc.i] != ':' {
+				sc.malformed = true
+				return
+			}
+			sc.i++
+			childPath := strings.ToLower(k)
+			if p != "" {
+				childPath = p + "." + childPath
+			}
+			sc.property(childPath, k)
+		}
+	case '[':
+		sc.i++
+		for {
+			sc.space()
+			if sc.done() {
+				return
+			}
+			switch sc.s[sc.i] {
+			case ']':
+				sc.i++
+				return
+			case ',':
+				sc.i++
+				continue
+			}
+			sc.value(p)
+		}
+	case '"':
+		sc.str()
+	default:
+		start := sc.i
+		for sc.i < len(sc.s) && strings.IndexByte(",}] \t\r\n", sc.s[sc.i]) < 0 {
+			sc.i++
+		}
+		if strings.IndexByte("-0123456789tfn", sc.s[start]) < 0 {
+			sc.malformed = true
+		}
+	}
+}
+
+// property walks the value of the property with the given path and name,
+// recording it in spans if it's redacted.
+func (sc *jsonScanner) property(p string, key string) {
+	_, byKey := sc.rd.bodyKeys[strings.ToLower(key)]
+	_, byPath := sc.rd.bodyPaths[p]
+	if sc.skipping > 0 || !(byKey || byPath) {
+		sc.value(p)
+		return
+	}
+	sc.space()
+	start := sc.i
+	sc.skipping++
+	sc.value(p)
+	sc.skipping--
+	if !sc.malformed {
+		sc.spans = append(sc.spans, [2]int{start, sc.i})
+	}
+}
+
+// str walks the string at the current position and returns its value and
+// whether it's complete.
+func (sc *jsonScanner) str() (string, bool) {
+	start := sc.i
+	sc.i++
+	for sc.i < len(sc.s) {
+		switch sc.s[sc.i] {
+		case '\\':
+			sc.i += 2
+			continue
+		case '"':
+			sc.i++
+			var v string
+			if err := json.Unmarshal([]byte(sc.s[start:sc.i]), &v); err != nil {
+				return sc.s[start+1 : sc.i-1], true
+			}
+			return v, true
+		}
+		sc.i++
+	}
+	sc.i = len(sc.s)
+	return "", false
+}
+
+// redactJSONKeys returns the JSON body with the values of the properties
+// redacted by name replaced by the mask, without parsing it. Meant for bodies
+// that can't be scanned because they are malformed.
+func (rd *redactor) redactJSONKeys(body string) string {
+	if rd.bodyKeysRe == nil {
+		return body
+	}
+	mask, _ := json.Marshal(rd.mask)
+	return rd.bodyKeysRe.ReplaceAllStringFunc(body, func(m string) string {
+		return rd.bodyKeysRe.FindStringSubmatch(m)[1] + string(mask)
+	})
+}
+
+// redactValue redacts the properties of a decoded JSON value found at the
+// given path (lowercase, without "$."). Returns the value and whether
+// something was redacted.
+func (rd *redactor) redactValue(v interface{}, p string) (interface{}, bool) {
+	changed := false
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, child := range x {
+			childPath := strings.ToLower(k)
+			if p != "" {
+				childPath = p + "." + childPath
+			}
+			_, byKey := rd.bodyKeys[strings.ToLower(k)]
+			_, byPath := rd.bodyPaths[childPath]
+			if byKey || byPath {
+				x[k] = rd.mask
+				changed = true
+				continue
+			}
+			var c bool
+			x[k], c = rd.redactValue(child, childPath)
+			changed = changed || c
+		}
+	case []interface{}:
+		for i, child := range x {
+			var c bool
+			x[i], c = rd.redactValue(child, p)
+			changed = changed || c
+		}
+	}
+	return v, changed
+}
+
+// luhn reports whether the digits of s pass the Luhn checksum, used by card
+// numbers. Spaces and dashes are ignored.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
@@ -0,0 +1,135 @@
+package gslog
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// testRedactor returns the default redactor of the given configuration.
+func testRedactor(c *RedactConfig) *redactor {
+	rd, _ := newRedactors(c)
+	return rd
+}
+
+func TestRedactHeaders(t *testing.T) {
+	rd := testRedactor(nil)
+	h := http.Header{"Authorization": {"Bearer abc"}, "Accept": {"application/json"}}
+
+	got := rd.redactHeaders(h)
+	if got.Get("Authorization") != defaultMask || got.Get("Accept") != "application/json" {
+		t.Errorf("headers = %v, want only Authorization redacted", got)
+	}
+	if h.Get("Authorization") != "Bearer abc" {
+		t.Error("the given headers were modified")
+	}
+}
+
+func TestRedactJSONBody(t *testing.T) {
+	rd := testRedactor(&RedactConfig{BodyFields: []string{"password", "$.card.number", "$.items[*].secret"}})
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{`{"user":"ana","password":"123"}`, `{"password":"****","user":"ana"}`},
+		{`{"nested":{"PASSWORD":1}}`, `{"nested":{"PASSWORD":"****"}}`},
+		{`{"card":{"number":"4111","cvv":"1"},"number":"2"}`, `{"card":{"cvv":"1","number":"****"},"number":"2"}`},
+		{`{"items":[{"secret":"a"},{"secret":"b","id":1}]}`, `{"items":[{"secret":"****"},{"id":1,"secret":"****"}]}`},
+		{`{"nothing":"here"}`, `{"nothing":"here"}`},
+	}
+	for _, tt := range tests {
+		if got := rd.redactBody(tt.body, "application/json"); got != tt.want {
+			t.Errorf("redactBody(%s) = %s, want %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRedactTruncatedJSONBody(t *testing.T) {
+	rd := testRedactor(&RedactConfig{BodyFields: []string{"password", "$.card.number"}})
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		// Complete values before the end of the body.
+		{`{"card":{"number":"4111111111111111","name":"ANA"},"password":"123","x`,
+			`{"card":{"number":"****","name":"ANA"},"password":"****","x`},
+		// Values cut by the end of the body.
+		{`{"card":{"number":"41111`, `{"card":{"number":"****"`},
+		{`{"password":12`, `{"password":"****"`},
+		{`{"card":{"number":{"a":[1,`, `{"card":{"number":"****"`},
+		// Paths are followed through arrays, but not matched by name.
+		{`[{"card":{"number":"4111"}},{"number":"1","card":{"number":"4`,
+			`[{"card":{"number":"****"}},{"number":"1","card":{"number":"****"`},
+		// Strings containing quotes and brackets.
+		{`{"note":"a \"}{\" b","password":"x\"y","card":{"num`,
+			`{"note":"a \"}{\" b","password":"****","card":{"num`},
+	}
+	for _, tt := range tests {
+		if got := rd.redactBody(tt.body, "application/json"); got != tt.want {
+			t.Errorf("redactBody(%s)\n got %s\nwant %s", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestRedactMalformedJSONBody(t *testing.T) {
+	byName := testRedactor(&RedactConfig{BodyFields: []string{"password"}})
+	if got := byName.redactBody(`{"password":"1" "x": }`, "application/json"); strings.Contains(got, `"1"`) {
+		t.Errorf("redactBody = %s, want password redacted", got)
+	}
+
+	byPath := testRedactor(&RedactConfig{BodyFields: []string{"$.card.number"}})
+	if got := byPath.redactBody(`{"card":{"number":"4111"} "x": }`, "application/json"); got != defaultMask {
+		t.Errorf("redactBody = %s, want the whole body masked", got)
+	}
+}
+
+func TestRedactFormBody(t *testing.T) {
+	rd := testRedactor(nil)
+	got := rd.redactBody("client_id=a&client_secret=b&scope=c", "application/x-www-form-urlencoded")
+	if got != "client_id=a&client_secret=****&scope=c" {
+		t.Errorf("redactBody = %s", got)
+	}
+}
+
+func TestRedactPatterns(t *testing.T) {
+	mask := "#"
+	rd := testRedactor(&RedactConfig{BodyFields: []string{}, Patterns: []string{"CARD_NUMBER", `\d{3}-\d{4}`}, Mask: &mask})
+
+	got := rd.redactBody("card 4111 1111 1111 1111, not 1234 5678 9012 3456, phone 555-1234", "text/plain")
+	if got != "card #, not 1234 5678 9012 3456, phone #" {
+		t.Errorf("redactBody = %s, want only the valid card number and the phone redacted", got)
+	}
+}
+
+func TestRedactorForRoute(t *testing.T) {
+	s := &loggerSettings{}
+	s.redactor, s.routeRedactors = newRedactors(&RedactConfig{
+		Routes: []RouteRedactConfig{{Path: "/users/*", BodyFields: []string{"email"}}},
+	})
+
+	users := s.redactorFor("/users/7").redactBody(`{"email":"a@b.com","password":"x"}`, "application/json")
+	if users != `{"email":"****","password":"x"}` {
+		t.Errorf("route body = %s, want only email redacted", users)
+	}
+	other := s.redactorFor("/other").redactBody(`{"email":"a@b.com","password":"x"}`, "application/json")
+	if other != `{"email":"a@b.com","password":"****"}` {
+		t.Errorf("default body = %s, want only password redacted", other)
+	}
+}
+
+func TestFormatTruncatedBodyRedactsPaths(t *testing.T) {
+	rd := testRedactor(&RedactConfig{BodyFields: []string{"$.card.number"}})
+	body := `{"card":{"number":"4111111111111111"},"items":[` + strings.Repeat(`{"id":1},`, 100)
+	raw := []byte(body)
+
+	lb := formatBody(raw, int64(len(raw))+100, "application/json", rd, 50)
+	s, ok := lb.value.(string)
+	if !ok || !lb.truncated {
+		t.Fatalf("body = %#v, want a truncated string", lb)
+	}
+	if strings.Contains(s, "4111") || !strings.Contains(s, `"number":"****"`) {
+		t.Errorf("body = %s, want the card number redacted", s)
+	}
+}
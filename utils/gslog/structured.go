@@ -0,0 +1,104 @@
+package gslog
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"time"
+)
+
+// Key type to use when setting the fields of a Logger in a context.
+type ctxKeyLogger int
+
+// loggerKey is the key that holds the Handler of a Logger in a context. See
+// NewContext.
+const loggerKey ctxKeyLogger = 0
+
+// Logger writes log lines with fields, which can be queried instead of being
+// formatted into the message. The trace ID and span ID are taken from the
+// context the logger was obtained from, so they don't need to be passed:
+//
+//	gslog.FromContext(ctx).With("user_id", id).Info("User created")
+//
+// Fields are given as key-value pairs or slog.Attr values (slog.Int,
+// slog.Duration, slog.Group, etc.), as in the slog package.
+type Logger struct {
+
+	// ctx is the context the trace ID and span ID are taken from.
+	ctx     context.Context
+
+	// handler writes the lines, holding the fields added with With.
+	handler *Handler
+}
+
+// FromContext returns a Logger writing the trace ID and span ID held by ctx,
+// and the fields of the logger set in it with NewContext, if any.
+func FromContext(ctx context.Context) *Logger {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	h, ok := ctx.Value(loggerKey).(*Handler)
+	if !ok {
+		h = NewHandler()
+	}
+	return &Logger{ctx: ctx, handler: h}
+}
+
+// NewContext returns a copy of ctx holding the fields of the logger, so that
+// the loggers obtained from it (or from contexts derived from it) with
+// FromContext write them as well.
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l.handler)
+}
+
+// With returns a copy of the logger writing the given fields in every line.
+func (l *Logger) With(args ...interface{}) *Logger {
+	return &Logger{ctx: l.ctx, handler: l.handler.WithAttrs(argsToAttrs(args)).(*Handler)}
+}
+
+// Debug writes a line with the given message and fields and level DEBUG.
+func (l *Logger) Debug(m string, args ...interface{}) {
+	l.log(DEBUG, m, args)
+}
+
+// Info writes a line with the given message and fields and level INFO.
+func (l *Logger) Info(m string, args ...interface{}) {
+	l.log(INFO, m, args)
+}
+
+// Warn writes a line with the given message and fields and level WARN.
+func (l *Logger) Warn(m string, args ...interface{}) {
+	l.log(WARN, m, args)
+}
+
+// Error writes a line with the given message and fields and level ERROR.
+func (l *Logger) Error(m string, args ...interface{}) {
+	l.log(ERROR, m, args)
+}
+
+// log writes a line if the level is enabled. Must be called directly by the
+// exported methods, so that the code line of their caller is logged.
+func (l *Logger) log(level LogLevel, m string, args []interface{}) {
+	if current().minLogLevel > level {
+		return
+	}
+	// Skip runtime.Callers, this function and the exported method.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), toSlogLevel(level), m, pcs[0])
+	r.Add(args...)
+	l.handler.Handle(l.ctx, r)
+}
+
+// argsToAttrs converts key-value pairs and slog.Attr values into attributes,
+// the same way slog does.
+func argsToAttrs(args []interface{}) []slog.Attr {
+	var r slog.Record
+	r.Add(args...)
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return attrs
+}
@@ -0,0 +1,53 @@
+package gsmiddleware
+
+import (
+	"goserver/utils/gslog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AccessLogHandler writes one line per request to the access log (see
+// gslog.Access), with its route pattern, status, bytes written and duration.
+//
+// It must be placed after TraceID, so that the trace ID is logged, and before
+// Recoverer, so that requests ending in a panic are logged with their 500
+// status.
+func AccessLogHandler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+
+		start := time.Now()
+		ww := NewResponseWriterWrapper(w, false)
+
+		next.ServeHTTP(ww, r)
+
+		// The route pattern is only known once the request was routed.
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		remoteIP, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			remoteIP = r.RemoteAddr
+		}
+
+		gslog.Access(gslog.AccessEntry{
+			Time:      start,
+			Method:    r.Method,
+			Route:     route,
+			Path:      r.URL.Path,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			Status:    ww.StatusCode(),
+			Bytes:     ww.BytesWritten(),
+			Duration:  time.Since(start),
+			RemoteIP:  remoteIP,
+			UserAgent: r.UserAgent(),
+			Referer:   r.Referer(),
+			TraceID:   GetTraceID(r.Context()),
+		})
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,84 @@
+package gsmiddleware
+
+import (
+	"encoding/json"
+	"goserver/utils/gslog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// accessLogFile writes the access log with the given format to a file of the
+// test, whose path is returned.
+func accessLogFile(t *testing.T, format gslog.AccessLogFormat) string {
+	filename := filepath.Join(t.TempDir(), "access.log")
+	gslog.ConfigureLog(gslog.LoggerConfig{Access: &gslog.AccessLogConfig{Filename: &filename, Format: &format}})
+	t.Cleanup(func() { gslog.ConfigureLog(gslog.LoggerConfig{}) })
+	return filename
+}
+
+// accessRouter returns a router with the AccessLogHandler and a route
+// answering 201 with a body.
+func accessRouter() http.Handler {
+	r := chi.NewRouter()
+	r.Use(TraceID, AccessLogHandler)
+	r.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+	return r
+}
+
+func TestAccessLogHandlerLogsRoutePattern(t *testing.T) {
+	filename := accessLogFile(t, gslog.JSON_FORMAT)
+
+	r := httptest.NewRequest(http.MethodGet, "/users/42?fields=name", nil)
+	r.Header.Set("User-Agent", "test-agent")
+	r.Header.Set(TraceIDHeader, "trace-1")
+	accessRouter().ServeHTTP(httptest.NewRecorder(), r)
+	accessRouter().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("couldn't read the access log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var got map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &got)
+	want := map[string]interface{}{
+		"method": "GET", "route": "/users/{id}", "path": "/users/42", "status": 201.0, "bytes": 7.0,
+		"remote_ip": "192.0.2.1", "user_agent": "test-agent", "trace_id": "trace-1",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	var notFound map[string]interface{}
+	json.Unmarshal([]byte(lines[1]), &notFound)
+	if notFound["status"] != 404.0 || notFound["route"] != nil || notFound["path"] != "/unknown" {
+		t.Errorf("line = %v, want a 404 without route", notFound)
+	}
+}
+
+func TestAccessLogHandlerCombinedLogsRequestURI(t *testing.T) {
+	filename := accessLogFile(t, gslog.COMBINED_FORMAT)
+
+	accessRouter().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/42?fields=name", nil))
+
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("couldn't read the access log: %v", err)
+	}
+	if !strings.Contains(string(b), `"GET /users/42?fields=name HTTP/1.1" 201 7 "-" "-" "/users/{id}"`) {
+		t.Errorf("line = %s, want the request URI and the route", b)
+	}
+}
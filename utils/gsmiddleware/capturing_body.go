@@ -0,0 +1,57 @@
+package gsmiddleware
+
+import (
+	"goserver/utils/gslog"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// capturingBody wraps a request or response body, copying the bytes read to
+// a gslog.BodyCapture as they are streamed. Once the body is read until its
+// end or closed, done is called (only once), so it can be logged.
+type capturingBody struct {
+
+	// ReadCloser is the body wrapped.
+	io.ReadCloser
+
+	// capture receives every byte read.
+	capture *gslog.BodyCapture
+
+	// done is called when the body was consumed or closed.
+	done    func()
+
+	// once ensures done is called only once.
+	once    sync.Once
+}
+
+// newCapturingBody returns the body wrapped so that the bytes read are copied
+// to capture and done is called once it's consumed or closed.
+func newCapturingBody(body io.ReadCloser, capture *gslog.BodyCapture, done func()) *capturingBody {
+	return &capturingBody{ReadCloser: body, capture: capture, done: done}
+}
+
+// Read reads from the body, copying the bytes read to the capture.
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.capture.Write(p[:n])
+	}
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+// Close closes the body.
+func (b *capturingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// hasBody reports whether the given request or response body may have
+// content.
+func hasBody(body io.ReadCloser) bool {
+	return body != nil && body != http.NoBody
+}
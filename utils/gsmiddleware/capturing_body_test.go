@@ -0,0 +1,71 @@
+package gsmiddleware
+
+import (
+	"errors"
+	"goserver/utils/gslog"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// closeRecorder is a body recording whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecorder) Close() error {
+	b.closed = true
+	return errors.New("already closed")
+}
+
+func TestCapturingBodyCallsDoneOnceAtEOF(t *testing.T) {
+	capture := gslog.NewBodyCapture()
+	calls := 0
+	body := newCapturingBody(io.NopCloser(strings.NewReader("hello world")), capture, func() { calls++ })
+
+	b, err := io.ReadAll(body)
+	if err != nil || string(b) != "hello world" {
+		t.Fatalf("ReadAll = %q, %v, want the whole body", b, err)
+	}
+	if calls != 1 {
+		t.Fatalf("done called %d times at EOF, want 1", calls)
+	}
+	body.Close()
+	if calls != 1 {
+		t.Errorf("done called %d times after Close, want 1", calls)
+	}
+	if capture.Total() != 11 {
+		t.Errorf("captured %d bytes, want 11", capture.Total())
+	}
+}
+
+func TestCapturingBodyCallsDoneOnClose(t *testing.T) {
+	inner := &closeRecorder{Reader: strings.NewReader("hello world")}
+	calls := 0
+	body := newCapturingBody(inner, gslog.NewBodyCapture(), func() { calls++ })
+
+	p := make([]byte, 5)
+	if n, err := body.Read(p); n != 5 || err != nil {
+		t.Fatalf("Read = %d, %v, want 5, nil", n, err)
+	}
+	if calls != 0 {
+		t.Fatalf("done called before the body was consumed")
+	}
+	if err := body.Close(); err == nil || !inner.closed {
+		t.Errorf("Close = %v, want the error of the inner body", err)
+	}
+	if calls != 1 {
+		t.Errorf("done called %d times on Close, want 1", calls)
+	}
+}
+
+func TestHasBody(t *testing.T) {
+	if hasBody(nil) || hasBody(http.NoBody) {
+		t.Error("hasBody reported content for an empty body")
+	}
+	if !hasBody(io.NopCloser(strings.NewReader(""))) {
+		t.Error("hasBody reported no content for a body that may have it")
+	}
+}
@@ -3,31 +3,48 @@ package gsmiddleware
 import (
 	"goserver/utils/gslog"
 	"net/http"
+	"sync"
+	"time"
 )
 
 // This handler logs the request as the server receives it and the response
 // as it is returned by the server.
-// Uses a wrapper for ResponseWriter to store the response body.
+// Bodies are not buffered: they are streamed through a bounded capture (see
+// gslog.BodyCapture). So the request is logged once the handler consumed or
+// closed its body (or returned), and the response once the handler returned.
+// Uses a wrapper for ResponseWriter to capture the response body.
 func HttpLogHandler(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 
-		// Log Request.
-		gslog.Request(
-			gslog.OUTER_REQUEST,
-			r,
-			GetTraceID(r.Context()),
-		)
+		start := time.Now()
+		traceID := GetTraceID(r.Context())
+
+		// Log Request once its body is consumed.
+		reqBody := gslog.NewBodyCapture()
+		var once sync.Once
+		logRequest := func() {
+			once.Do(func() {
+				gslog.Request(gslog.OUTER_REQUEST, r, reqBody, traceID)
+			})
+		}
+		if hasBody(r.Body) {
+			r.Body = newCapturingBody(r.Body, reqBody, logRequest)
+		} else {
+			logRequest()
+		}
 
 		ww := NewResponseWriterWrapper(w, true)
 
 		// Defer Log Response.
 		defer func() {
+			logRequest()
 			gslog.ResponseWriter(
 				ww.body,
 				ww.Header(),
-				*ww.statusCode,
+				ww.StatusCode(),
 				r,
-				GetTraceID(r.Context()),
+				time.Since(start),
+				traceID,
 			)
 		}()
 
@@ -35,4 +52,4 @@ func HttpLogHandler(next http.Handler) http.Handler {
 		next.ServeHTTP(ww, r)
 	}
 	return http.HandlerFunc(fn)
-}
\ No newline at end of file
+}
@@ -0,0 +1,133 @@
+package gsmiddleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"goserver/utils/gslog"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// captureLogLines redirects the log lines written during the test to the
+// returned buffer.
+func captureLogLines(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	gslog.SetOutput(&buf)
+	t.Cleanup(func() { gslog.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// logLines parses the log lines written to buf, without their prefix.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var parsed []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		_, js, _ := strings.Cut(line, "] ")
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(js), &m); err != nil {
+			t.Fatalf("invalid line %s: %v", line, err)
+		}
+		parsed = append(parsed, m)
+	}
+	return parsed
+}
+
+// types returns the type (or message) of every log line.
+func types(parsed []map[string]interface{}) []string {
+	var types []string
+	for _, l := range parsed {
+		if l["type"] == "MESSAGE" {
+			types = append(types, l["message"].(string))
+		} else {
+			types = append(types, l["type"].(string))
+		}
+	}
+	return types
+}
+
+func TestHttpLogHandlerLogsRequestOnceBodyIsRead(t *testing.T) {
+	buf := captureLogLines(t)
+	handler := HttpLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gslog.Info("before reading", "")
+		io.ReadAll(r.Body)
+		gslog.Info("after reading", "")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 1}`))
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "ana"}`))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	got := logLines(t, buf)
+	want := []string{"before reading", "OUTER_REQUEST", "after reading", "OUTER_RESPONSE"}
+	if strings.Join(types(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("lines = %v, want %v", types(got), want)
+	}
+	if body, _ := json.Marshal(got[1]["body"]); string(body) != `{"name":"ana"}` || got[1]["body_size"] != 15.0 {
+		t.Errorf("request body = %s (%v bytes), want the JSON object", body, got[1]["body_size"])
+	}
+	if body, _ := json.Marshal(got[3]["body"]); string(body) != `{"id":1}` || got[3]["status"] != 201.0 {
+		t.Errorf("response = %v %s, want 201 and the JSON object", got[3]["status"], body)
+	}
+}
+
+func TestHttpLogHandlerLogsRequestOnClose(t *testing.T) {
+	buf := captureLogLines(t)
+	handler := HttpLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body.Read(make([]byte, 4))
+		r.Body.Close()
+		gslog.Info("after closing", "")
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("0123456789"))
+	r.Header.Set("Content-Type", "text/plain")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	got := logLines(t, buf)
+	want := []string{"OUTER_REQUEST", "after closing", "OUTER_RESPONSE"}
+	if strings.Join(types(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("lines = %v, want %v", types(got), want)
+	}
+	if got[0]["body"] != "0123" || got[0]["body_size"] != 4.0 {
+		t.Errorf("request body = %v (%v bytes), want the part read", got[0]["body"], got[0]["body_size"])
+	}
+}
+
+func TestHttpLogHandlerLogsUnreadRequestWhenHandlerReturns(t *testing.T) {
+	buf := captureLogLines(t)
+	handler := HttpLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gslog.Info("not reading", "")
+	}))
+
+	r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader("ignored"))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	got := logLines(t, buf)
+	want := []string{"not reading", "OUTER_REQUEST", "OUTER_RESPONSE"}
+	if strings.Join(types(got), ",") != strings.Join(want, ",") {
+		t.Errorf("lines = %v, want %v", types(got), want)
+	}
+}
+
+func TestHttpLogHandlerLogsRequestWithoutBodyFirst(t *testing.T) {
+	buf := captureLogLines(t)
+	handler := HttpLogHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gslog.Info("handling", "")
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	want := []string{"OUTER_REQUEST", "handling", "OUTER_RESPONSE"}
+	if got := types(logLines(t, buf)); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("lines = %v, want %v", got, want)
+	}
+}
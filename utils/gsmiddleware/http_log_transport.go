@@ -3,35 +3,63 @@ package gsmiddleware
 import (
 	"goserver/utils/gslog"
 	"net/http"
+	"sync"
+	"time"
 )
 
-// HttpLogTransport wraps an http.Transport adding the logging of request and
+// HttpLogTransport wraps an http.RoundTripper adding the logging of request and
 // response. For this, uses mblog (not an implementation of log.Logger).
+//
+// Bodies are not buffered: they are streamed through a bounded capture (see
+// gslog.BodyCapture). So the request is logged once it was sent, and the
+// response once its body was read until the end or closed by the caller.
 type HttpLogTransport struct {
-	Base http.Transport
+	Base http.RoundTripper
 }
 
 // Implements interface http.RoundTripper so it can be used as a Transport.
 func (lt *HttpLogTransport) RoundTrip(r *http.Request) (*http.Response, error) {
-	
-	gslog.Request(
-		gslog.INNER_REQUEST, 
-		r, 
-		GetTraceID(r.Context()),
-	)
+
+	start := time.Now()
+	traceID := GetTraceID(r.Context())
+
+	// Log Request once its body is sent. The given request must not be
+	// modified, so a copy with the body wrapped is sent.
+	reqBody := gslog.NewBodyCapture()
+	var reqOnce sync.Once
+	logRequest := func() {
+		reqOnce.Do(func() {
+			gslog.Request(gslog.INNER_REQUEST, r, reqBody, traceID)
+		})
+	}
+	if hasBody(r.Body) {
+		sent := r.WithContext(r.Context())
+		sent.Body = newCapturingBody(r.Body, reqBody, logRequest)
+		r = sent
+	}
 
 	// Send the request, get the response (or the error).
 	rs, err := lt.Base.RoundTrip(r)
+	logRequest()
 
 	// Handle the result.
 	if (err != nil) {
 		return nil, err
 	}
 
-	gslog.Response(
-		rs,
-		GetTraceID(r.Context()),
-	)
+	// Log Response once its body is consumed.
+	rsBody := gslog.NewBodyCapture()
+	var rsOnce sync.Once
+	logResponse := func() {
+		rsOnce.Do(func() {
+			gslog.Response(rs, rsBody, time.Since(start), traceID)
+		})
+	}
+	if hasBody(rs.Body) {
+		rs.Body = newCapturingBody(rs.Body, rsBody, logResponse)
+	} else {
+		logResponse()
+	}
 
 	return rs, nil 
-}
\ No newline at end of file
+}
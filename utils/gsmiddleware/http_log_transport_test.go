@@ -0,0 +1,91 @@
+package gsmiddleware
+
+import (
+	"goserver/utils/gslog"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// logTransport returns an HttpLogTransport whose base reads the whole request
+// body and responds with the given body.
+func logTransport(responseBody string) *HttpLogTransport {
+	return &HttpLogTransport{Base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.Body != nil {
+			io.ReadAll(r.Body)
+			r.Body.Close()
+		}
+		gslog.Info("sent", "")
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       io.NopCloser(strings.NewReader(responseBody)),
+			Request:    r,
+		}, nil
+	})}
+}
+
+func TestHttpLogTransportLogsResponseOnceBodyIsRead(t *testing.T) {
+	buf := captureLogLines(t)
+	r, _ := http.NewRequest(http.MethodPost, "http://localhost/users", strings.NewReader("request"))
+	r.Header.Set("Content-Type", "text/plain")
+
+	rs, err := logTransport("response").RoundTrip(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gslog.Info("received", "")
+	b, _ := io.ReadAll(rs.Body)
+	gslog.Info("read", "")
+	rs.Body.Close()
+
+	if string(b) != "response" {
+		t.Errorf("body = %q, want the one of the base", b)
+	}
+	got := logLines(t, buf)
+	want := []string{"INNER_REQUEST", "sent", "received", "INNER_RESPONSE", "read"}
+	if strings.Join(types(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("lines = %v, want %v", types(got), want)
+	}
+	if got[0]["body"] != "request" || got[3]["body"] != "response" || got[3]["body_size"] != 8.0 {
+		t.Errorf("bodies = %v, %v, want the ones sent and received", got[0]["body"], got[3]["body"])
+	}
+}
+
+func TestHttpLogTransportLogsResponseOnClose(t *testing.T) {
+	buf := captureLogLines(t)
+	r, _ := http.NewRequest(http.MethodGet, "http://localhost/users", nil)
+
+	rs, err := logTransport("a long response").RoundTrip(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rs.Body.Read(make([]byte, 6))
+	gslog.Info("partially read", "")
+	rs.Body.Close()
+
+	got := logLines(t, buf)
+	want := []string{"sent", "INNER_REQUEST", "partially read", "INNER_RESPONSE"}
+	if strings.Join(types(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("lines = %v, want %v", types(got), want)
+	}
+	if got[3]["body"] != "a long" {
+		t.Errorf("response body = %v, want the part read", got[3]["body"])
+	}
+}
+
+func TestHttpLogTransportDoesNotModifyRequest(t *testing.T) {
+	captureLogLines(t)
+	body := io.NopCloser(strings.NewReader("request"))
+	r, _ := http.NewRequest(http.MethodPost, "http://localhost/users", body)
+
+	rs, err := logTransport("").RoundTrip(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rs.Body.Close()
+	if r.Body != body {
+		t.Error("the body of the given request was replaced")
+	}
+}
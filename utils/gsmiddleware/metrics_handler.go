@@ -25,6 +25,13 @@ var (
 		},
 		[]string{"path"},
 	)
+	circuitBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_circuit_breaker_state",
+			Help: "State of the circuit breaker of each client (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"client"},
+	)
 )
 
 func MetricsHandler(next http.Handler) http.Handler {
@@ -42,8 +49,8 @@ func MetricsHandler(next http.Handler) http.Handler {
 			pathTemplate := ctx.RoutePattern()
 			if pathTemplate != "" {
 				// Get response status code and increment metric.
-				code := ww.statusCode
-				totalRequests.WithLabelValues(pathTemplate, strconv.Itoa(*code)).Inc()
+				code := ww.StatusCode()
+				totalRequests.WithLabelValues(pathTemplate, strconv.Itoa(code)).Inc()
 				responseTime.WithLabelValues(pathTemplate).Observe(float64(time.Since(start).Seconds()))
 			}
 		}
@@ -51,7 +58,14 @@ func MetricsHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// SetCircuitBreakerState updates the gauge holding the circuit breaker state
+// of the given client.
+func SetCircuitBreakerState(client string, state int) {
+	circuitBreakerState.WithLabelValues(client).Set(float64(state))
+}
+
 func init() {
 	prometheus.Register(totalRequests)
 	prometheus.Register(responseTime)
+	prometheus.Register(circuitBreakerState)
 }
\ No newline at end of file
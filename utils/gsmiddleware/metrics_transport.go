@@ -0,0 +1,151 @@
+package gsmiddleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Key type to use when setting the outbound call information.
+type ctxKeyOutbound int
+
+const (
+	// routeTemplateKey is the key that holds the route template of an
+	// outbound request in its context.
+	routeTemplateKey ctxKeyOutbound = iota
+
+	// callKindKey is the key that holds the CallKind of an outbound request
+	// in its context.
+	callKindKey
+)
+
+// unknownRoute is the route label used for requests whose context has no route
+// template. The actual path is not used to keep the metric cardinality bounded.
+const unknownRoute = "unknown"
+
+// CallKind distinguishes the purpose of an outbound request in metrics.
+type CallKind string
+
+const (
+	BUSINESS_CALL      CallKind = "business"
+	TOKEN_RENEWAL_CALL CallKind = "token_renewal"
+	HEALTH_CHECK_CALL  CallKind = "health_check"
+)
+
+var (
+	clientRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "client_requests_total",
+			Help: "Number of requests made to external APIs, by client and status class",
+		},
+		[]string{"client", "kind", "method", "host", "route", "status"},
+	)
+	clientResponseTime = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "client_response_time_seconds",
+			Help: "Duration of HTTP requests made to external APIs",
+		},
+		[]string{"client", "kind", "method", "host", "route"},
+	)
+	clientInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "client_requests_in_flight",
+			Help: "Number of requests made to external APIs waiting for a response",
+		},
+		[]string{"client", "kind"},
+	)
+)
+
+// MetricsTransport wraps an http.RoundTripper recording prometheus metrics of
+// every request sent through it.
+type MetricsTransport struct {
+
+	// Base defines the implementation of http.RoundTripper wrapped by this
+	// Transport.
+	Base      http.RoundTripper
+
+	// ClientKey identifies the client in every metric recorded.
+	ClientKey string
+}
+
+// Implements interface http.RoundTripper so it can be used as a Transport.
+// The route label is taken from the request context (see WithRouteTemplate)
+// and the status is reported by class (2xx, 4xx, etc.), or as "error" if no
+// response was received.
+func (mt *MetricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+
+	kind := string(GetCallKind(r.Context()))
+	route := GetRouteTemplate(r.Context())
+	if route == "" {
+		route = unknownRoute
+	}
+
+	inFlight := clientInFlight.WithLabelValues(mt.ClientKey, kind)
+	inFlight.Inc()
+	defer inFlight.Dec()
+
+	start := time.Now()
+	rs, err := mt.Base.RoundTrip(r)
+
+	status := "error"
+	if err == nil {
+		status = statusClass(rs.StatusCode)
+	}
+	clientRequests.WithLabelValues(mt.ClientKey, kind, r.Method, r.URL.Host, route, status).Inc()
+	clientResponseTime.WithLabelValues(mt.ClientKey, kind, r.Method, r.URL.Host, route).Observe(time.Since(start).Seconds())
+
+	return rs, err
+}
+
+// WithRouteTemplate returns a copy of ctx holding the route template (for
+// example "/users/{id}") of an outbound request, used to label its metrics.
+func WithRouteTemplate(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeTemplateKey, route)
+}
+
+// GetRouteTemplate returns the route template set in the given context, or the
+// empty string if there's none.
+func GetRouteTemplate(ctx context.Context) string {
+	if route, ok := ctx.Value(routeTemplateKey).(string); ok {
+		return route
+	}
+	return ""
+}
+
+// WithCallKind returns a copy of ctx holding the kind of outbound request to
+// be made with it.
+func WithCallKind(ctx context.Context, kind CallKind) context.Context {
+	return context.WithValue(ctx, callKindKey, kind)
+}
+
+// GetCallKind returns the CallKind set in the given context. If none is set,
+// BUSINESS_CALL is returned.
+func GetCallKind(ctx context.Context) CallKind {
+	if kind, ok := ctx.Value(callKindKey).(CallKind); ok {
+		return kind
+	}
+	return BUSINESS_CALL
+}
+
+// statusClass returns the class of an http status code (2xx, 3xx, etc.).
+func statusClass(code int) string {
+	switch {
+	case code >= 500:
+		return "5xx"
+	case code >= 400:
+		return "4xx"
+	case code >= 300:
+		return "3xx"
+	case code >= 200:
+		return "2xx"
+	}
+	return "1xx"
+}
+
+func init() {
+	prometheus.Register(clientRequests)
+	prometheus.Register(clientResponseTime)
+	prometheus.Register(clientInFlight)
+}
@@ -0,0 +1,137 @@
+package gsmiddleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// clientMetrics returns a registry with the metrics of the outbound requests.
+func clientMetrics(t *testing.T) *prometheus.Registry {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	for _, c := range []prometheus.Collector{clientRequests, clientResponseTime, clientInFlight} {
+		if err := reg.Register(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return reg
+}
+
+// metric returns the metric of the given family with exactly the given
+// labels, or nil if there's none.
+func metric(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) *dto.Metric {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			if hasLabels(m, labels) {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// hasLabels reports whether the metric has exactly the given labels.
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	if len(m.GetLabel()) != len(labels) {
+		return false
+	}
+	for _, lp := range m.GetLabel() {
+		if labels[lp.GetName()] != lp.GetValue() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMetricsTransport(t *testing.T) {
+	reg := clientMetrics(t)
+
+	var inFlight float64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kind := r.URL.Query().Get("kind")
+		if m := metric(t, reg, "client_requests_in_flight", map[string]string{"client": "MetricsTest", "kind": kind}); m != nil {
+			inFlight = m.GetGauge().GetValue()
+		}
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	host, _ := url.Parse(srv.URL)
+	mt := &MetricsTransport{Base: http.DefaultTransport, ClientKey: "MetricsTest"}
+
+	tests := []struct {
+		kind   CallKind
+		route  string
+		path   string
+		want   string
+		status string
+	}{
+		{BUSINESS_CALL, "/users/{id}", "/users/1", "/users/{id}", "2xx"},
+		{TOKEN_RENEWAL_CALL, "", "/token", unknownRoute, "2xx"},
+		{HEALTH_CHECK_CALL, "/health", "/fail", "/health", "5xx"},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.kind != BUSINESS_CALL {
+			ctx = WithCallKind(ctx, tt.kind)
+		}
+		if tt.route != "" {
+			ctx = WithRouteTemplate(ctx, tt.route)
+		}
+		inFlight = 0
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+tt.path+"?kind="+string(tt.kind), nil)
+		resp, err := mt.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+
+		if inFlight != 1 {
+			t.Errorf("%s: in flight = %v during the request, want 1", tt.kind, inFlight)
+		}
+		labels := map[string]string{"client": "MetricsTest", "kind": string(tt.kind), "method": http.MethodGet, "host": host.Host, "route": tt.want}
+		if m := metric(t, reg, "client_response_time_seconds", labels); m == nil || m.GetHistogram().GetSampleCount() != 1 {
+			t.Errorf("%s: no response time observed with labels %v", tt.kind, labels)
+		}
+		labels["status"] = tt.status
+		if m := metric(t, reg, "client_requests_total", labels); m == nil || m.GetCounter().GetValue() != 1 {
+			t.Errorf("%s: no request counted with labels %v", tt.kind, labels)
+		}
+		inFlightLabels := map[string]string{"client": "MetricsTest", "kind": string(tt.kind)}
+		if m := metric(t, reg, "client_requests_in_flight", inFlightLabels); m == nil || m.GetGauge().GetValue() != 0 {
+			t.Errorf("%s: requests still in flight after the response", tt.kind)
+		}
+	}
+}
+
+func TestMetricsTransportCountsTransportErrors(t *testing.T) {
+	reg := clientMetrics(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Close()
+	host, _ := url.Parse(srv.URL)
+	mt := &MetricsTransport{Base: http.DefaultTransport, ClientKey: "MetricsErrorTest"}
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if _, err := mt.RoundTrip(req); err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+	labels := map[string]string{"client": "MetricsErrorTest", "kind": string(BUSINESS_CALL), "method": http.MethodPost, "host": host.Host, "route": unknownRoute, "status": "error"}
+	if m := metric(t, reg, "client_requests_total", labels); m == nil || m.GetCounter().GetValue() != 1 {
+		t.Errorf("no request counted with labels %v", labels)
+	}
+}
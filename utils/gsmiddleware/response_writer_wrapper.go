@@ -1,42 +1,175 @@
 package gsmiddleware
 
 import (
-	"bytes"
+	"bufio"
+	"goserver/utils/gslog"
+	"io"
+	"net"
 	"net/http"
+	"time"
 )
 
 // ResponseWriterWrapper is used to wrap an http.ResponseWriter implementation
 // an be able to read from it without modifying the actual writer.
+// The body written is not buffered: only its first bytes are captured, if
+// requested (see gslog.BodyCapture).
+//
+// The optional interfaces of the wrapped writer are preserved: the wrapper
+// implements http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom,
+// delegating to the wrapped writer (http.ErrNotSupported is returned if it
+// doesn't support them), and Unwrap, so that http.ResponseController reaches
+// it as well.
 type ResponseWriterWrapper struct {
-	w          *http.ResponseWriter
-	body       *bytes.Buffer
-	statusCode *int
-	copyBody   bool
+
+	// w is the wrapped writer.
+	w           http.ResponseWriter
+
+	// body captures the first bytes written, if copyBody is set.
+	body        *gslog.BodyCapture
+
+	// statusCode is the status of the response. 200 until a final status is
+	// written.
+	statusCode  int
+
+	// wroteHeader reports whether the final status was written, explicitly
+	// or by the first write.
+	wroteHeader bool
+
+	// bytes is the number of bytes of the body written.
+	bytes       int64
+
+	// firstByte is the time the first byte of the body was written.
+	firstByte   time.Time
+
+	// copyBody specifies whether the body written is captured.
+	copyBody    bool
 }
 
 func NewResponseWriterWrapper(w http.ResponseWriter, copyBody bool) *ResponseWriterWrapper {
-	var buf bytes.Buffer
-	var statusCode int = 200
-	return &ResponseWriterWrapper{
-		w: 			&w,
-		body: 		&buf,
-		statusCode: &statusCode,
+	rww := &ResponseWriterWrapper{
+		w:          w,
+		statusCode: http.StatusOK,
 		copyBody:   copyBody,
 	}
+	if copyBody {
+		rww.body = gslog.NewBodyCapture()
+	}
+	return rww
 }
 
 func (rww *ResponseWriterWrapper) Write(buf []byte) (int, error) {
+	rww.beforeBody(len(buf) > 0)
 	if rww.copyBody {
 		rww.body.Write(buf)
 	}
-	return (*rww.w).Write(buf)
+	n, err := rww.w.Write(buf)
+	rww.bytes += int64(n)
+	return n, err
 }
 
 func (rww *ResponseWriterWrapper) Header() http.Header {
-	return (*rww.w).Header()
+	return rww.w.Header()
 }
 
+// WriteHeader writes the status of the response. Only the first final status
+// is recorded, as the following ones are ignored by net/http. Informational
+// (1xx) statuses other than 101 may be written before it.
 func (rww *ResponseWriterWrapper) WriteHeader(statusCode int) {
-	(*rww.statusCode) = statusCode
-	(*rww.w).WriteHeader(statusCode)
-}
\ No newline at end of file
+	if !rww.wroteHeader && (statusCode >= 200 || statusCode == http.StatusSwitchingProtocols) {
+		rww.statusCode = statusCode
+		rww.wroteHeader = true
+	}
+	rww.w.WriteHeader(statusCode)
+}
+
+// beforeBody records the implicit 200 status written with the first bytes of
+// the body, and the time they are written.
+func (rww *ResponseWriterWrapper) beforeBody(writing bool) {
+	rww.wroteHeader = true
+	if writing && rww.firstByte.IsZero() {
+		rww.firstByte = time.Now()
+	}
+}
+
+// StatusCode returns the status code written to the response (200 if none was
+// written explicitly).
+func (rww *ResponseWriterWrapper) StatusCode() int {
+	return rww.statusCode
+}
+
+// BytesWritten returns the number of bytes of the body written.
+func (rww *ResponseWriterWrapper) BytesWritten() int64 {
+	return rww.bytes
+}
+
+// FirstByte returns the time the first byte of the body was written, or the
+// zero time if none was.
+func (rww *ResponseWriterWrapper) FirstByte() time.Time {
+	return rww.firstByte
+}
+
+// Unwrap returns the wrapped writer, used by http.ResponseController.
+func (rww *ResponseWriterWrapper) Unwrap() http.ResponseWriter {
+	return rww.w
+}
+
+// Implements interface http.Flusher. Sends any buffered data to the client,
+// if the wrapped writer supports it, so that streaming responses (like server
+// sent events) are not held back by the wrapper.
+func (rww *ResponseWriterWrapper) Flush() {
+	rww.FlushError()
+}
+
+// FlushError is like Flush but returns http.ErrNotSupported if the wrapped
+// writer doesn't support flushing. Used by http.ResponseController.
+func (rww *ResponseWriterWrapper) FlushError() error {
+	err := http.NewResponseController(rww.w).Flush()
+	if err == nil {
+		rww.wroteHeader = true
+	}
+	return err
+}
+
+// Implements interface http.Hijacker, used for example by WebSockets. Once
+// the connection is hijacked, nothing else is written through the wrapper.
+func (rww *ResponseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rww.w).Hijack()
+	if err == nil && !rww.wroteHeader {
+		rww.statusCode = http.StatusSwitchingProtocols
+		rww.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Implements interface http.Pusher (HTTP/2 server push).
+func (rww *ResponseWriterWrapper) Push(target string, opts *http.PushOptions) error {
+	if p, ok := rww.w.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// Implements interface io.ReaderFrom, so that the wrapped writer can copy the
+// body efficiently (for example, with sendfile) when the body is not
+// captured. The first byte time is taken when the copy starts.
+func (rww *ResponseWriterWrapper) ReadFrom(r io.Reader) (int64, error) {
+	rww.beforeBody(true)
+	if rww.copyBody {
+		r = io.TeeReader(r, rww.body)
+	}
+	var n int64
+	var err error
+	if rf, ok := rww.w.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{rww.w}, r)
+	}
+	rww.bytes += n
+	return n, err
+}
+
+// writerOnly hides the io.ReaderFrom implementation of a writer, so that
+// io.Copy doesn't call it back.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,186 @@
+package gsmiddleware
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// statusRecorder is a writer recording every status written, which doesn't
+// implement any optional interface.
+type statusRecorder struct {
+	header   http.Header
+	statuses []int
+	body     strings.Builder
+}
+
+func (w *statusRecorder) Header() http.Header {
+	if w.header == nil {
+		w.header = http.Header{}
+	}
+	return w.header
+}
+
+func (w *statusRecorder) WriteHeader(statusCode int) {
+	w.statuses = append(w.statuses, statusCode)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	return w.body.Write(b)
+}
+
+func (w *statusRecorder) written() string {
+	return w.body.String()
+}
+
+// readerFromRecorder is a writer implementing io.ReaderFrom.
+type readerFromRecorder struct {
+	statusRecorder
+	readFrom bool
+}
+
+func (w *readerFromRecorder) ReadFrom(r io.Reader) (int64, error) {
+	w.readFrom = true
+	return io.Copy(&w.body, r)
+}
+
+func TestResponseWriterWrapperImplicitStatus(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rww := NewResponseWriterWrapper(rec, true)
+
+	if rww.StatusCode() != http.StatusOK || !rww.FirstByte().IsZero() {
+		t.Fatalf("status = %d before writing, want 200 and no first byte", rww.StatusCode())
+	}
+	rww.Write([]byte("hello"))
+	rww.WriteHeader(http.StatusInternalServerError)
+	rww.Write([]byte(" world"))
+
+	if rww.StatusCode() != http.StatusOK || rec.Code != http.StatusOK {
+		t.Errorf("status = %d (sent %d), want the implicit 200", rww.StatusCode(), rec.Code)
+	}
+	if rww.BytesWritten() != 11 || rww.FirstByte().IsZero() || rec.Body.String() != "hello world" {
+		t.Errorf("wrote %d bytes (%q), want 11 and the first byte time", rww.BytesWritten(), rec.Body.String())
+	}
+	if raw := rww.body.Total(); raw != 11 {
+		t.Errorf("captured %d bytes, want 11", raw)
+	}
+}
+
+func TestResponseWriterWrapperIgnoresSecondStatus(t *testing.T) {
+	rww := NewResponseWriterWrapper(&statusRecorder{}, false)
+	rww.WriteHeader(http.StatusCreated)
+	rww.WriteHeader(http.StatusBadRequest)
+	if rww.StatusCode() != http.StatusCreated {
+		t.Errorf("status = %d, want the first one", rww.StatusCode())
+	}
+	if rww.body != nil {
+		t.Error("body captured although not requested")
+	}
+}
+
+func TestResponseWriterWrapperInformationalStatuses(t *testing.T) {
+	inner := &statusRecorder{}
+	rww := NewResponseWriterWrapper(inner, false)
+	rww.WriteHeader(http.StatusContinue)
+	rww.WriteHeader(http.StatusEarlyHints)
+	if rww.StatusCode() != http.StatusOK {
+		t.Errorf("status = %d after 1xx statuses, want 200 until the final one", rww.StatusCode())
+	}
+	rww.WriteHeader(http.StatusAccepted)
+	if rww.StatusCode() != http.StatusAccepted {
+		t.Errorf("status = %d, want 202", rww.StatusCode())
+	}
+	if len(inner.statuses) != 3 {
+		t.Errorf("statuses sent = %v, want every one", inner.statuses)
+	}
+}
+
+func TestResponseWriterWrapperFlushReachesInnerWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var w http.ResponseWriter = NewResponseWriterWrapper(NewResponseWriterWrapper(rec, false), true)
+
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		t.Fatalf("Flush = %v", err)
+	}
+	if !rec.Flushed {
+		t.Error("the inner writer wasn't flushed")
+	}
+
+	w = NewResponseWriterWrapper(&statusRecorder{}, true)
+	if err := http.NewResponseController(w).Flush(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Flush = %v, want http.ErrNotSupported", err)
+	}
+	w.(http.Flusher).Flush()
+}
+
+func TestResponseWriterWrapperHijack(t *testing.T) {
+	var status int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rww := NewResponseWriterWrapper(w, true)
+		conn, rw, err := http.NewResponseController(rww).Hijack()
+		if err != nil {
+			t.Errorf("Hijack = %v", err)
+			return
+		}
+		defer conn.Close()
+		status = rww.StatusCode()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n")
+		rw.Flush()
+	}))
+	defer srv.Close()
+
+	rs, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rs.Body.Close()
+	if status != http.StatusSwitchingProtocols || rs.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("status = %d (received %d), want 101", status, rs.StatusCode)
+	}
+
+	rww := NewResponseWriterWrapper(httptest.NewRecorder(), false)
+	if _, _, err := rww.Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Hijack = %v, want http.ErrNotSupported", err)
+	}
+	if rww.StatusCode() != http.StatusOK {
+		t.Errorf("status = %d after a failed hijack, want 200", rww.StatusCode())
+	}
+}
+
+func TestResponseWriterWrapperReadFrom(t *testing.T) {
+	for _, inner := range []interface {
+		http.ResponseWriter
+		written() string
+	}{&statusRecorder{}, &readerFromRecorder{}} {
+		rww := NewResponseWriterWrapper(inner, true)
+		n, err := rww.ReadFrom(bufio.NewReader(strings.NewReader("streamed body")))
+		if n != 13 || err != nil || rww.BytesWritten() != 13 {
+			t.Errorf("%T: ReadFrom = %d, %v (%d written), want 13 bytes", inner, n, err, rww.BytesWritten())
+		}
+		if inner.written() != "streamed body" || rww.body.Total() != 13 || rww.FirstByte().IsZero() {
+			t.Errorf("%T: wrote %q and captured %d bytes, want the whole body", inner, inner.written(), rww.body.Total())
+		}
+	}
+}
+
+func TestResponseWriterWrapperReadFromUsesInnerReaderFrom(t *testing.T) {
+	inner := &readerFromRecorder{}
+	body := struct{ io.Reader }{strings.NewReader("body")}
+	if _, err := io.Copy(NewResponseWriterWrapper(inner, false), body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !inner.readFrom {
+		t.Error("the ReadFrom of the inner writer wasn't used")
+	}
+}
+
+func TestResponseWriterWrapperPushNotSupported(t *testing.T) {
+	rww := NewResponseWriterWrapper(httptest.NewRecorder(), false)
+	if err := rww.Push("/style.css", nil); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Push = %v, want http.ErrNotSupported", err)
+	}
+}
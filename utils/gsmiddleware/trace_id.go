@@ -2,7 +2,11 @@ package gsmiddleware
 
 import (
 	"context"
+	"fmt"
+	"goserver/utils/gslog"
 	"net/http"
+	"regexp"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 )
@@ -10,13 +14,161 @@ import (
 // Key type to use when setting the trace ID.
 type ctxKeyTraceId int
 
-// TraceIDKey is the key that holds the unique trace ID in a request context.
-const TraceIDKey ctxKeyTraceId = 0
+const (
+	// TraceIDKey is the key that holds the unique trace ID in a request context.
+	TraceIDKey ctxKeyTraceId = iota
 
-// TraceIDHeader is the name of the HTTP header which contains the trace ID.
+	// traceContextKey is the key that holds the TraceContext of a request.
+	traceContextKey
+
+	// outboundSpanKey is the key that holds the span ID to be sent in the
+	// traceparent header of an outbound request.
+	outboundSpanKey
+)
+
+// TraceIDHeader is the name of the HTTP header which contains the trace ID,
+// used if no header names are configured (see TraceConfig).
 // Exported so that it can be changed if needed.
 var TraceIDHeader = "x-trace-id"
 
+// defaultTraceIDMaxLength is the maximum length of an incoming trace ID
+// accepted if none is configured.
+const defaultTraceIDMaxLength = 128
+
+// defaultTraceIDPattern is the pattern an incoming trace ID must match to be
+// accepted if none is configured.
+const defaultTraceIDPattern = `^[A-Za-z0-9._:-]+$`
+
+// traceSettings holds the current *traceIDSettings. See ConfigureTrace.
+var traceSettings atomic.Value
+
+// traceIDSettings contains the resolved configuration of the TraceID
+// middleware.
+type traceIDSettings struct {
+
+	// headers are the names of the headers carrying the trace ID.
+	headers        []string
+
+	// acceptIncoming specifies whether a trace ID received is kept.
+	acceptIncoming bool
+
+	// maxLength is the maximum length of a trace ID received.
+	maxLength      int
+
+	// pattern must be matched by a trace ID received.
+	pattern        *regexp.Regexp
+}
+
+// TraceConfig contains the configuration properties of the trace ID handling.
+// Every field is optional and, if not set, its default is used.
+type TraceConfig struct {
+
+	// Headers are the names of the headers from which a trace ID is accepted,
+	// in order of preference. The first one is also used to send the trace
+	// ID in responses and outbound requests. If not set, TraceIDHeader is
+	// used.
+	Headers        []string `json:"headers"`
+
+	// AcceptIncoming specifies whether a trace ID received in a request is
+	// used for it, instead of generating a new one. Enabled by default.
+	AcceptIncoming *bool    `json:"accept_incoming"`
+
+	// MaxLength is the maximum length of a trace ID received. Longer ones are
+	// ignored. If not set, defaultTraceIDMaxLength is used.
+	MaxLength      *int     `json:"max_length"`
+
+	// Pattern is a regular expression a trace ID received must match to be
+	// accepted. If not set, defaultTraceIDPattern is used.
+	Pattern        *string  `json:"pattern"`
+}
+
+// TraceContext contains the trace information of a request, taken from its
+// headers or generated by the TraceID middleware.
+type TraceContext struct {
+
+	// TraceID is the trace ID of the request, as returned by GetTraceID.
+	TraceID      string
+
+	// W3CTraceID is the W3C trace ID (32 hex characters). It's the one
+	// received in the traceparent header or, if there's none, it's derived
+	// from TraceID.
+	W3CTraceID   string
+
+	// SpanID is the ID of the span of this service (16 hex characters), new
+	// for every request received.
+	SpanID       string
+
+	// ParentSpanID is the ID of the caller span, received in the traceparent
+	// header. Empty if there's none.
+	ParentSpanID string
+
+	// Flags are the W3C trace flags.
+	Flags        byte
+
+	// TraceState is the tracestate header received, forwarded as is.
+	TraceState   string
+}
+
+// Initialization. Sets the default settings and lets gslog add the trace ID
+// and span ID to the log lines.
+func init() {
+	ConfigureTrace(TraceConfig{})
+	gslog.SetTraceIDExtractor(GetTraceID)
+	gslog.SetSpanIDExtractor(GetSpanID)
+}
+
+// ConfigureTrace enables the configuration of the TraceID middleware and the
+// TracingTransport. Every call replaces the whole configuration: properties
+// not set go back to their defaults.
+func ConfigureTrace(tc TraceConfig) {
+	s := &traceIDSettings{
+		headers:        []string{TraceIDHeader},
+		acceptIncoming: true,
+		maxLength:      defaultTraceIDMaxLength,
+		pattern:        regexp.MustCompile(defaultTraceIDPattern),
+	}
+	if len(tc.Headers) > 0 {
+		s.headers = tc.Headers
+	}
+	if tc.AcceptIncoming != nil {
+		s.acceptIncoming = *tc.AcceptIncoming
+	}
+	if tc.MaxLength != nil {
+		s.maxLength = *tc.MaxLength
+	}
+	if tc.Pattern != nil {
+		if pattern, err := regexp.Compile(*tc.Pattern); err == nil {
+			s.pattern = pattern
+		}
+	}
+	traceSettings.Store(s)
+}
+
+// currentTrace returns the current settings of the trace ID handling.
+func currentTrace() *traceIDSettings {
+	return traceSettings.Load().(*traceIDSettings)
+}
+
+// incomingTraceID returns the trace ID received in the first configured
+// header present in the request, or the empty string if there's none or it's
+// not valid. In the latter case, the name of the header is returned as well.
+func (s *traceIDSettings) incomingTraceID(r *http.Request) (traceID string, rejected string) {
+	if !s.acceptIncoming {
+		return "", ""
+	}
+	for _, h := range s.headers {
+		value := r.Header.Get(h)
+		if value == "" {
+			continue
+		}
+		if len(value) > s.maxLength || !s.pattern.MatchString(value) {
+			return "", h
+		}
+		return value, ""
+	}
+	return "", ""
+}
+
 // TracingTransport wraps an http.RoundTripper adding the trace-id if found in
 // the request context. For this to work, the request should be generated using
 // a context that already has the trace-id set.
@@ -29,30 +181,81 @@ type TracingTransport struct {
 // http.Request's Context must contain a trace id. This can be achieved by
 // creating it with http.NewRequestWithContext function and passing a context
 // that already contains the id.
+//
+// Besides the trace ID header, the W3C traceparent (and tracestate, if one
+// was received) header is sent. Its parent ID is the one set in the context
+// with WithOutboundSpanID or, if there's none, a new one for every request.
 func (tt *TracingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	traceID := GetTraceID(r.Context())
 	if traceID != "" {
-		r.Header.Set(TraceIDHeader, traceID)
+		r.Header.Set(currentTrace().headers[0], traceID)
+	}
+	if tc, ok := GetTraceContext(r.Context()); ok {
+		spanID := GetOutboundSpanID(r.Context())
+		if spanID == "" {
+			spanID = NewSpanID()
+			r = r.WithContext(WithOutboundSpanID(r.Context(), spanID))
+		}
+		tp := traceparent{traceID: tc.W3CTraceID, parentID: spanID, flags: tc.Flags}
+		r.Header.Set(TraceparentHeader, tp.String())
+		if tc.TraceState != "" {
+			r.Header.Set(TracestateHeader, tc.TraceState)
+		}
 	}
 	return tt.Base.RoundTrip(r)
 }
 
 // TraceID is a middleware that injects a trace ID into the context of each
-// request. UUID is used as trace ID.
+// request. The trace ID received in the configured headers is used if it's
+// valid (see TraceConfig); otherwise, the one in the W3C traceparent header,
+// or a new UUID if there's none.
 // Once the ID is set in the context, it can be used in any step of the flow
-// by anyone who receives the context.
+// by anyone who receives the context. The whole TraceContext, including the
+// span ID of this hop, is available with GetTraceContext.
 func TraceID(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 
+		s := currentTrace()
+		tc := TraceContext{
+			SpanID: NewSpanID(),
+			Flags:  sampledFlag,
+		}
+
+		// Continue the W3C trace, if any.
+		if tp, ok := parseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			tc.W3CTraceID = tp.traceID
+			tc.ParentSpanID = tp.parentID
+			tc.Flags = tp.flags
+			if ts := r.Header.Get(TracestateHeader); len(ts) <= maxTracestateLength {
+				tc.TraceState = ts
+			}
+		}
+
 		// ID to be used across request flow.
-		traceID := new()
+		traceID, rejected := s.incomingTraceID(r)
+		switch {
+		case traceID != "":
+			tc.TraceID = traceID
+		case tc.W3CTraceID != "":
+			tc.TraceID = tc.W3CTraceID
+		default:
+			tc.TraceID = new()
+		}
+		if tc.W3CTraceID == "" {
+			tc.W3CTraceID = w3cTraceID(tc.TraceID)
+		}
+		if rejected != "" {
+			gslog.Warn(fmt.Sprintf("Invalid trace ID received in header %s. A new one is used", rejected), tc.TraceID)
+		}
 
 		// Add the id as request and response headers for better trace.
-		r.Header.Set(TraceIDHeader, traceID)
-		w.Header().Add(TraceIDHeader, traceID)
+		header := s.headers[0]
+		r.Header.Set(header, tc.TraceID)
+		w.Header().Set(header, tc.TraceID)
 
 		// Add traceId to request context.
-		ctx := context.WithValue(r.Context(), TraceIDKey, traceID)
+		ctx := context.WithValue(r.Context(), TraceIDKey, tc.TraceID)
+		ctx = context.WithValue(ctx, traceContextKey, tc)
 
 		next.ServeHTTP(w, r.Clone(ctx))
 	}
@@ -68,7 +271,42 @@ func GetTraceID(ctx context.Context) string {
 	return ""
 }
 
+// GetTraceContext returns the TraceContext set by the TraceID middleware in
+// the given context, if any.
+func GetTraceContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey).(TraceContext)
+	return tc, ok
+}
+
+// GetSpanID returns the span ID of the given context: the one set with
+// WithOutboundSpanID for outbound requests or, if there's none, the span ID of
+// the request received. Returns the empty string if none is found.
+func GetSpanID(ctx context.Context) string {
+	if spanID := GetOutboundSpanID(ctx); spanID != "" {
+		return spanID
+	}
+	if tc, ok := GetTraceContext(ctx); ok {
+		return tc.SpanID
+	}
+	return ""
+}
+
+// WithOutboundSpanID returns a copy of ctx holding the span ID to be sent as
+// parent ID in the traceparent header of the outbound requests made with it.
+func WithOutboundSpanID(ctx context.Context, spanID string) context.Context {
+	return context.WithValue(ctx, outboundSpanKey, spanID)
+}
+
+// GetOutboundSpanID returns the span ID set with WithOutboundSpanID, or the
+// empty string if there's none.
+func GetOutboundSpanID(ctx context.Context) string {
+	if spanID, ok := ctx.Value(outboundSpanKey).(string); ok {
+		return spanID
+	}
+	return ""
+}
+
 // new returns a new unique trace-id using a random uuid string.
 func new() string {
 	return uuid.New().String()
-}
\ No newline at end of file
+}
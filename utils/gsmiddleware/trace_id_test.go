@@ -0,0 +1,126 @@
+package gsmiddleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// serveTraced runs the TraceID middleware for a request with the given
+// headers and returns the TraceContext seen by the next handler and the
+// response.
+func serveTraced(t *testing.T, headers map[string]string) (TraceContext, *httptest.ResponseRecorder) {
+	t.Helper()
+	var tc TraceContext
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if tc, ok = GetTraceContext(r.Context()); !ok {
+			t.Fatal("no TraceContext in the request context")
+		}
+		if GetTraceID(r.Context()) != tc.TraceID {
+			t.Errorf("GetTraceID = %q, want %q", GetTraceID(r.Context()), tc.TraceID)
+		}
+	})
+	r := httptest.NewRequest(http.MethodGet, "/resource", nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	TraceID(next).ServeHTTP(w, r)
+	return tc, w
+}
+
+func TestTraceIDValidatesIncomingHeader(t *testing.T) {
+	maxLength := 16
+	ConfigureTrace(TraceConfig{Headers: []string{"x-request-id", TraceIDHeader}, MaxLength: &maxLength})
+	t.Cleanup(func() { ConfigureTrace(TraceConfig{}) })
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"accepted", map[string]string{"x-request-id": "abc-123"}, "abc-123"},
+		{"second header", map[string]string{TraceIDHeader: "abc.456:7_8"}, "abc.456:7_8"},
+		{"first header preferred", map[string]string{"x-request-id": "first", TraceIDHeader: "second"}, "first"},
+		{"maximum length", map[string]string{"x-request-id": strings.Repeat("a", 16)}, strings.Repeat("a", 16)},
+		{"too long", map[string]string{"x-request-id": strings.Repeat("a", 17)}, ""},
+		{"invalid characters", map[string]string{"x-request-id": "abc 123"}, ""},
+		{"invalid first header", map[string]string{"x-request-id": "a/b", TraceIDHeader: "valid"}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, w := serveTraced(t, tt.headers)
+			if tt.want != "" && tc.TraceID != tt.want {
+				t.Errorf("TraceID = %q, want %q", tc.TraceID, tt.want)
+			}
+			if tt.want == "" {
+				if _, err := uuid.Parse(tc.TraceID); err != nil {
+					t.Errorf("TraceID = %q, want a new UUID", tc.TraceID)
+				}
+			}
+			if got := w.Header().Get("x-request-id"); got != tc.TraceID {
+				t.Errorf("response header = %q, want %q", got, tc.TraceID)
+			}
+			if w.Header().Get(TraceIDHeader) != "" {
+				t.Errorf("unexpected response header %s", TraceIDHeader)
+			}
+		})
+	}
+}
+
+func TestTraceIDIgnoresIncomingWhenDisabled(t *testing.T) {
+	accept := false
+	ConfigureTrace(TraceConfig{AcceptIncoming: &accept})
+	t.Cleanup(func() { ConfigureTrace(TraceConfig{}) })
+
+	tc, _ := serveTraced(t, map[string]string{TraceIDHeader: "abc-123"})
+	if tc.TraceID == "abc-123" {
+		t.Error("trace ID received was used although accept_incoming is false")
+	}
+}
+
+func TestTraceIDContinuesTraceparent(t *testing.T) {
+	traceparent := "00-" + validTraceID + "-" + validParentID + "-00"
+	tc, w := serveTraced(t, map[string]string{TraceparentHeader: traceparent, TracestateHeader: "vendor=value"})
+	want := TraceContext{
+		TraceID:      validTraceID,
+		W3CTraceID:   validTraceID,
+		SpanID:       tc.SpanID,
+		ParentSpanID: validParentID,
+		Flags:        0x00,
+		TraceState:   "vendor=value",
+	}
+	if tc != want {
+		t.Errorf("TraceContext = %+v, want %+v", tc, want)
+	}
+	if len(tc.SpanID) != 16 || tc.SpanID == validParentID {
+		t.Errorf("SpanID = %q, want a new span ID", tc.SpanID)
+	}
+	if got := w.Header().Get(TraceIDHeader); got != validTraceID {
+		t.Errorf("response header = %q, want %q", got, validTraceID)
+	}
+}
+
+func TestTraceIDIgnoresInvalidTraceparent(t *testing.T) {
+	tc, _ := serveTraced(t, map[string]string{
+		TraceIDHeader:     "4BF92F35-77B3-4DA6-A3CE-929D0E0E4736",
+		TraceparentHeader: "ff-" + validTraceID + "-" + validParentID + "-01",
+		TracestateHeader:  "vendor=value",
+	})
+	if tc.W3CTraceID != validTraceID || tc.ParentSpanID != "" || tc.TraceState != "" || tc.Flags != sampledFlag {
+		t.Errorf("TraceContext = %+v, want one derived from the trace ID header", tc)
+	}
+}
+
+func TestTraceIDDropsLongTracestate(t *testing.T) {
+	traceparent := "00-" + validTraceID + "-" + validParentID + "-01"
+	tc, _ := serveTraced(t, map[string]string{TraceparentHeader: traceparent, TracestateHeader: strings.Repeat("a", maxTracestateLength+1)})
+	if tc.TraceState != "" {
+		t.Errorf("TraceState of %d characters kept", len(tc.TraceState))
+	}
+}
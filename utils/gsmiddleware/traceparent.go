@@ -0,0 +1,120 @@
+package gsmiddleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// TraceparentHeader is the name of the W3C Trace Context header carrying the
+// trace ID, the ID of the caller span and the trace flags.
+// See https://www.w3.org/TR/trace-context/.
+const TraceparentHeader = "traceparent"
+
+// TracestateHeader is the name of the W3C Trace Context header carrying
+// vendor specific trace information. It's forwarded as received.
+const TracestateHeader = "tracestate"
+
+// maxTracestateLength is the maximum length of a tracestate header kept, as
+// recommended by the W3C Trace Context specification.
+const maxTracestateLength = 512
+
+// sampledFlag is the trace flag marking the trace as sampled.
+const sampledFlag byte = 0x01
+
+// traceparent contains the fields of a W3C traceparent header.
+type traceparent struct {
+
+	// traceID is the W3C trace ID: 32 lowercase hex characters.
+	traceID  string
+
+	// parentID is the ID of the caller span: 16 lowercase hex characters.
+	parentID string
+
+	// flags are the trace flags (only "sampled" is defined).
+	flags    byte
+}
+
+// String returns the traceparent formatted as a version 00 header value.
+func (tp traceparent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tp.traceID, tp.parentID, tp.flags)
+}
+
+// parseTraceparent parses the value of a traceparent header. Returns false if
+// the value is not valid, in which case it must be ignored.
+//
+// Versions other than 00 are accepted as long as they start with the version
+// 00 fields, as required by the specification.
+func parseTraceparent(value string) (traceparent, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 55 {
+		return traceparent{}, false
+	}
+	version := value[0:2]
+	if !isHex(version) || version == "ff" {
+		return traceparent{}, false
+	}
+	if (version == "00" && len(value) != 55) || (len(value) > 55 && value[55] != '-') {
+		return traceparent{}, false
+	}
+	if value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return traceparent{}, false
+	}
+	tp := traceparent{
+		traceID:  value[3:35],
+		parentID: value[36:52],
+	}
+	if !isHex(tp.traceID) || isZero(tp.traceID) || !isHex(tp.parentID) || isZero(tp.parentID) {
+		return traceparent{}, false
+	}
+	flags, err := hex.DecodeString(value[53:55])
+	if err != nil {
+		return traceparent{}, false
+	}
+	tp.flags = flags[0]
+	return tp, true
+}
+
+// w3cTraceID returns the given trace ID as a W3C trace ID, if it can be
+// converted (for example, a UUID without its dashes), or a new random one.
+func w3cTraceID(traceID string) string {
+	id := strings.ToLower(strings.ReplaceAll(traceID, "-", ""))
+	if len(id) == 32 && isHex(id) && !isZero(id) {
+		return id
+	}
+	return randomHex(16)
+}
+
+// NewSpanID returns a new random W3C span ID (16 hex characters).
+func NewSpanID() string {
+	return randomHex(8)
+}
+
+// randomHex returns n random bytes formatted as lowercase hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Sprintf("couldn't generate random id: %s", err.Error()))
+		}
+		if id := hex.EncodeToString(b); !isZero(id) {
+			return id
+		}
+	}
+}
+
+// isHex reports whether s contains only lowercase hex characters.
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// isZero reports whether s contains only zeros, which is not a valid ID.
+func isZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
@@ -0,0 +1,111 @@
+package gsmiddleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const (
+	validTraceID  = "4bf92f3577b34da6a3ce929d0e0e4736"
+	validParentID = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  string
+		ok     bool
+		parsed traceparent
+	}{
+		{"sampled", "00-" + validTraceID + "-" + validParentID + "-01", true,
+			traceparent{traceID: validTraceID, parentID: validParentID, flags: 0x01}},
+		{"not sampled", "00-" + validTraceID + "-" + validParentID + "-00", true,
+			traceparent{traceID: validTraceID, parentID: validParentID, flags: 0x00}},
+		{"surrounding spaces", " 00-" + validTraceID + "-" + validParentID + "-01 ", true,
+			traceparent{traceID: validTraceID, parentID: validParentID, flags: 0x01}},
+		{"future version", "01-" + validTraceID + "-" + validParentID + "-01", true,
+			traceparent{traceID: validTraceID, parentID: validParentID, flags: 0x01}},
+		{"future version with more fields", "cc-" + validTraceID + "-" + validParentID + "-01-what-the-future-holds", true,
+			traceparent{traceID: validTraceID, parentID: validParentID, flags: 0x01}},
+		{"empty", "", false, traceparent{}},
+		{"version ff", "ff-" + validTraceID + "-" + validParentID + "-01", false, traceparent{}},
+		{"version 00 with more fields", "00-" + validTraceID + "-" + validParentID + "-01-extra", false, traceparent{}},
+		{"future version without separator", "01-" + validTraceID + "-" + validParentID + "-01x", false, traceparent{}},
+		{"zero trace ID", "00-" + strings.Repeat("0", 32) + "-" + validParentID + "-01", false, traceparent{}},
+		{"zero parent ID", "00-" + validTraceID + "-" + strings.Repeat("0", 16) + "-01", false, traceparent{}},
+		{"short trace ID", "00-" + validTraceID[1:] + "-" + validParentID + "-01", false, traceparent{}},
+		{"long parent ID", "00-" + validTraceID + "-" + validParentID + "0-01", false, traceparent{}},
+		{"short flags", "00-" + validTraceID + "-" + validParentID + "-1", false, traceparent{}},
+		{"upper-case trace ID", "00-" + strings.ToUpper(validTraceID) + "-" + validParentID + "-01", false, traceparent{}},
+		{"upper-case version", "0A-" + validTraceID + "-" + validParentID + "-01", false, traceparent{}},
+		{"non hex flags", "00-" + validTraceID + "-" + validParentID + "-0g", false, traceparent{}},
+		{"wrong separators", "00_" + validTraceID + "_" + validParentID + "_01", false, traceparent{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, ok := parseTraceparent(tt.value)
+			if ok != tt.ok || parsed != tt.parsed {
+				t.Errorf("parseTraceparent(%q) = %+v, %v, want %+v, %v", tt.value, parsed, ok, tt.parsed, tt.ok)
+			}
+		})
+	}
+}
+
+func TestTraceparentString(t *testing.T) {
+	tp := traceparent{traceID: validTraceID, parentID: validParentID, flags: 0x01}
+	want := "00-" + validTraceID + "-" + validParentID + "-01"
+	if got := tp.String(); got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if parsed, ok := parseTraceparent(tp.String()); !ok || parsed != tp {
+		t.Errorf("couldn't read back %q: %+v, %v", tp.String(), parsed, ok)
+	}
+}
+
+func TestW3CTraceID(t *testing.T) {
+	if got := w3cTraceID("4BF92F35-77B3-4DA6-A3CE-929D0E0E4736"); got != validTraceID {
+		t.Errorf("w3cTraceID(uuid) = %q, want %q", got, validTraceID)
+	}
+	for _, traceID := range []string{"not-a-uuid", strings.Repeat("0", 32), "4bf92f3577b34da6"} {
+		got := w3cTraceID(traceID)
+		if _, ok := parseTraceparent("00-" + got + "-" + validParentID + "-01"); !ok {
+			t.Errorf("w3cTraceID(%q) = %q, want a new valid trace ID", traceID, got)
+		}
+	}
+}
+
+func TestTracingTransportSendsTraceparent(t *testing.T) {
+	var received http.Header
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		received = r.Header.Clone()
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+	tc := TraceContext{TraceID: "trace-1", W3CTraceID: validTraceID, SpanID: "1111111111111111", Flags: 0x00, TraceState: "vendor=value"}
+	ctx := context.WithValue(context.Background(), TraceIDKey, tc.TraceID)
+	ctx = context.WithValue(ctx, traceContextKey, tc)
+	ctx = WithOutboundSpanID(ctx, validParentID)
+
+	r := httptest.NewRequest(http.MethodGet, "http://localhost/resource", nil).WithContext(ctx)
+	if _, err := (&TracingTransport{Base: base}).RoundTrip(r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := received.Get(TraceIDHeader); got != "trace-1" {
+		t.Errorf("%s = %q, want trace-1", TraceIDHeader, got)
+	}
+	if got, want := received.Get(TraceparentHeader), "00-"+validTraceID+"-"+validParentID+"-00"; got != want {
+		t.Errorf("traceparent = %q, want %q", got, want)
+	}
+	if got := received.Get(TracestateHeader); got != "vendor=value" {
+		t.Errorf("tracestate = %q, want vendor=value", got)
+	}
+}
+
+// roundTripFunc adapts a function to the http.RoundTripper interface.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,229 @@
+package gsrender
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// JSONEncoder writes values as JSON. Registered by default.
+var JSONEncoder = &Encoder{
+	MediaTypes:  []string{"application/json"},
+	ContentType: "application/json",
+	Marshal:     json.Marshal,
+}
+
+// XMLEncoder writes values as XML. Slices are written inside a root element
+// named xmlListElement, with an element per item, so that the document is
+// well-formed even if they are empty. Registered by default.
+var XMLEncoder = &Encoder{
+	MediaTypes:  []string{"application/xml", "text/xml"},
+	ContentType: "text/xml",
+	Marshal:     marshalXML,
+}
+
+// xmlListElement is the name of the root element of the slices written as XML.
+const xmlListElement = "list"
+
+// YAMLEncoder writes values as YAML. The keys are the ones of their JSON
+// encoding, so the json tags are honored.
+var YAMLEncoder = &Encoder{
+	MediaTypes:  []string{"application/yaml", "application/x-yaml", "text/yaml"},
+	ContentType: "application/yaml",
+	Marshal:     marshalYAML,
+}
+
+// CSVEncoder writes values as CSV: slices as one row per element and any
+// other value as a single row, with a header with the keys of their JSON
+// encoding. Nested objects and arrays are written as JSON.
+var CSVEncoder = &Encoder{
+	MediaTypes:  []string{"text/csv"},
+	ContentType: "text/csv; charset=utf-8",
+	Marshal:     marshalCSV,
+}
+
+// MsgPackEncoder writes values as MessagePack. The keys are the ones of the
+// json tags.
+var MsgPackEncoder = &Encoder{
+	MediaTypes:  []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack"},
+	ContentType: "application/msgpack",
+	Marshal:     marshalMsgPack,
+}
+
+// marshalXML encodes v as XML (see XMLEncoder).
+func marshalXML(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if (rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8) || rv.Kind() == reflect.Array {
+		return xml.Marshal(xmlList{items: rv})
+	}
+	return xml.Marshal(v)
+}
+
+// xmlList is a slice written as XML inside an xmlListElement.
+type xmlList struct {
+	items reflect.Value
+}
+
+// Implements interface xml.Marshaler. Each item is written with its own
+// element name: its XMLName or the name of its type.
+func (l xmlList) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Local: xmlListElement}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for i := 0; i < l.items.Len(); i++ {
+		if err := e.Encode(l.items.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// marshalYAML encodes v as YAML. As JSON is valid YAML, it's encoded as JSON
+// and parsed to a yaml.Node, which keeps the order of the keys, and then
+// written in block style.
+func marshalYAML(v interface{}) ([]byte, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(j, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// blockStyle removes the styles of the node and its children, so that they
+// are written in block style and strings are only quoted if needed.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// marshalCSV encodes v as CSV (see CSVEncoder). Fails if v is not an object
+// or a slice.
+func marshalCSV(v interface{}) ([]byte, error) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var rows []json.RawMessage
+	switch firstByte(j) {
+	case '[':
+		if err := json.Unmarshal(j, &rows); err != nil {
+			return nil, err
+		}
+	case '{':
+		rows = []json.RawMessage{j}
+	default:
+		return nil, fmt.Errorf("cannot write %T as CSV", v)
+	}
+
+	// The header has every key, in the order they are first found. Elements
+	// which are not objects are written in a "value" column.
+	var header []string
+	index := map[string]int{}
+	records := make([]map[string]string, len(rows))
+	for i, row := range rows {
+		keys, values, err := objectFields(row)
+		if err != nil {
+			return nil, err
+		}
+		records[i] = values
+		for _, k := range keys {
+			if _, ok := index[k]; !ok {
+				index[k] = len(header)
+				header = append(header, k)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(header)
+	for _, record := range records {
+		line := make([]string, len(header))
+		for k, value := range record {
+			line[index[k]] = value
+		}
+		w.Write(line)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// objectFields returns the keys of the given JSON object, in order, and their
+// values as CSV fields. Any other JSON value is returned as a "value" key.
+func objectFields(raw json.RawMessage) ([]string, map[string]string, error) {
+	if firstByte(raw) != '{' {
+		return []string{"value"}, map[string]string{"value": csvField(raw)}, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.Token()
+	var keys []string
+	values := map[string]string{}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key := t.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = csvField(value)
+	}
+	return keys, values, nil
+}
+
+// csvField returns the given JSON value as a CSV field: strings unquoted,
+// null empty and anything else as JSON.
+func csvField(raw json.RawMessage) string {
+	switch firstByte(raw) {
+	case '"':
+		var s string
+		json.Unmarshal(raw, &s)
+		return s
+	case 'n':
+		return ""
+	}
+	return string(raw)
+}
+
+// firstByte returns the first byte of the JSON value, skipping whitespace.
+func firstByte(j []byte) byte {
+	j = bytes.TrimLeft(j, " \t\r\n")
+	if len(j) == 0 {
+		return 0
+	}
+	return j[0]
+}
+
+// marshalMsgPack encodes v as MessagePack, using the json tags.
+func marshalMsgPack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
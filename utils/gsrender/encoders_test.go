@@ -0,0 +1,112 @@
+package gsrender
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// wellFormed reports whether data is a well-formed XML document, with a
+// single root element.
+func wellFormed(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	depth, roots := 0, 0
+	for {
+		t, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch t.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func TestXMLEncoder(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+		want string
+	}{
+		{"struct", item{ID: 1, Name: "a"}, `<item><id>1</id><name>a</name></item>`},
+		{"slice", []item{{ID: 1, Name: "a"}, {ID: 2}}, `<list><item><id>1</id><name>a</name></item><item><id>2</id><name></name></item></list>`},
+		{"pointer to slice", &[]int{1, 2}, `<list><int>1</int><int>2</int></list>`},
+		{"empty slice", []item{}, `<list></list>`},
+		{"nil slice", []item(nil), `<list></list>`},
+		{"array", [1]string{"a"}, `<list><string>a</string></list>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := XMLEncoder.Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("xml = %s, want %s", data, tt.want)
+			}
+			if err := wellFormed(data); err != nil {
+				t.Errorf("xml %s is not well-formed: %v", data, err)
+			}
+		})
+	}
+}
+
+func TestYAMLEncoder(t *testing.T) {
+	data, err := YAMLEncoder.Marshal([]item{{ID: 1, Name: "a: b"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "- id: 1\n  name: 'a: b'\n"; string(data) != want {
+		t.Errorf("yaml = %q, want %q", data, want)
+	}
+}
+
+func TestCSVEncoder(t *testing.T) {
+	type row struct {
+		ID   int               `json:"id"`
+		Tags []string          `json:"tags,omitempty"`
+		Meta map[string]string `json:"meta,omitempty"`
+	}
+	data, err := CSVEncoder.Marshal([]row{{ID: 1}, {ID: 2, Tags: []string{"a"}, Meta: map[string]string{"k": "v"}}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "id,tags,meta\n1,,\n2,\"[\"\"a\"\"]\",\"{\"\"k\"\":\"\"v\"\"}\"\n"
+	if string(data) != want {
+		t.Errorf("csv = %q, want %q", data, want)
+	}
+
+	if _, err := CSVEncoder.Marshal(3); err == nil {
+		t.Error("expected an error for a number")
+	}
+}
+
+func TestMsgPackEncoder(t *testing.T) {
+	data, err := MsgPackEncoder.Marshal(item{ID: 1, Name: "a"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]interface{}
+	if err := msgpack.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["name"] != "a" || len(got) != 2 {
+		t.Errorf("msgpack = %v, want the json keys", got)
+	}
+}
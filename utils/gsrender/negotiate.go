@@ -0,0 +1,259 @@
+package gsrender
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Encoder writes values with a media type. Encoders are registered with
+// Register and chosen by Negotiate according to the Accept header of the
+// request.
+type Encoder struct {
+
+	// MediaTypes are the media types the encoder produces, matched against
+	// the Accept header. The first one identifies the encoder.
+	MediaTypes  []string
+
+	// ContentType is the value of the Content-Type header written.
+	ContentType string
+
+	// Marshal encodes the value. If it fails (for example, because the
+	// format can't represent the value), the next acceptable encoder is
+	// tried.
+	Marshal     func(v interface{}) ([]byte, error)
+}
+
+// encoders are the registered encoders, in order of preference.
+var encoders = []*Encoder{JSONEncoder, XMLEncoder}
+
+// encodersMu synchronizes the access to encoders.
+var encodersMu sync.RWMutex
+
+// notAcceptable returns the body written when no encoder is acceptable.
+var notAcceptable func(r *http.Request) interface{}
+
+// Register adds the given encoders, after the ones already registered (the
+// first one, JSON by default, is used when the request accepts any media
+// type). An encoder with the same first media type as a registered one
+// replaces it.
+func Register(es ...*Encoder) {
+	encodersMu.Lock()
+	defer encodersMu.Unlock()
+	for _, e := range es {
+		replaced := false
+		for i, registered := range encoders {
+			if registered.MediaTypes[0] == e.MediaTypes[0] {
+				encoders[i] = e
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			encoders = append(encoders, e)
+		}
+	}
+}
+
+// SetNotAcceptable sets the function returning the body written, with status
+// 406, when the request doesn't accept any of the media types offered. The
+// body is written with the preferred encoder. If not set, only the status is
+// written.
+func SetNotAcceptable(f func(r *http.Request) interface{}) {
+	notAcceptable = f
+}
+
+// Negotiate encodes v with the encoder that best matches the Accept header of
+// the request (see Encoder) and writes it to the given http.ResponseWriter
+// with the provided status. Encoders accepted with the same weight are chosen
+// in order of preference: the ones producing the preferred media types, if
+// given, and then the rest in the order they were registered. So, if the
+// request doesn't have an Accept header, the first preferred media type is
+// written (JSON, if none is given).
+//
+// If no encoder is acceptable, 406 is written instead (see SetNotAcceptable).
+// The Vary header always includes Accept, as the response depends on it.
+func Negotiate(rw http.ResponseWriter, r *http.Request, status uint, v interface{}, preferred ...string) {
+	AddVary(rw.Header(), "Accept")
+
+	candidates := offered(preferred)
+	for _, e := range acceptable(r.Header.Values("Accept"), candidates) {
+		if body, err := e.Marshal(v); err == nil {
+			write(rw, int(status), e.ContentType, body)
+			return
+		}
+	}
+
+	if notAcceptable == nil || len(candidates) == 0 {
+		rw.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+	body, err := candidates[0].Marshal(notAcceptable(r))
+	if err != nil {
+		rw.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+	write(rw, http.StatusNotAcceptable, candidates[0].ContentType, body)
+}
+
+// write writes the body with the given status and Content-Type header.
+func write(rw http.ResponseWriter, status int, contentType string, body []byte) {
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(status)
+	rw.Write(body)
+}
+
+// offered returns the registered encoders in order of preference: the ones
+// producing the preferred media types, in that order, and then the rest.
+func offered(preferred []string) []*Encoder {
+	encodersMu.RLock()
+	defer encodersMu.RUnlock()
+	es := make([]*Encoder, 0, len(encoders))
+	seen := map[*Encoder]bool{}
+	for _, mt := range preferred {
+		for _, e := range encoders {
+			if !seen[e] && produces(e, mt) {
+				es = append(es, e)
+				seen[e] = true
+				break
+			}
+		}
+	}
+	for _, e := range encoders {
+		if !seen[e] {
+			es = append(es, e)
+		}
+	}
+	return es
+}
+
+// produces reports whether the encoder produces the given media type.
+func produces(e *Encoder, mediaType string) bool {
+	for _, mt := range e.MediaTypes {
+		if strings.EqualFold(mt, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaRange is a media range of an Accept header, with its weight.
+type mediaRange struct {
+
+	// typ is the type, or * for any.
+	typ     string
+
+	// subtype is the subtype, or * for any.
+	subtype string
+
+	// q is the weight, between 0 and 1.
+	q       float64
+}
+
+// specificity returns how specific the range is: 2 for type/subtype, 1 for
+// type/* and 0 for */*.
+func (mr mediaRange) specificity() int {
+	switch {
+	case mr.typ == "*":
+		return 0
+	case mr.subtype == "*":
+		return 1
+	}
+	return 2
+}
+
+// matches reports whether the range includes the given media type.
+func (mr mediaRange) matches(typ, subtype string) bool {
+	return (mr.typ == "*" || mr.typ == typ) && (mr.subtype == "*" || mr.subtype == subtype)
+}
+
+// parseAccept returns the media ranges of the given Accept header values.
+// Malformed ranges are ignored. If there are no values, every media type is
+// accepted.
+func parseAccept(values []string) []mediaRange {
+	if len(values) == 0 {
+		return []mediaRange{{typ: "*", subtype: "*", q: 1}}
+	}
+	var ranges []mediaRange
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if strings.TrimSpace(part) == "" {
+				continue
+			}
+			mt, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			typ, subtype, ok := strings.Cut(mt, "/")
+			if !ok || (typ == "*" && subtype != "*") {
+				continue
+			}
+			q := 1.0
+			if qs, ok := params["q"]; ok {
+				q, err = strconv.ParseFloat(qs, 64)
+				if err != nil || q < 0 || q > 1 {
+					continue
+				}
+			}
+			ranges = append(ranges, mediaRange{typ: typ, subtype: subtype, q: q})
+		}
+	}
+	return ranges
+}
+
+// acceptable returns the encoders accepted by the given Accept header values,
+// sorted by their weight, then by the specificity of the range matching them
+// and then by the order they were given in. Each encoder is weighted by the
+// most specific range matching any of its media types.
+func acceptable(accept []string, candidates []*Encoder) []*Encoder {
+	ranges := parseAccept(accept)
+
+	type match struct {
+		e           *Encoder
+		q           float64
+		specificity int
+	}
+	var matches []match
+	for _, e := range candidates {
+		best := match{e: e, specificity: -1}
+		for _, mt := range e.MediaTypes {
+			typ, subtype, _ := strings.Cut(strings.ToLower(mt), "/")
+			for _, mr := range ranges {
+				if mr.matches(typ, subtype) && mr.specificity() > best.specificity {
+					best.q, best.specificity = mr.q, mr.specificity()
+				}
+			}
+		}
+		if best.specificity >= 0 && best.q > 0 {
+			matches = append(matches, best)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].q != matches[j].q {
+			return matches[i].q > matches[j].q
+		}
+		return matches[i].specificity > matches[j].specificity
+	})
+	es := make([]*Encoder, len(matches))
+	for i, m := range matches {
+		es[i] = m.e
+	}
+	return es
+}
+
+// AddVary adds the given header name to the Vary header, if not already
+// included.
+func AddVary(h http.Header, name string) {
+	for _, value := range h.Values("Vary") {
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v == "*" || strings.EqualFold(v, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
@@ -0,0 +1,107 @@
+package gsrender
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// item is the value written in these tests.
+type item struct {
+	ID   int    `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+// negotiate calls Negotiate for a request with the given Accept header, if
+// any.
+func negotiate(v interface{}, accept string, preferred ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/items", nil)
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	Negotiate(rec, r, http.StatusOK, v, preferred...)
+	return rec
+}
+
+func TestNegotiate(t *testing.T) {
+	Register(YAMLEncoder, CSVEncoder)
+	v := item{ID: 1, Name: "a"}
+
+	tests := []struct {
+		name      string
+		accept    string
+		preferred []string
+		want      string
+	}{
+		{"no Accept", "", nil, "application/json"},
+		{"no Accept, preferred XML", "", []string{"text/xml"}, "text/xml"},
+		{"any type", "*/*", nil, "application/json"},
+		{"exact type", "application/xml", nil, "text/xml"},
+		{"type case", "Application/YAML", nil, "application/yaml"},
+		{"q-values", "application/json;q=0.5, text/yaml", nil, "application/yaml"},
+		{"same q, most specific", "*/*, text/csv", nil, "text/csv; charset=utf-8"},
+		{"most specific range weighs", "text/*;q=0.9, text/xml;q=0.1, text/yaml;q=0.1", nil, "text/csv; charset=utf-8"},
+		{"q=0 excludes", "application/json;q=0, */*;q=0.8", nil, "text/xml"},
+		{"several values", "text/html, application/yaml;q=0.2", nil, "application/yaml"},
+		{"malformed ranges ignored", "a, */json, text/xml;q=2, application/json", nil, "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := negotiate(v, tt.accept, tt.preferred...)
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != tt.want {
+				t.Errorf("got %d %s, want 200 %s", rec.Code, rec.Header().Get("Content-Type"), tt.want)
+			}
+			if rec.Header().Get("Vary") != "Accept" {
+				t.Errorf("Vary = %q, want Accept", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestNegotiateFallsBackWhenMarshalFails(t *testing.T) {
+	Register(CSVEncoder)
+
+	// A string can't be written as CSV.
+	rec := negotiate("a", "text/csv, application/json;q=0.5")
+	if rec.Header().Get("Content-Type") != "application/json" || rec.Body.String() != `"a"` {
+		t.Errorf("got %s %s, want it as JSON", rec.Header().Get("Content-Type"), rec.Body)
+	}
+}
+
+func TestNegotiateNotAcceptable(t *testing.T) {
+	rec := negotiate(item{}, "image/png")
+	if rec.Code != http.StatusNotAcceptable || rec.Body.Len() != 0 {
+		t.Errorf("got %d %q, want 406 without body", rec.Code, rec.Body)
+	}
+
+	SetNotAcceptable(func(r *http.Request) interface{} {
+		return item{Name: r.Header.Get("Accept")}
+	})
+	t.Cleanup(func() { SetNotAcceptable(nil) })
+
+	rec = negotiate(item{}, "image/png", "text/xml")
+	if rec.Code != http.StatusNotAcceptable || rec.Header().Get("Content-Type") != "text/xml" {
+		t.Errorf("got %d %s, want 406 with the preferred type", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rec = negotiate(item{}, "image/png")
+	if rec.Body.String() != `{"id":0,"name":"image/png"}` {
+		t.Errorf("body = %s, want the one of the function", rec.Body)
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	h := http.Header{}
+	h.Set("Vary", "Origin")
+	AddVary(h, "Accept")
+	AddVary(h, "accept")
+	if got := h.Values("Vary"); len(got) != 2 || got[1] != "Accept" {
+		t.Errorf("Vary = %v, want [Origin Accept]", got)
+	}
+
+	h = http.Header{"Vary": {"*"}}
+	AddVary(h, "Accept")
+	if got := h.Values("Vary"); len(got) != 1 {
+		t.Errorf("Vary = %v, want only *", got)
+	}
+}
@@ -0,0 +1,217 @@
+package gsserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"goserver/utils/gslog"
+	"goserver/utils/gstime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultAddress is the address the server binds to if none is configured.
+const defaultAddress = "127.0.0.1"
+
+// defaultPort is the port the server listens on if none is configured.
+const defaultPort = 8080
+
+// Default timeouts of the http.Server. See ServerConfig for their meaning.
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 30 * time.Second
+	defaultWriteTimeout      = 30 * time.Second
+	defaultIdleTimeout       = 120 * time.Second
+	defaultShutdownTimeout   = 30 * time.Second
+	defaultDrainDelay        = 5 * time.Second
+)
+
+// draining is set (to 1) once the server starts shutting down. It's accessed
+// atomically since it's read by every health check request.
+var draining int32
+
+// hooks contains the functions to be run once the server stops serving
+// requests, in reverse registration order.
+var hooks []shutdownHook
+
+// hooksMu synchronizes the access to hooks.
+var hooksMu sync.Mutex
+
+// ShutdownHook is a function run during the server shutdown, once every
+// in-flight request is done. It should return before the context is done.
+type ShutdownHook func(ctx context.Context) error
+
+// shutdownHook is a registered ShutdownHook along with the name used to
+// report it in logs.
+type shutdownHook struct {
+	name string
+	fn   ShutdownHook
+}
+
+// ServerConfig contains the configuration properties of the http server.
+// Every field is optional and, if not set, its default is used.
+type ServerConfig struct {
+
+	// Address is the host or IP the server binds to. Use "0.0.0.0" to listen
+	// on every interface. If not set, defaultAddress is used.
+	Address           *string          `json:"address"`
+
+	// ReadHeaderTimeout specifies the duration allowed to read the
+	// request headers.
+	ReadHeaderTimeout *gstime.Duration `json:"read_header_timeout"`
+
+	// ReadTimeout specifies the duration allowed to read the whole
+	// request, body included.
+	ReadTimeout       *gstime.Duration `json:"read_timeout"`
+
+	// WriteTimeout specifies the duration allowed to write the
+	// response, counted from the end of the request headers.
+	WriteTimeout      *gstime.Duration `json:"write_timeout"`
+
+	// IdleTimeout specifies the duration a keep-alive connection
+	// is kept open waiting for the next request.
+	IdleTimeout       *gstime.Duration `json:"idle_timeout"`
+
+	// ShutdownTimeout specifies the duration given to in-flight
+	// requests and shutdown hooks to finish once a termination signal is
+	// received.
+	ShutdownTimeout   *gstime.Duration `json:"shutdown_timeout"`
+
+	// DrainDelay specifies the duration the server keeps accepting
+	// requests, while reporting itself unhealthy, before shutting down. This
+	// gives load balancers time to stop sending traffic to it. Set it to 0 to
+	// stop accepting requests right away, if there's no load balancer.
+	DrainDelay        *gstime.Duration `json:"drain_delay"`
+}
+
+// Server wraps an http.Server adding signal handling and graceful shutdown.
+type Server struct {
+
+	// HttpServer is the underlying server.
+	HttpServer      *http.Server
+
+	// ShutdownTimeout is the deadline for the shutdown once a signal is
+	// received.
+	ShutdownTimeout time.Duration
+
+	// DrainDelay is the time the server keeps serving after a signal is
+	// received and before it stops accepting requests.
+	DrainDelay      time.Duration
+}
+
+// New builds a Server listening on the given port (defaultPort if 0) and
+// serving the given handler, configured with the given ServerConfig.
+func New(port int, sc ServerConfig, h http.Handler) *Server {
+	if port == 0 {
+		port = defaultPort
+	}
+	address := defaultAddress
+	if sc.Address != nil {
+		address = *sc.Address
+	}
+	return &Server{
+		HttpServer: &http.Server{
+			Addr:              net.JoinHostPort(address, strconv.Itoa(port)),
+			Handler:           h,
+			ReadHeaderTimeout: sc.ReadHeaderTimeout.Or(defaultReadHeaderTimeout),
+			ReadTimeout:       sc.ReadTimeout.Or(defaultReadTimeout),
+			WriteTimeout:      sc.WriteTimeout.Or(defaultWriteTimeout),
+			IdleTimeout:       sc.IdleTimeout.Or(defaultIdleTimeout),
+		},
+		ShutdownTimeout: sc.ShutdownTimeout.Or(defaultShutdownTimeout),
+		DrainDelay:      sc.DrainDelay.Or(defaultDrainDelay),
+	}
+}
+
+// Run starts serving requests and blocks until the server is stopped.
+//
+// If the server can't start (for example, the address is already in use) the
+// error is returned right away. Otherwise, Run waits for a SIGINT or SIGTERM
+// and then shuts the server down gracefully: the health check starts failing,
+// in-flight requests are given until the ShutdownTimeout to finish, and the
+// registered shutdown hooks are run. Any error found in the process is
+// returned.
+func (s *Server) Run() error {
+
+	listener, err := net.Listen("tcp", s.HttpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("couldn't start server on %s: %s", s.HttpServer.Addr, err.Error())
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.HttpServer.Serve(listener)
+	}()
+	gslog.Server(fmt.Sprintf("Server listening on %s", s.HttpServer.Addr))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serveErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("server stopped unexpectedly: %s", err.Error())
+		}
+		return nil
+	case sig := <-signals:
+		gslog.Server(fmt.Sprintf("Received signal %s. Shutting down server", sig))
+	}
+
+	return s.Shutdown()
+}
+
+// Shutdown stops the server gracefully. See Run.
+func (s *Server) Shutdown() error {
+
+	atomic.StoreInt32(&draining, 1)
+	if s.DrainDelay > 0 {
+		gslog.Server(fmt.Sprintf("Draining for %s before closing listeners", s.DrainDelay))
+		time.Sleep(s.DrainDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+
+	var errs []error
+	if err := s.HttpServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("couldn't drain in-flight requests: %s", err.Error()))
+	}
+	gslog.Server("Server stopped accepting requests")
+
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		gslog.Server(fmt.Sprintf("Running shutdown hook: %s", hooks[i].name))
+		if err := hooks[i].fn(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown hook %s failed: %s", hooks[i].name, err.Error()))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("errors found during shutdown: %v", errs)
+	}
+	return nil
+}
+
+// OnShutdown registers a function to be run when the server shuts down, after
+// in-flight requests are done. Hooks run in reverse registration order, so
+// the ones registered first (for example, closing log files) run last.
+func OnShutdown(name string, fn ShutdownHook) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, shutdownHook{name: name, fn: fn})
+}
+
+// Draining reports whether the server is shutting down. Health checks should
+// fail while it's true, so no new traffic is sent to this instance.
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
@@ -0,0 +1,197 @@
+package gsserver
+
+import (
+	"context"
+	"errors"
+	"goserver/utils/gstime"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// resetLifecycle clears the hooks and the draining flag after the test.
+func resetLifecycle(t *testing.T) {
+	hooksMu.Lock()
+	hooks = nil
+	hooksMu.Unlock()
+	atomic.StoreInt32(&draining, 0)
+	t.Cleanup(func() {
+		hooksMu.Lock()
+		hooks = nil
+		hooksMu.Unlock()
+		atomic.StoreInt32(&draining, 0)
+	})
+}
+
+// freeAddress returns a local address nobody is listening on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// healthHandler answers 503 while the server is draining, as health checks do.
+var healthHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if Draining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+})
+
+// testServer returns a server on a free address with the given drain delay.
+func testServer(t *testing.T, drainDelay time.Duration) *Server {
+	t.Helper()
+	s := New(0, ServerConfig{}, healthHandler)
+	s.HttpServer.Addr = freeAddress(t)
+	s.ShutdownTimeout = time.Second
+	s.DrainDelay = drainDelay
+	return s
+}
+
+func TestNewDefaults(t *testing.T) {
+	s := New(0, ServerConfig{}, healthHandler)
+	if s.HttpServer.Addr != "127.0.0.1:8080" || s.DrainDelay != defaultDrainDelay || s.ShutdownTimeout != defaultShutdownTimeout {
+		t.Errorf("server = %s, drain %s, shutdown %s, want the defaults", s.HttpServer.Addr, s.DrainDelay, s.ShutdownTimeout)
+	}
+	zero := gstime.Duration(0)
+	s = New(0, ServerConfig{DrainDelay: &zero}, healthHandler)
+	if s.DrainDelay != 0 {
+		t.Errorf("drain = %s, want 0 when set explicitly", s.DrainDelay)
+	}
+}
+
+func TestShutdownRunsHooksInReverseOrder(t *testing.T) {
+	resetLifecycle(t)
+	var order []string
+	for _, name := range []string{"first", "second", "third"} {
+		name := name
+		OnShutdown(name, func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		})
+	}
+
+	if err := testServer(t, 0).Shutdown(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(order, ",") != "third,second,first" {
+		t.Errorf("hooks run in order %v, want the reverse of registration", order)
+	}
+}
+
+func TestShutdownReportsEveryHookError(t *testing.T) {
+	resetLifecycle(t)
+	ran := 0
+	OnShutdown("flush", func(ctx context.Context) error {
+		ran++
+		return errors.New("flush failed")
+	})
+	OnShutdown("ok", func(ctx context.Context) error {
+		ran++
+		return nil
+	})
+	OnShutdown("close", func(ctx context.Context) error {
+		ran++
+		return errors.New("close failed")
+	})
+
+	err := testServer(t, 0).Shutdown()
+	if ran != 3 {
+		t.Errorf("%d hooks run, want all of them despite the errors", ran)
+	}
+	if err == nil || !strings.Contains(err.Error(), "shutdown hook flush failed: flush failed") || !strings.Contains(err.Error(), "shutdown hook close failed: close failed") {
+		t.Errorf("err = %v, want both hook errors", err)
+	}
+}
+
+func TestShutdownDrainsBeforeClosing(t *testing.T) {
+	resetLifecycle(t)
+	s := testServer(t, 200*time.Millisecond)
+	l, err := net.Listen("tcp", s.HttpServer.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.HttpServer.Serve(l)
+
+	if Draining() {
+		t.Fatal("draining before the shutdown")
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown() }()
+	time.Sleep(50 * time.Millisecond)
+
+	// While draining, requests are still served, but health checks fail.
+	resp, err := http.Get("http://" + s.HttpServer.Addr)
+	if err != nil {
+		t.Fatalf("request rejected while draining: %v", err)
+	}
+	resp.Body.Close()
+	if !Draining() || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("status = %d while draining, want 503", resp.StatusCode)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := http.Get("http://" + s.HttpServer.Addr); err == nil {
+		t.Error("request served after the shutdown")
+	}
+}
+
+func TestRunFailsIfAddressInUse(t *testing.T) {
+	resetLifecycle(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := testServer(t, 0)
+	s.HttpServer.Addr = l.Addr().String()
+
+	if err := s.Run(); err == nil || !strings.Contains(err.Error(), "couldn't start server") {
+		t.Errorf("err = %v, want the listen error", err)
+	}
+}
+
+func TestRunShutsDownOnSignal(t *testing.T) {
+	resetLifecycle(t)
+	hookRun := make(chan struct{})
+	OnShutdown("hook", func(ctx context.Context) error {
+		close(hookRun)
+		return nil
+	})
+	s := testServer(t, 0)
+
+	// Until Run listens for signals, SIGTERM must not kill the test binary.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	for {
+		syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			select {
+			case <-hookRun:
+			default:
+				t.Error("shutdown hook not run")
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package gstime
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration to be used in configuration structs. It can be
+// written either as a number of seconds (possibly fractional, like 0.5) or as
+// a string parsed by time.ParseDuration (like "30s", "1m30s" or "250ms").
+type Duration time.Duration
+
+// Seconds returns a Duration of the given number of seconds.
+func Seconds(s float64) Duration {
+	return Duration(s * float64(time.Second))
+}
+
+// Duration returns d as a time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns d in the format of time.Duration (for example, 1m30s).
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Or returns the value pointed by d as a time.Duration, or def if d is nil.
+// Meant for optional configuration properties.
+func (d *Duration) Or(def time.Duration) time.Duration {
+	if d == nil {
+		return def
+	}
+	return time.Duration(*d)
+}
+
+// Implements interface json.Marshaler. Durations are written as strings, so
+// they can be read back unambiguously.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Implements interface json.Unmarshaler. Accepts a number of seconds or a
+// string parsed by time.ParseDuration.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch value := v.(type) {
+	case float64:
+		*d = Seconds(value)
+		return nil
+	case string:
+		parsed, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected a number of seconds or a string like \"30s\"", value)
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+	return fmt.Errorf("invalid duration %s, expected a number of seconds or a string like \"30s\"", string(b))
+}
@@ -0,0 +1,67 @@
+package gstime
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{`30`, 30 * time.Second},
+		{`0.5`, 500 * time.Millisecond},
+		{`0`, 0},
+		{`"30s"`, 30 * time.Second},
+		{`" 1m30s "`, 90 * time.Second},
+		{`"250ms"`, 250 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		var d Duration
+		if err := json.Unmarshal([]byte(tt.input), &d); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if d.Duration() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.input, d, tt.want)
+		}
+	}
+}
+
+func TestDurationUnmarshalJSONRejectsInvalidValues(t *testing.T) {
+	for _, input := range []string{`"soon"`, `"30"`, `true`, `[]`, `{}`, `null`} {
+		var d Duration
+		err := json.Unmarshal([]byte(input), &d)
+		if err == nil || !strings.Contains(err.Error(), "expected a number of seconds") {
+			t.Errorf("%s: err = %v, want an invalid duration error", input, err)
+		}
+	}
+}
+
+func TestDurationMarshalJSONRoundTrip(t *testing.T) {
+	b, err := json.Marshal(Seconds(90))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(b) != `"1m30s"` {
+		t.Errorf("marshalled %s, want \"1m30s\"", b)
+	}
+	var d Duration
+	if err := json.Unmarshal(b, &d); err != nil || d != Seconds(90) {
+		t.Errorf("read back %s, %v, want 1m30s", d, err)
+	}
+}
+
+func TestDurationOr(t *testing.T) {
+	var unset *Duration
+	if got := unset.Or(time.Minute); got != time.Minute {
+		t.Errorf("nil.Or = %s, want the default", got)
+	}
+	set := Seconds(2)
+	if got := set.Or(time.Minute); got != 2*time.Second {
+		t.Errorf("Or = %s, want 2s", got)
+	}
+}
@@ -0,0 +1,61 @@
+package gstrace
+
+import (
+	"goserver/utils/gsmiddleware"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler is a middleware creating a server span for every request received.
+//
+// It must be placed after gsmiddleware.TraceID: the span continues the trace
+// received in the traceparent header (if any) and gets the trace ID and span
+// ID of the request's gsmiddleware.TraceContext, so that they match the ones
+// in the logs and in the headers sent to other services.
+func Handler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+
+		ctx := r.Context()
+
+		// Context used only to start the span, see withIDs.
+		startCtx := otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(r.Header))
+		if tc, ok := gsmiddleware.GetTraceContext(ctx); ok {
+			startCtx = withIDs(startCtx, tc.W3CTraceID, tc.SpanID)
+		}
+
+		_, span := tracer().Start(startCtx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("server.address", r.Host),
+				attribute.String("user_agent.original", r.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		ww := gsmiddleware.NewResponseWriterWrapper(w, false)
+		next.ServeHTTP(ww, r.WithContext(trace.ContextWithSpan(ctx, span)))
+
+		// The route pattern is only known once the request was routed.
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+		}
+		status := ww.StatusCode()
+		span.SetAttributes(
+			attribute.Int("http.response.status_code", status),
+			attribute.Int64("http.response.body.size", ww.BytesWritten()),
+		)
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,57 @@
+package gstrace
+
+import (
+	"context"
+	"crypto/rand"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Key type to use when setting the IDs of the next span.
+type ctxKeyIDs int
+
+// idsKey is the key that holds the forcedIDs of the next span in a context.
+const idsKey ctxKeyIDs = 0
+
+// forcedIDs are the IDs to be used by the next span started with a context.
+type forcedIDs struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// withIDs returns a copy of ctx in which the next span started gets the given
+// IDs, so that they match the ones set by gsmiddleware.TraceID (and logged by
+// gslog). Invalid IDs are ignored and random ones are used instead.
+//
+// The returned context must only be used to start the span: spans started
+// with a context derived from it would get the same span ID.
+func withIDs(ctx context.Context, traceID string, spanID string) context.Context {
+	ids := forcedIDs{}
+	ids.traceID, _ = trace.TraceIDFromHex(traceID)
+	ids.spanID, _ = trace.SpanIDFromHex(spanID)
+	return context.WithValue(ctx, idsKey, ids)
+}
+
+// idGenerator implements sdktrace.IDGenerator, using the IDs set with withIDs
+// when present and random ones otherwise.
+type idGenerator struct{}
+
+// NewIDs returns the trace ID and span ID of a new root span.
+func (g idGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	ids, _ := ctx.Value(idsKey).(forcedIDs)
+	traceID := ids.traceID
+	for !traceID.IsValid() {
+		rand.Read(traceID[:])
+	}
+	return traceID, g.NewSpanID(ctx, traceID)
+}
+
+// NewSpanID returns the span ID of a new span of the given trace.
+func (g idGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	ids, _ := ctx.Value(idsKey).(forcedIDs)
+	spanID := ids.spanID
+	for !spanID.IsValid() {
+		rand.Read(spanID[:])
+	}
+	return spanID
+}
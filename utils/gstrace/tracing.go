@@ -0,0 +1,315 @@
+package gstrace
+
+import (
+	"context"
+	"fmt"
+	"goserver/utils/gslog"
+	"goserver/utils/gstime"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName identifies the spans created by this package.
+const instrumentationName = "goserver/utils/gstrace"
+
+// defaultServiceName is the service name reported if none is configured.
+const defaultServiceName = "goserver"
+
+// defaultExportTimeout is the time given to the exporter to send a batch of
+// spans if none is configured.
+const defaultExportTimeout = 10 * time.Second
+
+// Exporter specifies where the spans are sent.
+type Exporter string
+
+const (
+	// NONE_EXPORTER disables tracing: spans are not recorded.
+	NONE_EXPORTER   Exporter = "none"
+
+	// OTLP_EXPORTER sends the spans to an OpenTelemetry collector using the
+	// OTLP protocol over HTTP.
+	OTLP_EXPORTER   Exporter = "otlp"
+
+	// STDOUT_EXPORTER writes the spans to the standard output, as JSON.
+	STDOUT_EXPORTER Exporter = "stdout"
+
+	// MEMORY_EXPORTER keeps the spans in memory (see MemoryExporter). Meant for
+	// tests and local debugging, without a collector.
+	MEMORY_EXPORTER Exporter = "memory"
+)
+
+// TracingConfig contains the configuration properties of the tracing. Every
+// field is optional and, if not set, its default is used.
+type TracingConfig struct {
+
+	// Exporter specifies where the spans are sent. If not set, tracing is
+	// disabled (NONE_EXPORTER).
+	Exporter    *Exporter         `json:"exporter"`
+
+	// ServiceName is the name of the service reported in every span. If not
+	// set, defaultServiceName is used.
+	ServiceName *string           `json:"service_name"`
+
+	// Endpoint is the host and port (like "localhost:4318") of the collector
+	// the spans are sent to by the OTLP exporter. If not set, the exporter's
+	// default (or the OTEL_EXPORTER_OTLP_ENDPOINT variable) is used.
+	Endpoint    *string           `json:"endpoint"`
+
+	// URLPath is the path of the collector endpoint receiving the spans. If
+	// not set, the exporter's default ("/v1/traces") is used.
+	URLPath     *string           `json:"url_path"`
+
+	// Insecure sends the spans to the collector over plain HTTP instead of
+	// HTTPS.
+	Insecure    bool              `json:"insecure"`
+
+	// Headers are added to every request sent to the collector.
+	Headers     map[string]string `json:"headers"`
+
+	// Timeout specifies the duration given to the exporter to send a batch of
+	// spans. If not set, defaultExportTimeout is used.
+	Timeout     *gstime.Duration  `json:"timeout"`
+
+	// SampleRatio is the fraction (between 0 and 1) of the traces started by
+	// this service that are recorded. Traces started by a caller follow its
+	// decision. If not set, every trace is recorded.
+	SampleRatio *float64          `json:"sample_ratio"`
+}
+
+// provider is the current tracer provider, nil if tracing is disabled.
+var provider *sdktrace.TracerProvider
+
+// memoryExporter is the exporter of the current provider, if it's a
+// MEMORY_EXPORTER.
+var memoryExporter *tracetest.InMemoryExporter
+
+// applied is the configuration of the current provider.
+var applied *TracingConfig
+
+// mu synchronizes the replacement of the provider.
+var mu sync.Mutex
+
+// Initialization. Only sets the W3C propagator, so that the trace context is
+// read and written in the traceparent and tracestate headers.
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// Provider is a tracer provider built with a configuration (see NewProvider),
+// which is not used until it's made current with SetProvider.
+type Provider struct {
+
+	// tp is the tracer provider, nil if tracing is disabled.
+	tp       *sdktrace.TracerProvider
+
+	// memory is the exporter of tp, if it's a MEMORY_EXPORTER.
+	memory   *tracetest.InMemoryExporter
+
+	// exporter is the exporter configured.
+	exporter Exporter
+
+	// config is the configuration tp was built with.
+	config   TracingConfig
+}
+
+// Configure enables the configuration of the tracing. A new tracer provider is
+// built with the given configuration and, if it could be built, it replaces
+// the current one (see SetProvider).
+func Configure(tc TracingConfig) error {
+	p, err := NewProvider(tc)
+	if err != nil {
+		return err
+	}
+	SetProvider(p)
+	return nil
+}
+
+// NewProvider builds a tracer provider with the given configuration, without
+// making it current, so that it can be prepared along with the rest of the
+// configuration and only applied if all of it is valid.
+func NewProvider(tc TracingConfig) (*Provider, error) {
+
+	exporter := NONE_EXPORTER
+	if tc.Exporter != nil {
+		exporter = Exporter(strings.ToLower(string(*tc.Exporter)))
+	}
+	p := &Provider{exporter: exporter, config: tc}
+	if exporter == NONE_EXPORTER {
+		return p, nil
+	}
+
+	opts, memory, err := exporterOptions(exporter, tc)
+	if err != nil {
+		return nil, err
+	}
+	serviceName := defaultServiceName
+	if tc.ServiceName != nil {
+		serviceName = *tc.ServiceName
+	}
+	sampler := sdktrace.AlwaysSample()
+	if tc.SampleRatio != nil {
+		sampler = sdktrace.TraceIDRatioBased(*tc.SampleRatio)
+	}
+	opts = append(opts,
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithIDGenerator(idGenerator{}),
+	)
+	p.tp = sdktrace.NewTracerProvider(opts...)
+	p.memory = memory
+	return p, nil
+}
+
+// SetProvider makes the given provider current. The previous one is flushed
+// and shut down. If the configuration didn't change, the current provider is
+// kept (so are the spans of a MEMORY_EXPORTER) and the given one is shut down
+// instead.
+func SetProvider(p *Provider) {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if applied != nil && reflect.DeepEqual(*applied, p.config) {
+		shutdownLater(p.tp)
+		return
+	}
+
+	prev := provider
+	provider, memoryExporter, applied = p.tp, p.memory, &p.config
+	if p.tp != nil {
+		otel.SetTracerProvider(p.tp)
+	} else {
+		otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	}
+	gslog.Server(fmt.Sprintf("Tracing configured with %s exporter", p.exporter))
+
+	// Spans already started with the previous provider are still exported
+	// when they end, until it's shut down.
+	shutdownLater(prev)
+}
+
+// shutdownLater flushes and shuts down the given tracer provider, if any, in
+// the background.
+func shutdownLater(tp *sdktrace.TracerProvider) {
+	if tp == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultExportTimeout)
+		defer cancel()
+		tp.Shutdown(ctx)
+	}()
+}
+
+// exporterOptions returns the tracer provider options to send spans to the
+// given exporter.
+func exporterOptions(exporter Exporter, tc TracingConfig) ([]sdktrace.TracerProviderOption, *tracetest.InMemoryExporter, error) {
+	timeout := tc.Timeout.Or(defaultExportTimeout)
+	switch exporter {
+	case OTLP_EXPORTER:
+		opts := []otlptracehttp.Option{otlptracehttp.WithTimeout(timeout)}
+		if tc.Endpoint != nil {
+			opts = append(opts, otlptracehttp.WithEndpoint(*tc.Endpoint))
+		}
+		if tc.URLPath != nil {
+			opts = append(opts, otlptracehttp.WithURLPath(*tc.URLPath))
+		}
+		if tc.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(tc.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(tc.Headers))
+		}
+		// The exporter connects lazily, so this doesn't fail if the
+		// collector is not available.
+		exp, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating otlp exporter: %s", err.Error())
+		}
+		return []sdktrace.TracerProviderOption{sdktrace.WithBatcher(exp, sdktrace.WithExportTimeout(timeout))}, nil, nil
+	case STDOUT_EXPORTER:
+		exp, err := stdouttrace.New()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error creating stdout exporter: %s", err.Error())
+		}
+		return []sdktrace.TracerProviderOption{sdktrace.WithSyncer(exp)}, nil, nil
+	case MEMORY_EXPORTER:
+		exp := tracetest.NewInMemoryExporter()
+		return []sdktrace.TracerProviderOption{sdktrace.WithSyncer(exp)}, exp, nil
+	}
+	return nil, nil, fmt.Errorf("unknown tracing exporter %s, expected one of %s, %s, %s or %s",
+		exporter, NONE_EXPORTER, OTLP_EXPORTER, STDOUT_EXPORTER, MEMORY_EXPORTER)
+}
+
+// Shutdown flushes the spans not exported yet and stops the current tracer
+// provider. Meant to be registered as a gsserver shutdown hook.
+func Shutdown(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if provider == nil {
+		return nil
+	}
+	err := provider.Shutdown(ctx)
+	provider, applied = nil, nil
+	otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	return err
+}
+
+// MemoryExporter returns the exporter holding the spans recorded, if tracing
+// is configured with MEMORY_EXPORTER. Returns nil otherwise.
+func MemoryExporter() *tracetest.InMemoryExporter {
+	mu.Lock()
+	defer mu.Unlock()
+	return memoryExporter
+}
+
+// tracer returns the tracer used to create every span of this package.
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start creates a new span, child of the one in ctx (if any), and returns it
+// along with a copy of ctx holding it. The span must be ended with End.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// RecordErrorCode marks the span in ctx as failed, adding the application
+// error code and label (see apierrors) as attributes, so traces can be
+// searched by them.
+func RecordErrorCode(ctx context.Context, code int, label string, message string) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("error.code", code),
+		attribute.String("error.type", label),
+	)
+	span.SetStatus(codes.Error, message)
+}
@@ -0,0 +1,190 @@
+package gstrace_test
+
+import (
+	"context"
+	"goserver/utils/gsclient"
+	"goserver/utils/gsmiddleware"
+	"goserver/utils/gstrace"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// configureMemory enables tracing with the memory exporter for the test.
+func configureMemory(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	exporter := gstrace.MEMORY_EXPORTER
+	if err := gstrace.Configure(gstrace.TracingConfig{Exporter: &exporter}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { gstrace.Shutdown(context.Background()) })
+	return gstrace.MemoryExporter()
+}
+
+// spanNamed returns the span with the given name.
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	t.Fatalf("no span %q in %v", name, names)
+	return tracetest.SpanStub{}
+}
+
+// attr returns the value of the attribute of the span with the given key.
+func attr(s tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// assertChild checks that child is a span of the same trace as parent, and
+// its child.
+func assertChild(t *testing.T, parent tracetest.SpanStub, child tracetest.SpanStub) {
+	t.Helper()
+	if child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+		t.Errorf("span %q is in trace %s, want %s", child.Name, child.SpanContext.TraceID(), parent.SpanContext.TraceID())
+	}
+	if child.Parent.SpanID() != parent.SpanContext.SpanID() {
+		t.Errorf("span %q has parent %s, want %q (%s)", child.Name, child.Parent.SpanID(), parent.Name, parent.SpanContext.SpanID())
+	}
+}
+
+// TestSpans follows a request received by the server which calls a downstream
+// API with a client authenticated by a token source, so that the token is
+// renewed within the call.
+func TestSpans(t *testing.T) {
+	exporter := configureMemory(t)
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token_type":"Bearer","access_token":"abc","expires_in":3600}`))
+	}))
+	defer tokenServer.Close()
+
+	var traceparent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get(gsmiddleware.TraceparentHeader)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer downstream.Close()
+
+	reg := gsclient.NewRegistry()
+	tokenSourceKey := "TokenSource"
+	if _, err := reg.NewClient(gsclient.ClientConfig{Key: "TokenClient", Basepath: tokenServer.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reg.NewTokenSource(gsclient.TokenSourceConfig{Key: tokenSourceKey, ClientKey: "TokenClient"}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := reg.NewClient(gsclient.ClientConfig{Key: "Downstream", Basepath: downstream.URL, TokenSourceKey: &tokenSourceKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Use(gsmiddleware.TraceID, gstrace.Handler)
+	router.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := gsmiddleware.WithRouteTemplate(r.Context(), "/items/{id}")
+		req, err := client.NewRequest(ctx, http.MethodGet, "/items/1")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp, err := client.HttpClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		resp.Body.Close()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users/7", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+
+	spans := exporter.GetSpans()
+	server := spanNamed(t, spans, "GET /users/{id}")
+	call := spanNamed(t, spans, "GET /items/{id}")
+	renewal := spanNamed(t, spans, "token renewal TokenSource")
+	tokenCall := spanNamed(t, spans, "POST /")
+
+	if server.SpanKind != trace.SpanKindServer || server.Parent.IsValid() {
+		t.Errorf("server span = %s with parent %v, want a root server span", server.SpanKind, server.Parent.SpanID())
+	}
+	if got := attr(server, "http.route").AsString(); got != "/users/{id}" {
+		t.Errorf("http.route = %q, want /users/{id}", got)
+	}
+	if got := attr(server, "http.response.status_code").AsInt64(); got != 200 {
+		t.Errorf("server status = %d, want 200", got)
+	}
+
+	assertChild(t, server, call)
+	if call.SpanKind != trace.SpanKindClient {
+		t.Errorf("client span kind = %s, want client", call.SpanKind)
+	}
+	if got := attr(call, "client.key").AsString(); got != "Downstream" {
+		t.Errorf("client.key = %q, want Downstream", got)
+	}
+	if got := attr(call, "http.response.status_code").AsInt64(); got != 200 {
+		t.Errorf("client status = %d, want 200", got)
+	}
+
+	assertChild(t, call, renewal)
+	if got := attr(renewal, "token_source.key").AsString(); got != tokenSourceKey {
+		t.Errorf("token_source.key = %q, want %s", got, tokenSourceKey)
+	}
+	assertChild(t, renewal, tokenCall)
+	if got := attr(tokenCall, "client.call_kind").AsString(); got != string(gsmiddleware.TOKEN_RENEWAL_CALL) {
+		t.Errorf("client.call_kind = %q, want %s", got, gsmiddleware.TOKEN_RENEWAL_CALL)
+	}
+
+	// The downstream API gets the trace and the client span as its parent.
+	want := server.SpanContext.TraceID().String() + "-" + call.SpanContext.SpanID().String()
+	if !strings.Contains(traceparent, want) {
+		t.Errorf("traceparent = %q, want it to contain %s", traceparent, want)
+	}
+}
+
+// TestServerSpanContinuesIncomingTrace checks that the server span joins the
+// trace received in the traceparent header.
+func TestServerSpanContinuesIncomingTrace(t *testing.T) {
+	exporter := configureMemory(t)
+
+	handler := gsmiddleware.TraceID(gstrace.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})))
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set(gsmiddleware.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || s.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("span in trace %s with parent %s, want the incoming ones", s.SpanContext.TraceID(), s.Parent.SpanID())
+	}
+	if s.Status.Code.String() != "Error" {
+		t.Errorf("status = %s, want Error for a 503", s.Status.Code)
+	}
+}
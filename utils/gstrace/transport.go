@@ -0,0 +1,73 @@
+package gstrace
+
+import (
+	"fmt"
+	"goserver/utils/gsmiddleware"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Transport wraps an http.RoundTripper creating a client span for every
+// request sent through it.
+//
+// The ID of the span is set in the request context (see
+// gsmiddleware.WithOutboundSpanID), so that gsmiddleware.TracingTransport
+// sends it as the parent ID in the traceparent header.
+type Transport struct {
+
+	// Base defines the implementation of http.RoundTripper wrapped by this
+	// Transport.
+	Base      http.RoundTripper
+
+	// ClientKey identifies the client in every span.
+	ClientKey string
+}
+
+// Implements interface http.RoundTripper so it can be used as a Transport.
+// The span is named after the route template of the request (see
+// gsmiddleware.WithRouteTemplate) and marked as failed if no response is
+// received or its status is 5xx.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+
+	ctx := r.Context()
+	route := gsmiddleware.GetRouteTemplate(ctx)
+	name := r.Method
+	if route != "" {
+		name = r.Method + " " + route
+	}
+
+	parent := trace.SpanContextFromContext(ctx)
+	ctx, span := tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("client.key", t.ClientKey),
+			attribute.String("client.call_kind", string(gsmiddleware.GetCallKind(ctx))),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.full", r.URL.Redacted()),
+			attribute.String("server.address", r.URL.Host),
+			attribute.String("url.template", route),
+		),
+	)
+	defer span.End()
+
+	// With tracing disabled, the span is the parent one.
+	if sc := span.SpanContext(); sc.IsValid() && sc.SpanID() != parent.SpanID() {
+		ctx = gsmiddleware.WithOutboundSpanID(ctx, sc.SpanID().String())
+	}
+
+	rs, err := t.Base.RoundTrip(r.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return rs, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", rs.StatusCode))
+	if rs.StatusCode >= 500 {
+		span.SetStatus(codes.Error, fmt.Sprintf("status %d", rs.StatusCode))
+	}
+	return rs, err
+}
@@ -0,0 +1,161 @@
+package gsvalidation
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// defaultSuccessRanges are the status codes considered successful when no
+// WithSuccessRanges option is given.
+var defaultSuccessRanges = []StatusRange{{From: 200, To: 299}}
+
+// StatusRange is an inclusive range of http status codes.
+type StatusRange struct {
+	From int
+	To   int
+}
+
+// contains reports whether the status code is within the range.
+func (sr StatusRange) contains(status int) bool {
+	return status >= sr.From && status <= sr.To
+}
+
+// DecodedResponse describes the result of DecodeResponse.
+type DecodedResponse struct {
+
+	// Type tells the caller which destination, if any, holds the response.
+	Type   ResponseType
+
+	// Status is the http status code of the response.
+	Status int
+
+	// Header contains the response headers.
+	Header http.Header
+
+	// Body is the raw response body, as received.
+	Body   []byte
+
+	// Empty reports whether the response had no body to decode (for example,
+	// a 204 No Content). In that case, the destination is left untouched.
+	Empty  bool
+}
+
+// DecodeOption configures the behaviour of DecodeResponse.
+type DecodeOption func(*decodeOptions)
+
+// decodeOptions holds every value set by the DecodeOptions of a call.
+type decodeOptions struct {
+	successRanges []StatusRange
+	destinations  map[int]interface{}
+}
+
+// WithSuccessRanges replaces the status codes considered successful, which
+// default to 200-299.
+func WithSuccessRanges(ranges ...StatusRange) DecodeOption {
+	return func(o *decodeOptions) {
+		o.successRanges = ranges
+	}
+}
+
+// WithStatusDestination sets the destination to decode the body into when the
+// response has the given status code, instead of dstOk or dstErr.
+func WithStatusDestination(status int, dst interface{}) DecodeOption {
+	return func(o *decodeOptions) {
+		o.destinations[status] = dst
+	}
+}
+
+// DecodeResponse reads, decodes and validates the body of an http.Response
+// from an external API, always closing it.
+//
+// The status code decides where the body is decoded into: dstOk if it's
+// within the success ranges, dstErr otherwise (or the destination set for
+// that status with WithStatusDestination). The returned Type is OK_RESPONSE
+// or ERR_RESPONSE accordingly. If the destination is nil or the body is empty
+// (as in a 204), nothing is decoded and Empty is set.
+//
+// JSON and XML bodies are supported, chosen by the Content-Type header. A
+// missing Content-Type is decoded as JSON. Any other type results in a
+// DECODING_ERROR.
+func DecodeResponse(r *http.Response, dstOk interface{}, dstErr interface{}, opts ...DecodeOption) (DecodedResponse, error) {
+
+	defer r.Body.Close()
+
+	o := &decodeOptions{
+		successRanges: defaultSuccessRanges,
+		destinations:  make(map[int]interface{}),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	res := DecodedResponse{
+		Status: r.StatusCode,
+		Header: r.Header,
+	}
+
+	// Choose the destination by status code.
+	res.Type = ERR_RESPONSE
+	dst := dstErr
+	for _, sr := range o.successRanges {
+		if sr.contains(r.StatusCode) {
+			res.Type = OK_RESPONSE
+			dst = dstOk
+			break
+		}
+	}
+	if d, ok := o.destinations[r.StatusCode]; ok {
+		dst = d
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		res.Type = DECODING_ERROR
+		return res, fmt.Errorf("error retrieving response: %s", err.Error())
+	}
+	res.Body = data
+
+	if dst == nil || len(data) == 0 || r.StatusCode == http.StatusNoContent {
+		res.Empty = true
+		return res, nil
+	}
+
+	err = decodeBody(r.Header.Get("Content-Type"), data, dst)
+	if err != nil {
+		res.Type = DECODING_ERROR
+		return res, fmt.Errorf("error unmarshalling response with status %d: %s", r.StatusCode, err.Error())
+	}
+
+	// Validates the response before returning it to the caller.
+	err = Value(dst)
+	if err != nil {
+		res.Type = VALIDATION_ERROR
+		return res, err
+	}
+
+	return res, nil
+}
+
+// decodeBody unmarshals data into dst using the decoder matching the given
+// Content-Type.
+func decodeBody(contentType string, data []byte, dst interface{}) error {
+	if contentType == "" {
+		return json.Unmarshal(data, dst)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid Content-Type %q: %s", contentType, err.Error())
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return json.Unmarshal(data, dst)
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return xml.Unmarshal(data, dst)
+	}
+	return fmt.Errorf("unsupported Content-Type %q", mediaType)
+}
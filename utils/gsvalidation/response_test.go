@@ -0,0 +1,128 @@
+package gsvalidation
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// item is the successful body decoded in these tests.
+type item struct {
+	ID   string `json:"id" xml:"id" validate:"required"`
+	Name string `json:"name" xml:"name"`
+}
+
+// apiError is the error body decoded in these tests.
+type apiError struct {
+	Code string `json:"code" xml:"code"`
+}
+
+// trackedBody is a response body reporting whether it was closed.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+// Close implements io.Closer.
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// response returns a response with the given status, Content-Type (if any)
+// and body.
+func response(status int, contentType string, body string) (*http.Response, *trackedBody) {
+	b := &trackedBody{Reader: strings.NewReader(body)}
+	h := http.Header{}
+	if contentType != "" {
+		h.Set("Content-Type", contentType)
+	}
+	return &http.Response{StatusCode: status, Header: h, Body: b}, b
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		wantType    ResponseType
+		wantEmpty   bool
+		wantOk      item
+		wantErr     apiError
+	}{
+		{"JSON", 200, "application/json; charset=utf-8", `{"id":"1","name":"a"}`, OK_RESPONSE, false, item{ID: "1", Name: "a"}, apiError{}},
+		{"JSON suffix", 200, "application/vnd.api+json", `{"id":"1"}`, OK_RESPONSE, false, item{ID: "1"}, apiError{}},
+		{"no Content-Type", 200, "", `{"id":"1"}`, OK_RESPONSE, false, item{ID: "1"}, apiError{}},
+		{"XML", 200, "text/xml", `<item><id>1</id><name>a</name></item>`, OK_RESPONSE, false, item{ID: "1", Name: "a"}, apiError{}},
+		{"XML error", 404, "application/problem+xml", `<error><code>NF</code></error>`, ERR_RESPONSE, false, item{}, apiError{Code: "NF"}},
+		{"JSON error", 500, "application/json", `{"code":"E"}`, ERR_RESPONSE, false, item{}, apiError{Code: "E"}},
+		{"no content", 204, "application/json", "", OK_RESPONSE, true, item{}, apiError{}},
+		{"empty error", 503, "", "", ERR_RESPONSE, true, item{}, apiError{}},
+		{"unsupported Content-Type", 200, "text/plain", "id=1", DECODING_ERROR, false, item{}, apiError{}},
+		{"invalid Content-Type", 200, "a/b; =", `{"id":"1"}`, DECODING_ERROR, false, item{}, apiError{}},
+		{"malformed body", 200, "application/json", `{"id":`, DECODING_ERROR, false, item{}, apiError{}},
+		{"invalid body", 200, "application/json", `{"name":"a"}`, VALIDATION_ERROR, false, item{Name: "a"}, apiError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, body := response(tt.status, tt.contentType, tt.body)
+			var ok item
+			var e apiError
+
+			res, err := DecodeResponse(r, &ok, &e)
+			if res.Type != tt.wantType || res.Empty != tt.wantEmpty || res.Status != tt.status {
+				t.Errorf("result = %+v, want type %d, empty %t", res, tt.wantType, tt.wantEmpty)
+			}
+			if (err != nil) != (tt.wantType == DECODING_ERROR || tt.wantType == VALIDATION_ERROR) {
+				t.Errorf("err = %v", err)
+			}
+			if ok != tt.wantOk || e != tt.wantErr {
+				t.Errorf("decoded %+v, %+v, want %+v, %+v", ok, e, tt.wantOk, tt.wantErr)
+			}
+			if string(res.Body) != tt.body {
+				t.Errorf("body = %q, want %q", res.Body, tt.body)
+			}
+			if !body.closed {
+				t.Error("body not closed")
+			}
+		})
+	}
+}
+
+func TestDecodeResponseWithSuccessRanges(t *testing.T) {
+	r, _ := response(404, "application/json", `{"id":"1"}`)
+	var ok item
+	res, err := DecodeResponse(r, &ok, nil, WithSuccessRanges(StatusRange{From: 200, To: 299}, StatusRange{From: 404, To: 404}))
+	if err != nil || res.Type != OK_RESPONSE || ok.ID != "1" {
+		t.Errorf("result = %+v, %v, %+v, want 404 decoded as successful", res, err, ok)
+	}
+
+	r, _ = response(201, "application/json", `{"code":"E"}`)
+	var e apiError
+	res, err = DecodeResponse(r, nil, &e, WithSuccessRanges(StatusRange{From: 200, To: 200}))
+	if err != nil || res.Type != ERR_RESPONSE || e.Code != "E" {
+		t.Errorf("result = %+v, %v, %+v, want 201 decoded as an error", res, err, e)
+	}
+}
+
+func TestDecodeResponseWithStatusDestination(t *testing.T) {
+	type conflict struct {
+		Existing string `json:"existing"`
+	}
+	r, _ := response(409, "application/json", `{"existing":"1"}`)
+	var e apiError
+	var c conflict
+	res, err := DecodeResponse(r, nil, &e, WithStatusDestination(409, &c))
+	if err != nil || res.Type != ERR_RESPONSE || c.Existing != "1" || e != (apiError{}) {
+		t.Errorf("result = %+v, %v, %+v, %+v, want the body in the 409 destination", res, err, c, e)
+	}
+
+	// A nil destination skips the body.
+	r, body := response(200, "text/plain", "ignored")
+	res, err = DecodeResponse(r, nil, nil)
+	if err != nil || !res.Empty || string(res.Body) != "ignored" || !body.closed {
+		t.Errorf("result = %+v, %v, want the body kept but not decoded", res, err)
+	}
+}
@@ -5,8 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
+	"reflect"
 	"strings"
 
 	"github.com/go-playground/validator/v10"
@@ -17,6 +17,27 @@ import (
 type HttpSuggestionError struct {
 	Status uint
 	Message string
+	// Errors has one entry per field failing validation, if the request body was
+	// decoded but is not valid.
+	Errors []FieldError
+}
+
+// Implements interface error, so that it can be returned by a handler (see gshandler).
+func (e *HttpSuggestionError) Error() string {
+	return e.Message
+}
+
+// FieldError describes a field of a request body failing validation.
+type FieldError struct {
+	// Field is the path of the field, with the names of its json tags (for
+	// example, address.street).
+	Field   string `json:"field"`
+	// Message tells why the field is not valid.
+	Message string `json:"message"`
+	// Rule is the validation failed (for example, required or lte).
+	Rule    string `json:"rule"`
+	// Param is the parameter of the rule, if any (for example, 130 in lte=130).
+	Param   string `json:"param,omitempty"`
 }
 
 // ResponseType is used to inform in a function output params of this package what
@@ -38,59 +59,28 @@ var validate *validator.Validate
 // Initialization
 func init() {
 	validate = validator.New()
-}
-
-// DecodeJSONResponseBody wraps ioutil.ReadAll and json.Unmarshal functions to extract an
-// http.Response's body and unmarshal it into either an ok response or an error response
-// from an external API.
-func DecodeJSONResponseBody(r *http.Response, dstOk interface{}, dstErr interface{}) (respType ResponseType, err error) {
-
-	// Reads http.Response's body as a slice of bytes
-	data, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		return DECODING_ERROR, fmt.Errorf("error retrieving response: %s", err.Error())
-	}
-
-	// Tries to unmarshal the slice of bytes as the destination Ok response. If no error is 
-	// found, it means the decoding was successful.
-	err = json.Unmarshal(data, dstOk)
-	if err == nil {
-
-		// Validates the response before returning it to the caller.
-		err = Struct(dstOk)
-		if err != nil {
-			return VALIDATION_ERROR, err
+	// Fields are informed by their json names, as the client knows them.
+	validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
 		}
-
-		// Returns OK_RESPONSE notifying the caller the ok response is available in dstOk.
-		return OK_RESPONSE, nil
-	}
-
-	// Save the error message got so far.
-	errMsg := err.Error()
-
-	// If the caller only wanted to parse OK response.
-	if dstErr == nil {
-		return DECODING_ERROR, fmt.Errorf("error unmarshalling ok response: %s", errMsg)
-	}
-
-	// Tries to unmarshal the slice of bytes as the destination Err response. If no error is
-	// found, it means the decoding was successful.
-	err = json.Unmarshal(data, dstErr)
-	if err == nil {
-
-		// Validates the response before returning it to the caller.
-		err = Struct(dstErr)
-		if err != nil {
-			return VALIDATION_ERROR, err
+		if name == "" {
+			return f.Name
 		}
+		return name
+	})
+}
 
-		// Returns ERR_RESPONSE notifying the caller the error response is available in dstErr.
-		return ERR_RESPONSE, nil
-	}
-
-	// Both tries to unmarshal the data failed. Notify the caller.
-	return DECODING_ERROR, fmt.Errorf("error retrieving response. dstOk unmarshal error: %s; dstErr unmarshal error: %s", errMsg, err.Error())
+// DecodeJSONResponseBody extracts an http.Response's body and unmarshals it into
+// either an ok response or an error response from an external API, depending on
+// the response status code (2xx is ok). The body is always closed.
+//
+// Deprecated: use DecodeResponse, which also returns the status code and allows
+// configuring the success ranges and per status destinations.
+func DecodeJSONResponseBody(r *http.Response, dstOk interface{}, dstErr interface{}) (respType ResponseType, err error) {
+	res, err := DecodeResponse(r, dstOk, dstErr)
+	return res.Type, err
 }
 
 // DecodeJSONRequestBody wraps json.Decoder.Decode() function, adding validation and error
@@ -208,6 +198,7 @@ func RequestStruct(v interface{}) *HttpSuggestionError {
 		return &HttpSuggestionError{
 			Status: http.StatusBadRequest,
 			Message: FlatErrors(err.(validator.ValidationErrors)).Error(),
+			Errors: FieldErrors(err.(validator.ValidationErrors)),
 		}
 	}
 	return nil
@@ -228,6 +219,40 @@ func Struct(v interface{}) error {
 	return nil
 }
 
+// Value validates v if it's a struct, and dives into pointers, slices, arrays
+// and maps validating every struct found. Other values are considered valid.
+// Unlike Struct, it can be used with any response type (for example, a slice
+// of structs).
+
+// Returns error found, if any, containing all messages joined by a semicolon.
+func Value(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Struct:
+		return Struct(rv.Interface())
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := Value(rv.Index(i).Interface()); err != nil {
+				return fmt.Errorf("[%d]: %s", i, err.Error())
+			}
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := Value(iter.Value().Interface()); err != nil {
+				return fmt.Errorf("[%v]: %s", iter.Key().Interface(), err.Error())
+			}
+		}
+	}
+	return nil
+}
+
 // Var wraps validator.Validate.Var function. Validates a single field against the
 // requirements given by the tag.
 
@@ -243,6 +268,30 @@ func Var(v interface{}, tag string) error {
 	return nil
 }
 
+// FieldErrors receives a slice of validator.FieldError (alias: ValidationErrors) and
+// returns a FieldError for each of them, with the path of the field from the struct
+// validated.
+func FieldErrors(e validator.ValidationErrors) []FieldError {
+	fieldErrors := make([]FieldError, 0, len(e))
+	for _, err := range e {
+		field := err.Namespace()
+		if _, rest, ok := strings.Cut(field, "."); ok {
+			field = rest
+		}
+		rule := err.Tag()
+		if err.Param() != "" {
+			rule = fmt.Sprintf("%s=%s", rule, err.Param())
+		}
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: field,
+			Message: fmt.Sprintf("failed on the '%s' validation", rule),
+			Rule: err.Tag(),
+			Param: err.Param(),
+		})
+	}
+	return fieldErrors
+}
+
 // FlatErrors receives a slice of validator.FieldError (alias: ValidationErrors) and
 // returns an error built with all retrieved messages joined by a semicolon.
 func FlatErrors(e validator.ValidationErrors) error {